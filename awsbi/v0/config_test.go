@@ -1,14 +1,164 @@
 package v0
 
 import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/epiphany-platform/e-structures/shared"
 	"github.com/epiphany-platform/e-structures/utils/test"
 	"github.com/epiphany-platform/e-structures/utils/to"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+func TestConfig_Init(t *testing.T) {
+	tests := []struct {
+		name          string
+		moduleVersion string
+		want          *Config
+	}{
+		{
+			name:          "happy path",
+			moduleVersion: "v1.1.1",
+			want: &Config{
+				Meta: &Meta{
+					Kind:          to.StrPtr("awsbiConfig"),
+					Version:       to.StrPtr("v0.1.0"),
+					ModuleVersion: to.StrPtr("v1.1.1"),
+				},
+				Params: &Params{
+					Name:                  to.StrPtr("epiphany"),
+					Region:                to.StrPtr("eu-central-1"),
+					NatGatewayCount:       to.IntPtr(1),
+					VirtualPrivateGateway: to.BoolPtr(false),
+					RsaPublicKeyPath:      to.StrPtr("/shared/vms_rsa.pub"),
+					VpcAddressSpace:       to.StrPtr("10.1.0.0/20"),
+					Subnets: &Subnets{
+						Private: []Subnet{
+							{
+								Name:             to.StrPtr("first_private_subnet"),
+								AvailabilityZone: to.StrPtr("any"),
+								AddressPrefixes:  to.StrPtr("10.1.1.0/24"),
+							},
+						},
+						Public: []Subnet{
+							{
+								Name:             to.StrPtr("first_public_subnet"),
+								AvailabilityZone: to.StrPtr("any"),
+								AddressPrefixes:  to.StrPtr("10.1.2.0/24"),
+							},
+						},
+					},
+					SecurityGroups: []SecurityGroup{
+						{
+							Name: to.StrPtr("default_sg"),
+							Rules: &Rules{
+								Ingress: []SecurityRule{
+									{
+										Protocol:   to.StrPtr("-1"),
+										FromPort:   to.IntPtr(0),
+										ToPort:     to.IntPtr(0),
+										CidrBlocks: []string{"10.1.0.0/20"},
+									},
+									{
+										Protocol:   to.StrPtr("tcp"),
+										FromPort:   to.IntPtr(22),
+										ToPort:     to.IntPtr(22),
+										CidrBlocks: []string{"0.0.0.0/0"},
+									},
+								},
+								Egress: []SecurityRule{
+									{
+										Protocol:   to.StrPtr("-1"),
+										FromPort:   to.IntPtr(0),
+										ToPort:     to.IntPtr(0),
+										CidrBlocks: []string{"0.0.0.0/0"},
+									},
+								},
+							},
+						},
+					},
+					VmGroups: []VmGroup{
+						{
+							Name:               to.StrPtr("vm-group0"),
+							VmCount:            to.IntPtr(1),
+							VmSize:             to.StrPtr("t3.medium"),
+							UsePublicIp:        to.BoolPtr(false),
+							SubnetNames:        []string{"first_private_subnet"},
+							SecurityGroupNames: []string{"default_sg"},
+							VmImage: &VmImage{
+								AMI:   to.StrPtr("RHEL-7.8_HVM_GA-20200225-x86_64-1-Hourly2-GP2"),
+								Owner: to.StrPtr("309956199498"),
+							},
+							RootVolumeGbSize: to.IntPtr(30),
+							DataDisks: []DataDisk{
+								{
+									DeviceName: to.StrPtr("/dev/sdf"),
+									GbSize:     to.IntPtr(16),
+									Type:       to.StrPtr("gp2"),
+								},
+							},
+						},
+					},
+				},
+				Unused: []string{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			got := &Config{}
+			got.Init(tt.moduleVersion)
+			a.Equal(tt.want, got)
+			a.NoError(got.Validate())
+		})
+	}
+}
+
+func TestConfig_Backup(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr error
+	}{
+		{
+			name:    "happy path",
+			config:  &Config{},
+			wantErr: nil,
+		},
+		{
+			name:    "file already exists",
+			config:  &Config{},
+			wantErr: os.ErrExist,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			p, err := createTempDirectory("awsbi-config-backup")
+			a.NoError(err)
+			if errors.Is(tt.wantErr, os.ErrExist) {
+				err = ioutil.WriteFile(filepath.Join(p, "backup-file.json"), []byte("content"), 0644)
+				a.NoError(err)
+			}
+			err = tt.config.Backup(filepath.Join(p, "backup-file.json"))
+			if tt.wantErr != nil {
+				a.Error(err)
+				a.Equal(tt.wantErr, err)
+			} else {
+				a.NoError(err)
+			}
+		})
+	}
+}
+
 func TestConfig_Load_general(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -19,8 +169,11 @@ func TestConfig_Load_general(t *testing.T) {
 		{
 			name: "happy path",
 			json: []byte(`{
-	"kind": "awsbi",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "awsbiConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"region": "eu-central-1",
@@ -109,8 +262,11 @@ func TestConfig_Load_general(t *testing.T) {
 }
 `),
 			want: &Config{
-				Kind:    to.StrPtr(kind),
-				Version: to.StrPtr(version),
+				Meta: &Meta{
+					Kind:          to.StrPtr("awsbiConfig"),
+					Version:       to.StrPtr("v0.1.0"),
+					ModuleVersion: to.StrPtr("v0.0.1"),
+				},
 				Params: &Params{
 					Name:                  to.StrPtr("epiphany"),
 					Region:                to.StrPtr("eu-central-1"),
@@ -193,8 +349,11 @@ func TestConfig_Load_general(t *testing.T) {
 		{
 			name: "unknown fields in multiple places",
 			json: []byte(`{
-	"kind": "awsbi",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "awsbiConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"extra_outer_field" : "extra_outer_value",
 	"params": {
 		"extra_inner_field" : "extra_inner_value",
@@ -285,8 +444,11 @@ func TestConfig_Load_general(t *testing.T) {
 }
 `),
 			want: &Config{
-				Kind:    to.StrPtr(kind),
-				Version: to.StrPtr(version),
+				Meta: &Meta{
+					Kind:          to.StrPtr("awsbiConfig"),
+					Version:       to.StrPtr("v0.1.0"),
+					ModuleVersion: to.StrPtr("v0.0.1"),
+				},
 				Params: &Params{
 					Name:                  to.StrPtr("epiphany"),
 					Region:                to.StrPtr("eu-central-1"),
@@ -363,24 +525,24 @@ func TestConfig_Load_general(t *testing.T) {
 					},
 				},
 				Unused: []string{"params.extra_inner_field", "extra_outer_field"},
+				Unknown: map[string]interface{}{
+					"params.extra_inner_field": "extra_inner_value",
+					"extra_outer_field":        "extra_outer_value",
+				},
 			},
 			wantErr: nil,
 		},
 		{
-			name: "empty json",
-			json: []byte(`{}`),
+			name: "ensure load is performing validation",
+			json: []byte(`{
+	"meta": {
+		"kind": "awsbiConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	}
+}`),
 			want: nil,
 			wantErr: test.TestValidationErrors{
-				test.TestValidationError{
-					Key:   "Config.Kind",
-					Field: "Kind",
-					Tag:   "required",
-				},
-				test.TestValidationError{
-					Key:   "Config.Version",
-					Field: "Version",
-					Tag:   "required",
-				},
 				test.TestValidationError{
 					Key:   "Config.Params",
 					Field: "Params",
@@ -391,8 +553,11 @@ func TestConfig_Load_general(t *testing.T) {
 		{
 			name: "minimal correct json",
 			json: []byte(`{
-	"kind": "awsbi",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "awsbiConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"region": "eu-central-1",
@@ -416,8 +581,11 @@ func TestConfig_Load_general(t *testing.T) {
 }
 `),
 			want: &Config{
-				Kind:    to.StrPtr(kind),
-				Version: to.StrPtr(version),
+				Meta: &Meta{
+					Kind:          to.StrPtr("awsbiConfig"),
+					Version:       to.StrPtr("v0.1.0"),
+					ModuleVersion: to.StrPtr("v0.0.1"),
+				},
 				Params: &Params{
 					Name:                  to.StrPtr("epiphany"),
 					Region:                to.StrPtr("eu-central-1"),
@@ -445,8 +613,11 @@ func TestConfig_Load_general(t *testing.T) {
 		{
 			name: "major version mismatch",
 			json: []byte(`{
-	"kind": "awsbi",
-	"version": "v100.0.1",
+	"meta": {
+		"kind": "awsbiConfig",
+		"version": "v100.0.1",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"region": "eu-central-1",
@@ -469,20 +640,17 @@ func TestConfig_Load_general(t *testing.T) {
 	}
 }
 `),
-			want: nil,
-			wantErr: test.TestValidationErrors{
-				test.TestValidationError{
-					Key:   "Config.Version",
-					Field: "Version",
-					Tag:   "version",
-				},
-			},
+			want:    nil,
+			wantErr: shared.NotCurrentVersionError{Version: "v100.0.1"},
 		},
 		{
 			name: "minor version mismatch",
 			json: []byte(`{
-	"kind": "awsbi",
-	"version": "v0.100.1",
+	"meta": {
+		"kind": "awsbiConfig",
+		"version": "v0.100.1",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"region": "eu-central-1",
@@ -505,38 +673,17 @@ func TestConfig_Load_general(t *testing.T) {
 	}
 }
 `),
-			want: &Config{
-				Kind:    to.StrPtr(kind),
-				Version: to.StrPtr("v0.100.1"),
-				Params: &Params{
-					Name:                  to.StrPtr("epiphany"),
-					Region:                to.StrPtr("eu-central-1"),
-					NatGatewayCount:       to.IntPtr(0),
-					VirtualPrivateGateway: to.BoolPtr(false),
-					RsaPublicKeyPath:      to.StrPtr("/shared/vms_rsa.pub"),
-					VpcAddressSpace:       to.StrPtr("10.1.0.0/20"),
-					Subnets: &Subnets{
-						Private: []Subnet{},
-						Public: []Subnet{
-							{
-								Name:             to.StrPtr("first_public_subnet"),
-								AvailabilityZone: to.StrPtr("any"),
-								AddressPrefixes:  to.StrPtr("10.1.2.0/24"),
-							},
-						},
-					},
-					SecurityGroups: []SecurityGroup{},
-					VmGroups:       []VmGroup{},
-				},
-				Unused: []string{},
-			},
-			wantErr: nil,
+			want:    nil,
+			wantErr: shared.NotCurrentVersionError{Version: "v0.100.1"},
 		},
 		{
 			name: "patch version mismatch",
 			json: []byte(`{
-	"kind": "awsbi",
-	"version": "v0.0.100",
+	"meta": {
+		"kind": "awsbiConfig",
+		"version": "v0.0.100",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"region": "eu-central-1",
@@ -559,32 +706,8 @@ func TestConfig_Load_general(t *testing.T) {
 	}
 }
 `),
-			want: &Config{
-				Kind:    to.StrPtr(kind),
-				Version: to.StrPtr("v0.0.100"),
-				Params: &Params{
-					Name:                  to.StrPtr("epiphany"),
-					Region:                to.StrPtr("eu-central-1"),
-					NatGatewayCount:       to.IntPtr(0),
-					VirtualPrivateGateway: to.BoolPtr(false),
-					RsaPublicKeyPath:      to.StrPtr("/shared/vms_rsa.pub"),
-					VpcAddressSpace:       to.StrPtr("10.1.0.0/20"),
-					Subnets: &Subnets{
-						Private: []Subnet{},
-						Public: []Subnet{
-							{
-								Name:             to.StrPtr("first_public_subnet"),
-								AvailabilityZone: to.StrPtr("any"),
-								AddressPrefixes:  to.StrPtr("10.1.2.0/24"),
-							},
-						},
-					},
-					SecurityGroups: []SecurityGroup{},
-					VmGroups:       []VmGroup{},
-				},
-				Unused: []string{},
-			},
-			wantErr: nil,
+			want:    nil,
+			wantErr: shared.NotCurrentVersionError{Version: "v0.0.100"},
 		},
 	}
 
@@ -605,8 +728,11 @@ func TestConfig_Load_Params(t *testing.T) {
 		{
 			name: "just vm_groups in params",
 			json: []byte(`{
-	"kind": "awsbi",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "awsbiConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"vm_groups": [
 			{
@@ -678,8 +804,11 @@ func TestConfig_Load_Params(t *testing.T) {
 		{
 			name: "missing requested subnets list",
 			json: []byte(`{
-	"kind": "awsbi",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "awsbiConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"region": "eu-central-1",
@@ -765,8 +894,11 @@ func TestConfig_Load_Params(t *testing.T) {
 		{
 			name: "missing requested security group list",
 			json: []byte(`{
-	"kind": "awsbi",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "awsbiConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"region": "eu-central-1",
@@ -852,8 +984,11 @@ func TestConfig_Load_Params(t *testing.T) {
 		{
 			name: "empty subnets lists",
 			json: []byte(`{
-	"kind": "awsbi",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "awsbiConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"region": "eu-central-1",
@@ -930,8 +1065,11 @@ func TestConfig_Load_Params(t *testing.T) {
 		{
 			name: "empty subnets",
 			json: []byte(`{
-	"kind": "awsbi",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "awsbiConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"region": "eu-central-1",
@@ -1015,8 +1153,11 @@ func TestConfig_Load_Params(t *testing.T) {
 		{
 			name: "missing subnet params",
 			json: []byte(`{
-	"kind": "awsbi",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "awsbiConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"region": "eu-central-1",
@@ -1122,8 +1263,11 @@ func TestConfig_Load_Params(t *testing.T) {
 		{
 			name: "multiple subnets configuration",
 			json: []byte(`{
-	"kind": "awsbi",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "awsbiConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"region": "eu-central-1",
@@ -1217,8 +1361,11 @@ func TestConfig_Load_Params(t *testing.T) {
 }
 `),
 			want: &Config{
-				Kind:    to.StrPtr(kind),
-				Version: to.StrPtr(version),
+				Meta: &Meta{
+					Kind:          to.StrPtr("awsbiConfig"),
+					Version:       to.StrPtr("v0.1.0"),
+					ModuleVersion: to.StrPtr("v0.0.1"),
+				},
 				Params: &Params{
 					Name:                  to.StrPtr("epiphany"),
 					Region:                to.StrPtr("eu-central-1"),
@@ -1310,8 +1457,11 @@ func TestConfig_Load_Params(t *testing.T) {
 		{
 			name: "empty or incorrect params fields",
 			json: []byte(`{
-	"kind": "awsbi",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "awsbiConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "",
 		"region": "",
@@ -1439,8 +1589,11 @@ func TestConfig_Load_Params(t *testing.T) {
 		{
 			name: "empty address_space element or not cidr",
 			json: []byte(`{
-	"kind": "awsbi",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "awsbiConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"region": "eu-central-1",
@@ -1576,8 +1729,11 @@ func TestConfig_Load_VmGroups(t *testing.T) {
 		{
 			name: "empty fields",
 			json: []byte(`{
-	"kind": "awsbi",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "awsbiConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"region": "eu-central-1",
@@ -1661,8 +1817,11 @@ func TestConfig_Load_VmGroups(t *testing.T) {
 		{
 			name: "missing fields",
 			json: []byte(`{
-	"kind": "awsbi",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "awsbiConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"region": "eu-central-1",
@@ -1739,8 +1898,11 @@ func TestConfig_Load_VmGroups_VmImage_and_DataDisks(t *testing.T) {
 		{
 			name: "empty fields",
 			json: []byte(`{
-	"kind": "awsbi",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "awsbiConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"region": "eu-central-1",
@@ -1845,8 +2007,11 @@ func TestConfig_Load_VmGroups_VmImage_and_DataDisks(t *testing.T) {
 		{
 			name: "missing fields",
 			json: []byte(`{
-	"kind": "awsbi",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "awsbiConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"region": "eu-central-1",
@@ -1950,16 +2115,443 @@ func TestConfig_Load_VmGroups_VmImage_and_DataDisks(t *testing.T) {
 	}
 }
 
+func TestConfig_Save(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		want    []byte
+		wantErr error
+	}{
+		{
+			name:    "happy path",
+			config:  minimalConfig(),
+			want:    []byte(minimalConfigJson),
+			wantErr: nil,
+		},
+		{
+			name:   "invalid",
+			config: &Config{},
+			want:   nil,
+			wantErr: test.TestValidationErrors{
+				test.TestValidationError{
+					Key:   "Config.Meta",
+					Field: "Meta",
+					Tag:   "required",
+				},
+				test.TestValidationError{
+					Key:   "Config.Params",
+					Field: "Params",
+					Tag:   "required",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			r := require.New(t)
+			p, err := createTempDirectory("awsbi-config-save")
+			r.NoError(err)
+
+			err = tt.config.Save(filepath.Join(p, "file.json"))
+			if tt.wantErr != nil {
+				r.Error(err)
+				var errs validator.ValidationErrors
+				ok := errors.As(err, &errs)
+				r.True(ok)
+				a.Equal(len(tt.wantErr.(test.TestValidationErrors)), len(errs))
+				for _, e := range errs {
+					found := false
+					for _, we := range tt.wantErr.(test.TestValidationErrors) {
+						if we.Key == e.Namespace() && we.Tag == e.Tag() && we.Field == e.Field() {
+							found = true
+							break
+						}
+					}
+					if !found {
+						t.Errorf("Got unknown error:\n%s\nAll expected errors: \n%s", e.Error(), tt.wantErr.Error())
+					}
+				}
+			} else {
+				a.NoError(err)
+				got, err2 := ioutil.ReadFile(filepath.Join(p, "file.json"))
+				a.NoError(err2)
+				a.Equal(string(tt.want), string(got))
+			}
+		})
+	}
+}
+
+func TestConfig_Print(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name:    "happy path",
+			config:  minimalConfig(),
+			want:    []byte(minimalConfigJson),
+			wantErr: false,
+		},
+		{
+			name:    "invalid",
+			config:  &Config{},
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			got, err := tt.config.Print()
+			if tt.wantErr {
+				a.Error(err)
+			} else {
+				a.NoError(err)
+				a.Equal(string(tt.want), string(got))
+			}
+		})
+	}
+}
+
+func TestConfig_Lint(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   []string
+	}{
+		{
+			name:   "default config",
+			modify: func(c *Config) {},
+			want: []string{
+				"params.security_groups[0].rules.ingress[1].cidr_blocks[0] ssh-open-to-world",
+			},
+		},
+		{
+			name: "all protocols and ports from anywhere",
+			modify: func(c *Config) {
+				c.Params.SecurityGroups[0].Rules.Ingress[0].CidrBlocks = []string{"10.1.0.0/20", "::/0"}
+				c.Params.SecurityGroups[0].Rules.Ingress[1].CidrBlocks = []string{"10.1.0.0/20"}
+			},
+			want: []string{
+				"params.security_groups[0].rules.ingress[0].cidr_blocks[1] ssh-open-to-world",
+			},
+		},
+		{
+			name: "all protocols with ports set from anywhere",
+			modify: func(c *Config) {
+				c.Params.SecurityGroups[0].Rules.Ingress[0].FromPort = to.IntPtr(443)
+				c.Params.SecurityGroups[0].Rules.Ingress[0].ToPort = to.IntPtr(443)
+				c.Params.SecurityGroups[0].Rules.Ingress[0].CidrBlocks = []string{"0.0.0.0/0"}
+				c.Params.SecurityGroups[0].Rules.Ingress[1].CidrBlocks = []string{"10.1.0.0/20"}
+			},
+			want: []string{
+				"params.security_groups[0].rules.ingress[0].cidr_blocks[0] ssh-open-to-world",
+			},
+		},
+		{
+			name: "tcp by protocol number from anywhere",
+			modify: func(c *Config) {
+				c.Params.SecurityGroups[0].Rules.Ingress[1].Protocol = to.StrPtr("6")
+			},
+			want: []string{
+				"params.security_groups[0].rules.ingress[1].cidr_blocks[0] ssh-open-to-world",
+			},
+		},
+		{
+			name: "udp on ssh port from anywhere",
+			modify: func(c *Config) {
+				c.Params.SecurityGroups[0].Rules.Ingress[1].Protocol = to.StrPtr("17")
+			},
+			want: []string{},
+		},
+		{
+			name: "other ports from anywhere",
+			modify: func(c *Config) {
+				c.Params.SecurityGroups[0].Rules.Ingress[1].FromPort = to.IntPtr(443)
+				c.Params.SecurityGroups[0].Rules.Ingress[1].ToPort = to.IntPtr(443)
+			},
+			want: []string{},
+		},
+		{
+			name: "public ip on all vm groups and unused field",
+			modify: func(c *Config) {
+				c.Params.VmGroups[0].UsePublicIp = to.BoolPtr(true)
+				c.Unused = []string{"params.extra"}
+			},
+			want: []string{
+				"params.extra unused-field",
+				"params.vm_groups public-ip-on-all-vm-groups",
+				"params.security_groups[0].rules.ingress[1].cidr_blocks[0] ssh-open-to-world",
+			},
+		},
+		{
+			name: "suppressed",
+			modify: func(c *Config) {
+				c.Params.VmGroups[0].UsePublicIp = to.BoolPtr(true)
+				c.Meta.SuppressWarnings = []string{WarningSshOpenToWorld, WarningPublicIpOnAllVmGroups}
+			},
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			c := &Config{}
+			c.Init("v0.0.1")
+			c.Unused = []string{}
+			tt.modify(c)
+			a.NoError(c.Validate())
+			got := make([]string, 0)
+			for _, f := range c.Lint() {
+				a.Equal(shared.SeverityWarning, f.Severity)
+				got = append(got, f.Path+" "+f.Tag)
+			}
+			a.Equal(tt.want, got)
+		})
+	}
+}
+
+func TestConfig_Upgrade(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    []byte
+		want    *Config
+		wantErr error
+	}{
+		{
+			name:    "happy path nothing to upgrade",
+			json:    []byte(minimalConfigJson),
+			want:    minimalConfig(),
+			wantErr: nil,
+		},
+		{
+			name: "upgrade v0.0.1 to v0.1.0",
+			json: []byte(`{
+	"kind": "awsbi",
+	"version": "v0.0.1",
+	"params": {
+		"name": "epiphany",
+		"region": "eu-central-1",
+		"nat_gateway_count": 0,
+		"virtual_private_gateway": false,
+		"rsa_pub_path": "/shared/vms_rsa.pub",
+		"vpc_address_space": "10.1.0.0/20",
+		"subnets": {
+			"private": null,
+			"public": [
+				{
+					"name": "first_public_subnet",
+					"availability_zone": "any",
+					"address_prefixes": "10.1.2.0/24"
+				}
+			]
+		},
+		"security_groups": [],
+		"vm_groups": []
+	}
+}
+`),
+			want: func() *Config {
+				c := minimalConfig()
+				c.Meta.ModuleVersion = to.StrPtr("unknown")
+				return c
+			}(),
+			wantErr: nil,
+		},
+		{
+			name: "ensure that validation is also performed in upgrade",
+			json: []byte(`{
+	"kind": "awsbi",
+	"version": "v0.0.1",
+	"params": {
+		"name": "epiphany"
+	}
+}
+`),
+			want: nil,
+			wantErr: test.TestValidationErrors{
+				test.TestValidationError{
+					Key:   "Config.Params.Region",
+					Field: "Region",
+					Tag:   "required",
+				},
+				test.TestValidationError{
+					Key:   "Config.Params.NatGatewayCount",
+					Field: "NatGatewayCount",
+					Tag:   "required",
+				},
+				test.TestValidationError{
+					Key:   "Config.Params.VirtualPrivateGateway",
+					Field: "VirtualPrivateGateway",
+					Tag:   "required",
+				},
+				test.TestValidationError{
+					Key:   "Config.Params.RsaPublicKeyPath",
+					Field: "RsaPublicKeyPath",
+					Tag:   "required",
+				},
+				test.TestValidationError{
+					Key:   "Config.Params.VpcAddressSpace",
+					Field: "VpcAddressSpace",
+					Tag:   "required",
+				},
+				test.TestValidationError{
+					Key:   "Config.Params.Subnets",
+					Field: "Subnets",
+					Tag:   "required",
+				},
+				test.TestValidationError{
+					Key:   "Config.Params.SecurityGroups",
+					Field: "SecurityGroups",
+					Tag:   "required",
+				},
+				test.TestValidationError{
+					Key:   "Config.Params.VmGroups",
+					Field: "VmGroups",
+					Tag:   "required",
+				},
+			},
+		},
+		{
+			name: "some unknown version",
+			json: []byte(`{
+	"meta": {
+		"kind": "awsbiConfig",
+		"version": "v0.0.100",
+		"module_version": "v0.0.1"
+	},
+	"params": {
+		"name": "epiphany"
+	}
+}
+`),
+			want:    nil,
+			wantErr: errors.New("unknown version to upgrade"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			r := require.New(t)
+			p, err := createTempDocumentFile("awsbi-config-upgrade", tt.json)
+			r.NoError(err)
+			got := &Config{}
+			err = got.Upgrade(p)
+			if tt.wantErr != nil {
+				r.Error(err)
+				var errs validator.ValidationErrors
+				ok := errors.As(err, &errs)
+				if ok {
+					for _, e := range errs {
+						found := false
+						for _, we := range tt.wantErr.(test.TestValidationErrors) {
+							if we.Key == e.Namespace() && we.Tag == e.Tag() && we.Field == e.Field() {
+								found = true
+								break
+							}
+						}
+						if !found {
+							t.Errorf("Got unknown error:\n%s\nAll expected errors: \n%s", e.Error(), tt.wantErr.Error())
+						}
+					}
+					a.Equal(len(tt.wantErr.(test.TestValidationErrors)), len(errs))
+				} else {
+					a.Equal(tt.wantErr, err)
+				}
+			} else {
+				a.NoError(err)
+				wj, err2 := tt.want.Print()
+				a.NoError(err2)
+				gj, err2 := got.Print()
+				a.NoError(err2)
+				a.Equal(string(wj), string(gj))
+			}
+		})
+	}
+}
+
+const minimalConfigJson = `{
+	"meta": {
+		"kind": "awsbiConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
+	"params": {
+		"name": "epiphany",
+		"region": "eu-central-1",
+		"nat_gateway_count": 0,
+		"virtual_private_gateway": false,
+		"rsa_pub_path": "/shared/vms_rsa.pub",
+		"vpc_address_space": "10.1.0.0/20",
+		"subnets": {
+			"private": null,
+			"public": [
+				{
+					"name": "first_public_subnet",
+					"availability_zone": "any",
+					"address_prefixes": "10.1.2.0/24"
+				}
+			]
+		},
+		"security_groups": [],
+		"vm_groups": []
+	}
+}`
+
+func minimalConfig() *Config {
+	return &Config{
+		Meta: &Meta{
+			Kind:          to.StrPtr("awsbiConfig"),
+			Version:       to.StrPtr("v0.1.0"),
+			ModuleVersion: to.StrPtr("v0.0.1"),
+		},
+		Params: &Params{
+			Name:                  to.StrPtr("epiphany"),
+			Region:                to.StrPtr("eu-central-1"),
+			NatGatewayCount:       to.IntPtr(0),
+			VirtualPrivateGateway: to.BoolPtr(false),
+			RsaPublicKeyPath:      to.StrPtr("/shared/vms_rsa.pub"),
+			VpcAddressSpace:       to.StrPtr("10.1.0.0/20"),
+			Subnets: &Subnets{
+				Public: []Subnet{
+					{
+						Name:             to.StrPtr("first_public_subnet"),
+						AvailabilityZone: to.StrPtr("any"),
+						AddressPrefixes:  to.StrPtr("10.1.2.0/24"),
+					},
+				},
+			},
+			SecurityGroups: []SecurityGroup{},
+			VmGroups:       []VmGroup{},
+		},
+		Unused: []string{},
+	}
+}
+
 func configLoadTestingBody(t *testing.T, json []byte, want *Config, wantErr error) {
+	p, err := createTempDocumentFile("awsbi-config-load", json)
+	if err != nil {
+		t.Fatal(err)
+	}
 	got := &Config{}
-	err := got.Unmarshal(json)
+	err = got.Load(p)
 
 	if wantErr != nil {
 		if err != nil {
 			if _, ok := err.(*validator.InvalidValidationError); ok {
 				t.Fatal(err)
 			}
-			errs := err.(validator.ValidationErrors)
+			var errs validator.ValidationErrors
+			ok := errors.As(err, &errs)
+			if !ok {
+				if diff := cmp.Diff(wantErr, err); diff != "" {
+					t.Errorf("Load() error mismatch (-want +got):\n%s", diff)
+				}
+				return
+			}
 			if len(errs) != len(wantErr.(test.TestValidationErrors)) {
 				t.Fatalf("incorrect length of found errors. Got: \n%s\nExpected: \n%s", errs.Error(), wantErr.Error())
 			}
@@ -1980,10 +2572,52 @@ func configLoadTestingBody(t *testing.T, json []byte, want *Config, wantErr erro
 		}
 	} else {
 		if diff := cmp.Diff(want, got); diff != "" {
-			t.Errorf("Unmarshal() mismatch (-want +got):\n%s", diff)
+			t.Errorf("Load() mismatch (-want +got):\n%s", diff)
 		}
 		if err != nil {
-			t.Errorf("Unmarshal() unexpected error occured: %v", err)
+			t.Errorf("Load() unexpected error occured: %v", err)
 		}
 	}
 }
+
+func createTempDocumentFile(name string, document []byte) (string, error) {
+	p, err := ioutil.TempDir("", fmt.Sprintf("e-structures-%s-*", name))
+	if err != nil {
+		return "", err
+	}
+	err = ioutil.WriteFile(filepath.Join(p, "file.json"), document, 0644)
+	return filepath.Join(p, "file.json"), err
+}
+
+func createTempDirectory(name string) (string, error) {
+	return ioutil.TempDir("", fmt.Sprintf("e-structures-%s-*", name))
+}
+
+func TestConfig_SerialValidationError(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	c := &Config{}
+	c.Init("v0.0.1")
+	c.Meta.Serial = to.IntPtr(3)
+	c.Meta.Hash = to.StrPtr("abc")
+
+	err := c.Validate()
+	var verr *shared.ValidationError
+	r.True(errors.As(err, &verr))
+	a.Equal(shared.FieldErrors{
+		{
+			Path:     "meta.serial",
+			Severity: shared.SeverityError,
+			Tag:      "excluded",
+			Value:    3,
+			Message:  "must not be set",
+		},
+		{
+			Path:     "meta.hash",
+			Severity: shared.SeverityError,
+			Tag:      "excluded",
+			Value:    "abc",
+			Message:  "must not be set",
+		},
+	}, verr.Fields)
+}
@@ -0,0 +1,69 @@
+package v0
+
+import (
+	"fmt"
+	"github.com/epiphany-platform/e-structures/shared"
+	"strings"
+)
+
+const (
+	// WarningPublicIpOnAllVmGroups is reported when every VM group gets public IP, so there is no VM reachable
+	// only from inside of VPC.
+	WarningPublicIpOnAllVmGroups = "public-ip-on-all-vm-groups"
+	// WarningSshOpenToWorld is reported for ingress rules allowing SSH from any address.
+	WarningSshOpenToWorld = "ssh-open-to-world"
+)
+
+const sshPort = 22
+
+func (p *Params) lint() []shared.FieldError {
+	if p == nil {
+		return nil
+	}
+	var result []shared.FieldError
+	if len(p.VmGroups) > 0 {
+		public := true
+		for _, g := range p.VmGroups {
+			if g.UsePublicIp == nil || !*g.UsePublicIp {
+				public = false
+			}
+		}
+		if public {
+			result = append(result, shared.Warning(WarningPublicIpOnAllVmGroups, "params.vm_groups", nil,
+				"every VM group uses public IP, consider keeping some of them private"))
+		}
+	}
+	for i, sg := range p.SecurityGroups {
+		if sg.Rules == nil {
+			continue
+		}
+		for j, rule := range sg.Rules.Ingress {
+			if !rule.allowsSsh() {
+				continue
+			}
+			for k, cidr := range rule.CidrBlocks {
+				if cidr == "0.0.0.0/0" || cidr == "::/0" {
+					path := fmt.Sprintf("params.security_groups[%d].rules.ingress[%d].cidr_blocks[%d]", i, j, k)
+					result = append(result, shared.Warning(WarningSshOpenToWorld, path, cidr,
+						"SSH is open to the whole internet, consider limiting it to known addresses"))
+				}
+			}
+		}
+	}
+	return result
+}
+
+// allowsSsh checks if rule covers TCP port 22. Protocol may be given by name or by number (6 is TCP). Protocol -1
+// means all protocols and AWS ignores ports of such rules.
+func (r SecurityRule) allowsSsh() bool {
+	if r.Protocol == nil {
+		return false
+	}
+	switch strings.ToLower(*r.Protocol) {
+	case "-1", "all":
+		return true
+	case "tcp", "6":
+		return r.FromPort != nil && r.ToPort != nil && *r.FromPort <= sshPort && sshPort <= *r.ToPort
+	}
+	return false
+}
@@ -0,0 +1,388 @@
+package v0
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/epiphany-platform/e-structures/shared"
+	"github.com/epiphany-platform/e-structures/storage"
+	"github.com/epiphany-platform/e-structures/utils/test"
+	"github.com/epiphany-platform/e-structures/utils/to"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestState_Init(t *testing.T) {
+	tests := []struct {
+		name          string
+		moduleVersion string
+		want          *State
+	}{
+		{
+			name:          "happy path",
+			moduleVersion: "v1.1.1",
+			want: &State{
+				Meta: &Meta{
+					Kind:          to.StrPtr("awsbiState"),
+					Version:       to.StrPtr("v0.0.1"),
+					ModuleVersion: to.StrPtr("v1.1.1"),
+				},
+				Status: shared.Initialized,
+				Config: nil,
+				Output: nil,
+				Unused: []string{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			got := &State{}
+			got.Init(tt.moduleVersion)
+			a.Equal(tt.want, got)
+		})
+	}
+}
+
+func TestState_Backup(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   *State
+		wantErr error
+	}{
+		{
+			name:    "happy path",
+			state:   &State{},
+			wantErr: nil,
+		},
+		{
+			name:    "file already exists",
+			state:   &State{},
+			wantErr: os.ErrExist,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			p, err := createTempDirectory("awsbi-state-backup")
+			a.NoError(err)
+			if errors.Is(tt.wantErr, os.ErrExist) {
+				err = ioutil.WriteFile(filepath.Join(p, "backup-file.json"), []byte("content"), 0644)
+				a.NoError(err)
+			}
+			err = tt.state.Backup(filepath.Join(p, "backup-file.json"))
+			if tt.wantErr != nil {
+				a.Error(err)
+				a.Equal(tt.wantErr, err)
+			} else {
+				a.NoError(err)
+			}
+		})
+	}
+}
+
+func TestState_Load(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    []byte
+		want    *State
+		wantErr error
+	}{
+		{
+			name: "happy path",
+			json: []byte(`{
+	"meta": {
+		"kind": "awsbiState",
+		"version": "v0.0.1",
+		"module_version": "v0.0.1"
+	},
+	"status": "applied",
+	"config": {
+		"meta": {
+			"kind": "awsbiConfig",
+			"version": "v0.1.0",
+			"module_version": "v0.0.1"
+		},
+		"params": {
+			"name": "epiphany",
+			"region": "eu-central-1",
+			"nat_gateway_count": 0,
+			"virtual_private_gateway": false,
+			"rsa_pub_path": "/shared/vms_rsa.pub",
+			"vpc_address_space": "10.1.0.0/20",
+			"subnets": {
+				"public": [
+					{
+						"name": "first_public_subnet",
+						"availability_zone": "any",
+						"address_prefixes": "10.1.2.0/24"
+					}
+				]
+			},
+			"security_groups": [],
+			"vm_groups": []
+		}
+	},
+	"output": {
+		"vpc_id": "vpc-0123",
+		"private_subnet_ids": [],
+		"public_subnet_ids": ["subnet-0123"],
+		"private_route_table": "rtb-0123",
+		"vm_groups": [
+			{
+				"name": "vm-group0",
+				"vms": [
+					{
+						"name": "epiphany-vm-group0-0",
+						"public_ip": "3.123.10.10",
+						"private_ip": "10.1.2.10",
+						"data_disks": [
+							{
+								"size": 16,
+								"device_name": "/dev/sdf"
+							}
+						]
+					}
+				]
+			}
+		]
+	}
+}
+`),
+			want: &State{
+				Meta: &Meta{
+					Kind:          to.StrPtr("awsbiState"),
+					Version:       to.StrPtr("v0.0.1"),
+					ModuleVersion: to.StrPtr("v0.0.1"),
+				},
+				Status: shared.Applied,
+				Config: minimalConfig(),
+				Output: &Output{
+					VpcId:             to.StrPtr("vpc-0123"),
+					PrivateSubnetIds:  []string{},
+					PublicSubnetIds:   []string{"subnet-0123"},
+					PrivateRouteTable: to.StrPtr("rtb-0123"),
+					VmGroups: []OutputVmGroup{
+						{
+							Name: to.StrPtr("vm-group0"),
+							Vms: []OutputVm{
+								{
+									Name:      to.StrPtr("epiphany-vm-group0-0"),
+									PublicIp:  to.StrPtr("3.123.10.10"),
+									PrivateIp: to.StrPtr("10.1.2.10"),
+									DataDisks: []OutputDataDisk{
+										{
+											Size:       to.IntPtr(16),
+											DeviceName: to.StrPtr("/dev/sdf"),
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+				Unused: []string{},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "ensure load is performing validation",
+			json: []byte(`{
+	"meta": {
+		"kind": "awsbiState",
+		"version": "v0.0.1",
+		"module_version": "v0.0.1"
+	}
+}`),
+			want: nil,
+			wantErr: test.TestValidationErrors{
+				test.TestValidationError{
+					Key:   "State.Status",
+					Field: "Status",
+					Tag:   "required",
+				},
+			},
+		},
+		{
+			name: "not current version",
+			json: []byte(`{
+	"meta": {
+		"kind": "awsbiState",
+		"version": "v0.0.100",
+		"module_version": "v0.0.1"
+	},
+	"status": "initialized"
+}`),
+			want:    nil,
+			wantErr: shared.NotCurrentVersionError{Version: "v0.0.100"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			r := require.New(t)
+			p, err := createTempDocumentFile("awsbi-state-load", tt.json)
+			r.NoError(err)
+			got := &State{}
+			err = got.Load(p)
+			if tt.wantErr != nil {
+				r.Error(err)
+				var errs validator.ValidationErrors
+				ok := errors.As(err, &errs)
+				if ok {
+					for _, e := range errs {
+						found := false
+						for _, we := range tt.wantErr.(test.TestValidationErrors) {
+							if we.Key == e.Namespace() && we.Tag == e.Tag() && we.Field == e.Field() {
+								found = true
+								break
+							}
+						}
+						if !found {
+							t.Errorf("Got unknown error:\n%s\nAll expected errors: \n%s", e.Error(), tt.wantErr.Error())
+						}
+					}
+					a.Equal(len(tt.wantErr.(test.TestValidationErrors)), len(errs))
+				} else {
+					a.Equal(tt.wantErr, err)
+				}
+			} else {
+				a.NoError(err)
+				wj, err2 := tt.want.Print()
+				a.NoError(err2)
+				gj, err2 := got.Print()
+				a.NoError(err2)
+				a.Equal(string(wj), string(gj))
+			}
+		})
+	}
+}
+
+func TestState_Print(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   *State
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name: "happy path",
+			state: &State{
+				Meta: &Meta{
+					Kind:          to.StrPtr("awsbiState"),
+					Version:       to.StrPtr("v0.0.1"),
+					ModuleVersion: to.StrPtr("v0.0.1"),
+				},
+				Status: shared.Initialized,
+				Unused: []string{},
+			},
+			want: []byte(`{
+	"meta": {
+		"kind": "awsbiState",
+		"version": "v0.0.1",
+		"module_version": "v0.0.1"
+	},
+	"status": "initialized",
+	"config": null,
+	"output": null
+}`),
+			wantErr: false,
+		},
+		{
+			name:    "invalid",
+			state:   &State{},
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			got, err := tt.state.Print()
+			if tt.wantErr {
+				a.Error(err)
+			} else {
+				a.NoError(err)
+				a.Equal(string(tt.want), string(got))
+			}
+		})
+	}
+}
+
+func TestState_Upgrade(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    []byte
+		wantErr error
+	}{
+		{
+			name: "happy path nothing to upgrade",
+			json: []byte(`{
+	"meta": {
+		"kind": "awsbiState",
+		"version": "v0.0.1",
+		"module_version": "v0.0.1"
+	},
+	"status": "initialized"
+}`),
+			wantErr: nil,
+		},
+		{
+			name: "some unknown version",
+			json: []byte(`{
+	"meta": {
+		"kind": "awsbiState",
+		"version": "v0.0.100",
+		"module_version": "v0.0.1"
+	},
+	"status": "initialized"
+}`),
+			wantErr: errors.New("unknown version to upgrade"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			r := require.New(t)
+			p, err := createTempDocumentFile("awsbi-state-upgrade", tt.json)
+			r.NoError(err)
+			got := &State{}
+			err = got.Upgrade(p)
+			if tt.wantErr != nil {
+				a.Equal(tt.wantErr, err)
+			} else {
+				a.NoError(err)
+			}
+		})
+	}
+}
+
+func TestState_SaveConflict(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	st := storage.NewMemory()
+	state := &State{}
+	state.Init("v0.0.1")
+	r.NoError(state.SaveTo(st, "state.json"))
+	serial, hash := state.GetSerial()
+	a.Equal(1, serial)
+	a.NotEmpty(hash)
+
+	other := &State{}
+	r.NoError(other.LoadFrom(st, "state.json"))
+	a.Equal(state.Meta.Hash, other.Meta.Hash)
+
+	state.Status = shared.Applied
+	r.NoError(state.SaveTo(st, "state.json"))
+	serial, _ = state.GetSerial()
+	a.Equal(2, serial)
+
+	err := other.SaveTo(st, "state.json")
+	a.Equal(shared.ConflictError{Path: "state.json", Expected: 1, Found: 2}, err)
+	serial, _ = other.GetSerial()
+	a.Equal(1, serial)
+}
@@ -0,0 +1,137 @@
+package v0
+
+import (
+	"fmt"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func AwsBIParamsValidation(sl validator.StructLevel) {
+	params := sl.Current().Interface().(Params)
+	if len(params.VmGroups) > 0 {
+		for i, vmGroup := range params.VmGroups {
+			for j, sn := range vmGroup.SubnetNames {
+				if sn == "" {
+					sl.ReportError(
+						params.VmGroups[i].SubnetNames[j],
+						fmt.Sprintf("VmGroups[%d].SubnetNames[%d]", i, j),
+						fmt.Sprintf("SubnetNames[%d]", j),
+						"required",
+						"")
+					continue
+				}
+				found := false
+				if params.Subnets != nil {
+					for _, s := range params.Subnets.Private {
+						if s.Name != nil && sn == *s.Name {
+							found = true
+						}
+					}
+					for _, s := range params.Subnets.Public {
+						if s.Name != nil && sn == *s.Name {
+							found = true
+						}
+					}
+				}
+				if !found {
+					sl.ReportError(
+						params.VmGroups[i].SubnetNames[j],
+						fmt.Sprintf("VmGroups[%d].SubnetNames[%d]", i, j),
+						fmt.Sprintf("SubnetNames[%d]", j),
+						"insubnets",
+						"")
+				}
+			}
+			for j, sg := range vmGroup.SecurityGroupNames {
+				if sg == "" {
+					sl.ReportError(
+						params.VmGroups[i].SecurityGroupNames[j],
+						fmt.Sprintf("VmGroups[%d].SecurityGroupNames[%d]", i, j),
+						fmt.Sprintf("SecurityGroupNames[%d]", j),
+						"required",
+						"")
+					continue
+				}
+				found := false
+				if params.SecurityGroups != nil {
+					for _, s := range params.SecurityGroups {
+						if s.Name != nil && sg == *s.Name {
+							found = true
+						}
+					}
+				}
+				if !found {
+					sl.ReportError(
+						params.VmGroups[i].SecurityGroupNames[j],
+						fmt.Sprintf("VmGroups[%d].SecurityGroupNames[%d]", i, j),
+						fmt.Sprintf("SecurityGroupNames[%d]", j),
+						"insecuritygroups",
+						"")
+				}
+			}
+		}
+	}
+	if params.Subnets != nil {
+		if len(params.Subnets.Private) == 0 && len(params.Subnets.Public) == 0 {
+			sl.ReportError(
+				params.Subnets,
+				"Subnets",
+				"Subnets",
+				"private_or_public",
+				"")
+		}
+		if len(params.Subnets.Private) > 0 {
+			for i, s := range params.Subnets.Private {
+				validate := validator.New()
+				err := validate.Struct(s)
+				if err != nil {
+					if e, ok := err.(validator.ValidationErrors); ok {
+						namespace := fmt.Sprintf("Subnets.Private[%d].", i)
+						sl.ReportValidationErrors(namespace, namespace, e)
+					} else {
+						sl.ReportError(
+							params.Subnets,
+							"Subnets.Private",
+							"Private",
+							"fatal",
+							"")
+					}
+				}
+			}
+		}
+		if len(params.Subnets.Public) > 0 {
+			for i, s := range params.Subnets.Public {
+				validate := validator.New()
+				err := validate.Struct(s)
+				if err != nil {
+					if e, ok := err.(validator.ValidationErrors); ok {
+						namespace := fmt.Sprintf("Subnets.Public[%d].", i)
+						sl.ReportValidationErrors(namespace, namespace, e)
+					} else {
+						sl.ReportError(
+							params.Subnets,
+							"Subnets.Public",
+							"Public",
+							"fatal",
+							"")
+					}
+				}
+			}
+		}
+	}
+}
+
+// AwsBIConfigMetaValidation checks that config doesn't carry serial and hash. They are kept only in state
+// (see State.Save) and wouldn't be checked or updated when set in config file.
+func AwsBIConfigMetaValidation(sl validator.StructLevel) {
+	config := sl.Current().Interface().(Config)
+	if config.Meta == nil {
+		return
+	}
+	if config.Meta.Serial != nil {
+		sl.ReportError(*config.Meta.Serial, "Meta.Serial", "Serial", "excluded", "")
+	}
+	if config.Meta.Hash != nil {
+		sl.ReportError(*config.Meta.Hash, "Meta.Hash", "Hash", "excluded", "")
+	}
+}
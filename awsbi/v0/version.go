@@ -0,0 +1,8 @@
+package v0
+
+const (
+	configKind    = "awsbiConfig"
+	stateKind     = "awsbiState"
+	configVersion = "v0.1.0"
+	stateVersion  = "v0.0.1"
+)
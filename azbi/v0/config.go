@@ -3,15 +3,17 @@ package v0
 import (
 	"errors"
 	"github.com/epiphany-platform/e-structures/shared"
+	"github.com/epiphany-platform/e-structures/storage"
 	"github.com/epiphany-platform/e-structures/utils/to"
 	"github.com/epiphany-platform/e-structures/utils/validators"
 	"github.com/go-playground/validator/v10"
 )
 
 type Config struct {
-	Meta   *Meta    `json:"meta" validate:"required"`
-	Params *Params  `json:"params" validate:"required"`
-	Unused []string `json:"-"`
+	Meta    *Meta                  `json:"meta" validate:"required"`
+	Params  *Params                `json:"params" validate:"required"`
+	Unused  []string               `json:"-"`
+	Unknown map[string]interface{} `json:"-"`
 }
 
 func (c *Config) Init(moduleVersion string) {
@@ -60,33 +62,50 @@ func (c *Config) Init(moduleVersion string) {
 	// TODO consider if we should call Validate() here
 }
 
-func (c *Config) Backup(path string) error {
-	return shared.Backup(c, path)
+func (c *Config) Backup(path string, options ...shared.EncodeOption) error {
+	return shared.Backup(c, path, options...)
 }
 
-func (c *Config) Load(path string) error {
-	i, err := shared.Load(c, path, configVersion)
-	if err != nil {
-		return err
-	}
-	config, ok := i.(*Config)
-	if !ok {
-		return errors.New("incorrect casting")
-	}
-	err = config.Validate() // TODO rethink if validation should be done here
-	if err != nil {
-		return err
-	}
-	*c = *config
-	return nil
+func (c *Config) BackupRaw(path, new string) error {
+	_, err := shared.BackupRaw(path, new)
+	return err
+}
+
+func (c *Config) BackupTo(st storage.Storage, name string, options ...shared.EncodeOption) error {
+	return shared.BackupTo(c, st, name, options...)
+}
+
+func (c *Config) BackupRawTo(st storage.Storage, name, new string) error {
+	_, err := shared.BackupRawTo(st, name, st, new)
+	return err
+}
+
+func (c *Config) Load(path string, options ...shared.DecodeOption) error {
+	return shared.Load(c, path, configVersion, options...)
 }
 
-func (c *Config) Save(path string) error {
-	return shared.Save(c, path)
+func (c *Config) LoadFrom(st storage.Storage, name string, options ...shared.DecodeOption) error {
+	return shared.LoadFrom(c, st, name, configVersion, options...)
 }
 
-func (c *Config) Print() ([]byte, error) {
-	return shared.Print(c)
+func (c *Config) Save(path string, options ...shared.EncodeOption) error {
+	return shared.Save(c, path, options...)
+}
+
+func (c *Config) SaveTo(st storage.Storage, name string, options ...shared.EncodeOption) error {
+	return shared.SaveTo(c, st, name, options...)
+}
+
+func (c *Config) Print(options ...shared.EncodeOption) ([]byte, error) {
+	return shared.Print(c, options...)
+}
+
+func (c *Config) PrintYAML(options ...shared.EncodeOption) ([]byte, error) {
+	return shared.PrintYAML(c, options...)
+}
+
+func (c *Config) PrintRedacted(options shared.RedactOptions) ([]byte, error) {
+	return shared.PrintRedacted(c, options)
 }
 
 func (c *Config) Validate() error {
@@ -100,87 +119,84 @@ func (c *Config) Validate() error {
 		return err
 	}
 	validate.RegisterStructValidation(AzBISubnetsValidation, Params{})
+	validate.RegisterStructValidation(AzBIConfigMetaValidation, Config{})
 	err = validate.Struct(c)
 	if err != nil {
 		if _, ok := err.(*validator.InvalidValidationError); ok {
 			return err
 		}
-		return err
+		return shared.NewValidationError(c, err)
 	}
 	return nil
 }
 
-func (c *Config) Upgrade(path string) error {
-	i, err := shared.Upgrade(c, path)
-	if err != nil {
-		return err
-	}
-	config, ok := i.(*Config)
-	if !ok {
-		return errors.New("incorrect casting")
-	}
-	err = config.Validate() // TODO rethink if validation should be done here
-	if err != nil {
-		return err
+func (c *Config) Lint() shared.FieldErrors {
+	if c == nil {
+		return nil
 	}
-	*c = *config
-	return nil
+	return shared.Lint(c, c.Unused, c.Meta.suppressed(), c.Params.lint()...)
+}
+
+func (c *Config) Upgrade(path string, options ...shared.DecodeOption) error {
+	return shared.Upgrade(c, path, options...)
+}
+
+func (c *Config) UpgradeFrom(st storage.Storage, name string, options ...shared.DecodeOption) error {
+	return shared.UpgradeFrom(c, st, name, options...)
 }
 
 func (c *Config) UpgradeFunc(input map[string]interface{}) error {
-	upgraded := false
-	for !upgraded {
-		v, err := shared.GetVersion(input)
-		if err != nil {
-			return err
-		}
-		switch v {
-		case "v0.2.0":
-			meta, ok := input["meta"].(map[string]interface{})
-			if !ok {
-				return errors.New("incorrect casting")
-			}
-			meta["version"] = "v0.2.1"
-			input["meta"] = meta
+	_, err := configMigrations.Migrate(input)
+	return err
+}
 
-			params, ok := input["params"].(map[string]interface{})
-			if !ok {
-				return errors.New("incorrect casting")
-			}
-			params["admin_username"] = "operations"
-			input["params"] = params
-		default:
-			v, err2 := shared.GetVersion(input)
-			if err2 != nil {
-				return err2
-			}
-			if v != configVersion {
-				return errors.New("unknown version to upgrade")
-			}
-			upgraded = true
-		}
-	}
-	return nil
+func (c *Config) Downgrade(path, backup, targetVersion string, force bool) error {
+	_, err := shared.Downgrade(configMigrations, path, backup, targetVersion, force)
+	return err
+}
+
+func (c *Config) DowngradeFrom(st storage.Storage, name, backup, targetVersion string, force bool) error {
+	_, err := shared.DowngradeFrom(configMigrations, st, name, backup, targetVersion, force)
+	return err
 }
 
 func (c *Config) SetUnused(unused []string) {
 	c.Unused = unused
 }
 
+func (c *Config) SetUnknown(unknown map[string]interface{}) {
+	c.Unknown = unknown
+}
+
+func (c *Config) GetUnknown() map[string]interface{} {
+	return c.Unknown
+}
+
 type Meta struct {
 	Kind          *string `json:"kind" validate:"required,eq=azbiConfig|eq=azbiState"`
 	Version       *string `json:"version" validate:"required,version=~0"`
 	ModuleVersion *string `json:"module_version" validate:"required"`
+	Serial        *int    `json:"serial,omitempty" validate:"omitempty,min=0"`
+	Hash          *string `json:"hash,omitempty"`
+	// SuppressWarnings lists codes of lint findings which shouldn't be reported for document.
+	SuppressWarnings []string `json:"suppress_warnings,omitempty" validate:"omitempty,dive,min=1"`
+}
+
+func (m *Meta) suppressed() []string {
+	if m == nil {
+		return nil
+	}
+	return m.SuppressWarnings
 }
 
 type Params struct {
 	Name             *string   `json:"name" validate:"required,min=1"`
 	Location         *string   `json:"location" validate:"required,min=1"`
 	AddressSpace     []string  `json:"address_space" validate:"omitempty,min=1,dive,min=1,cidr"`
-	Subnets          []Subnet  `json:"subnets" validate:"required_with=AddressSpace,excluded_without=AddressSpace,omitempty,min=1,dive,required"` // TODO custom validator that subnets are in AddressSpaces
+	Subnets          []Subnet  `json:"subnets" validate:"required_with=AddressSpace,excluded_without=AddressSpace,omitempty,min=1,dive,required"`
 	VmGroups         []VmGroup `json:"vm_groups" validate:"required,dive"`
 	AdminUsername    *string   `json:"admin_username" validate:"required,min=1"`
-	RsaPublicKeyPath *string   `json:"rsa_pub_path" validate:"required,min=1"`
+	RsaPublicKeyPath *string   `json:"rsa_pub_path" validate:"required,min=1" redact:"identifier"`
 }
 
 // ExtractEmptySubnets extracts list of Subnet unassigned to any of VmGroup
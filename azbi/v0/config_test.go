@@ -1,6 +1,7 @@
 package v0
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/epiphany-platform/e-structures/shared"
@@ -12,6 +13,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"testing"
 )
 
@@ -115,6 +117,59 @@ func TestConfig_Backup(t *testing.T) {
 	}
 }
 
+func TestConfig_BackupRaw(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    []byte
+		wantErr error
+	}{
+		{
+			name: "happy path old version is copied untouched",
+			json: []byte(`{
+	"meta": {
+		"kind": "azbiConfig",
+		"version": "v0.2.0",
+		"module_version": "v0.0.1"
+	},
+	"params": {
+		"location": "northeurope",
+		"name": "epiphany"
+	}
+}
+`),
+			wantErr: nil,
+		},
+		{
+			name:    "file already exists",
+			json:    []byte(`{}`),
+			wantErr: os.ErrExist,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			r := require.New(t)
+			p, err := createTempDocumentFile("azbi-config-backup-raw", tt.json)
+			r.NoError(err)
+			n := filepath.Join(filepath.Dir(p), "backup-file.json")
+			if errors.Is(tt.wantErr, os.ErrExist) {
+				err = ioutil.WriteFile(n, []byte("content"), 0644)
+				r.NoError(err)
+			}
+			err = (&Config{}).BackupRaw(p, n)
+			if tt.wantErr != nil {
+				a.Equal(tt.wantErr, err)
+			} else {
+				a.NoError(err)
+				b, err := ioutil.ReadFile(n)
+				r.NoError(err)
+				a.Equal(string(tt.json), string(b))
+				a.FileExists(n + shared.ChecksumFileSuffix)
+			}
+		})
+	}
+}
+
 func TestConfig_Load(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -299,6 +354,10 @@ func TestConfig_Load(t *testing.T) {
 					RsaPublicKeyPath: to.StrPtr("/shared/vms_rsa.pub"),
 				},
 				Unused: []string{"params.extra_inner_field", "extra_outer_field"},
+				Unknown: map[string]interface{}{
+					"params.extra_inner_field": "extra_inner_value",
+					"extra_outer_field":        "extra_outer_value",
+				},
 			},
 			wantErr: nil,
 		},
@@ -1090,7 +1149,8 @@ func TestConfig_Load(t *testing.T) {
 				r.Error(err)
 				_, ok := err.(*validator.InvalidValidationError)
 				r.Equal(false, ok)
-				errs, ok := err.(validator.ValidationErrors)
+				var errs validator.ValidationErrors
+				ok = errors.As(err, &errs)
 				if ok {
 					for _, e := range errs {
 						found := false
@@ -1120,6 +1180,265 @@ func TestConfig_Load(t *testing.T) {
 	}
 }
 
+func TestConfig_LoadStrict(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	d, err := createTempDirectory("azbi-config-load-strict")
+	r.NoError(err)
+	p := filepath.Join(d, "config.yaml")
+	r.NoError(ioutil.WriteFile(p, []byte(`meta:
+  kind: azbiConfig
+  version: v0.2.1
+  module_version: v0.0.1
+  colour: blue
+params:
+  location: northeurope
+  name: epiphany
+  address_space:
+    - 10.0.0.0/16
+  subnets:
+    - name: main
+      address_prefixes:
+        - 10.0.1.0/24
+  vm_groups:
+    - name: vm-group0
+      vm_cuont: 3
+      vm_size: Standard_DS2_v2
+      use_public_ip: true
+      subnet_names:
+        - main
+      vm_image:
+        publisher: Canonical
+        offer: UbuntuServer
+        sku: 18.04-LTS
+        version: "18.04.202006101"
+      data_disks: []
+  admin_username: operations
+  rsa_pub_path: /shared/vms_rsa.pub
+`), 0644))
+
+	// unknown fields are collected but not reported by default
+	got := &Config{}
+	err = got.Load(p)
+	var verr *shared.ValidationError
+	r.True(errors.As(err, &verr))
+	a.Equal("params.vm_groups[0].vm_count: is required", verr.Fields[0].Error())
+
+	err = got.Load(p, shared.Strict())
+	r.True(errors.As(err, &verr))
+	messages := make([]string, 0)
+	for _, f := range verr.Fields {
+		messages = append(messages, f.Error())
+	}
+	a.ElementsMatch([]string{
+		"meta.colour: is not known field",
+		"params.vm_groups[0].vm_cuont: is not known field, did you mean vm_count?",
+		"params.vm_groups[0].vm_count: is required",
+	}, messages)
+	a.Nil(got.Meta)
+}
+
+func TestConfig_SaveUnknown(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	d, err := createTempDirectory("azbi-config-save-unknown")
+	r.NoError(err)
+	p := filepath.Join(d, "config.json")
+	r.NoError(ioutil.WriteFile(p, []byte(`{
+	"meta": {
+		"kind": "azbiConfig",
+		"version": "v0.2.1",
+		"module_version": "v0.0.1"
+	},
+	"params": {
+		"name": "epiphany",
+		"location": "northeurope",
+		"address_space": ["10.0.0.0/16"],
+		"subnets": [{"name": "main", "address_prefixes": ["10.0.1.0/24"]}],
+		"vm_groups": [{
+			"name": "vm-group0",
+			"vm_count": 3,
+			"vm_size": "Standard_DS2_v2",
+			"use_public_ip": true,
+			"subnet_names": ["main"],
+			"vm_image": {
+				"publisher": "Canonical",
+				"offer": "UbuntuServer",
+				"sku": "18.04-LTS",
+				"version": "18.04.202006101"
+			},
+			"data_disks": [],
+			"availability_zones": [1, 2]
+		}],
+		"admin_username": "operations",
+		"rsa_pub_path": "/shared/vms_rsa.pub",
+		"tags": {"owner": "team-a"}
+	},
+	"written_by": "v2.0.0"
+}`), 0644))
+
+	got := &Config{}
+	r.NoError(got.Load(p))
+	a.Equal(map[string]interface{}{
+		"params.vm_groups[name=vm-group0].availability_zones": []interface{}{float64(1), float64(2)},
+		"params.tags": map[string]interface{}{"owner": "team-a"},
+		"written_by":  "v2.0.0",
+	}, got.Unknown)
+
+	// values are changed by this version of module and saved with unknown fields kept in place, even if list items
+	// they belong to moved
+	got.Params.Name = to.StrPtr("renamed")
+	added := got.Params.VmGroups[0]
+	added.Name = to.StrPtr("vm-group1")
+	got.Params.VmGroups = append([]VmGroup{added}, got.Params.VmGroups...)
+	r.NoError(got.Save(p))
+	saved, err := ioutil.ReadFile(p)
+	r.NoError(err)
+	a.Contains(string(saved), `"data_disks": [],
+				"availability_zones": [
+					1,
+					2
+				]
+			}`)
+	a.Contains(string(saved), `"rsa_pub_path": "/shared/vms_rsa.pub",
+		"tags": {
+			"owner": "team-a"
+		}
+	},
+	"written_by": "v2.0.0"
+}`)
+
+	again := &Config{}
+	r.NoError(again.Load(p))
+	a.Equal("renamed", *again.Params.Name)
+	a.Equal("vm-group1", *again.Params.VmGroups[0].Name)
+	a.Equal(got.Unknown, again.Unknown)
+	a.ElementsMatch([]string{"params.vm_groups[1].availability_zones", "params.tags", "written_by"}, again.Unused)
+
+	// redacted form keeps unknown fields in place too, but nothing is known about them so their values are masked
+	redacted, err := again.PrintRedacted(shared.RedactOptions{})
+	r.NoError(err)
+	a.Contains(string(redacted), `"data_disks": [],
+				"availability_zones": [
+					"REDACTED",
+					"REDACTED"
+				]
+			}`)
+	a.Contains(string(redacted), `"rsa_pub_path": "/shared/vms_rsa.pub",
+		"tags": {
+			"owner": "REDACTED"
+		}
+	},
+	"written_by": "REDACTED"
+}`)
+	a.Equal("v2.0.0", again.Unknown["written_by"])
+}
+
+func TestConfig_LoadYAML(t *testing.T) {
+	tests := []struct {
+		name       string
+		fileName   string
+		yaml       []byte
+		wantUnused []string
+		wantErr    error
+	}{
+		{
+			name:     "yaml with extra fields",
+			fileName: "config.yaml",
+			yaml: []byte(`# azbi config
+extra_outer_field: extra-outer-value
+meta:
+  kind: azbiConfig
+  version: v0.2.1
+  module_version: v0.0.1
+params:
+  extra_inner_field: extra-inner-value
+  location: northeurope
+  name: epiphany
+  address_space:
+    - 10.0.0.0/16
+  subnets:
+    - name: main
+      address_prefixes:
+        - 10.0.1.0/24
+  vm_groups:
+    - name: vm-group0
+      vm_count: 3 # three machines
+      vm_size: Standard_DS2_v2
+      use_public_ip: true
+      subnet_names:
+        - main
+      vm_image:
+        publisher: Canonical
+        offer: UbuntuServer
+        sku: 18.04-LTS
+        version: "18.04.202006101"
+      data_disks:
+        - disk_size_gb: 10
+          storage_type: Premium_LRS
+  admin_username: operations
+  rsa_pub_path: /shared/vms_rsa.pub
+`),
+			wantUnused: []string{"params.extra_inner_field", "extra_outer_field"},
+			wantErr:    nil,
+		},
+		{
+			name:     "yaml detected by content",
+			fileName: "config.json",
+			yaml: []byte(`meta:
+  kind: azbiConfig
+  version: v0.2.1
+  module_version: v0.0.1
+`),
+			wantErr: test.TestValidationErrors{
+				test.TestValidationError{
+					Key:   "Config.Params",
+					Field: "Params",
+					Tag:   "required",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			r := require.New(t)
+			d, err := createTempDirectory("azbi-config-load-yaml")
+			r.NoError(err)
+			p := filepath.Join(d, tt.fileName)
+			r.NoError(ioutil.WriteFile(p, tt.yaml, 0644))
+			got := &Config{}
+			err = got.Load(p)
+			if tt.wantErr != nil {
+				r.Error(err)
+				_, ok := err.(*validator.InvalidValidationError)
+				r.Equal(false, ok)
+				var errs validator.ValidationErrors
+				ok = errors.As(err, &errs)
+				r.Equal(true, ok)
+				a.Equal(len(tt.wantErr.(test.TestValidationErrors)), len(errs))
+				return
+			}
+			r.NoError(err)
+			a.Equal(tt.wantUnused, got.Unused)
+			a.Equal(3, *got.Params.VmGroups[0].VmCount)
+			a.Equal("18.04.202006101", *got.Params.VmGroups[0].VmImage.Version)
+
+			// saved as yaml and loaded back
+			r.NoError(got.Save(filepath.Join(d, "saved.yml")))
+			saved, err := ioutil.ReadFile(filepath.Join(d, "saved.yml"))
+			r.NoError(err)
+			printed, err := got.PrintYAML()
+			r.NoError(err)
+			a.Equal(string(printed), string(saved))
+			again := &Config{}
+			r.NoError(again.Load(filepath.Join(d, "saved.yml")))
+			// unknown fields are saved back, so they are reported again
+			a.Equal(got, again)
+		})
+	}
+}
+
 func TestConfig_Save(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -1221,7 +1540,8 @@ func TestConfig_Save(t *testing.T) {
 				a.Error(err)
 				_, ok := err.(*validator.InvalidValidationError)
 				r.Equal(false, ok)
-				errs, ok := err.(validator.ValidationErrors)
+				var errs validator.ValidationErrors
+				ok = errors.As(err, &errs)
 				if ok {
 					for _, e := range errs {
 						found := false
@@ -2583,6 +2903,289 @@ func TestConfig_Valid(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "subnet outside of address space",
+			config: &Config{
+				Meta: &Meta{
+					Kind:          to.StrPtr("azbiConfig"),
+					Version:       to.StrPtr("v0.2.1"),
+					ModuleVersion: to.StrPtr("v0.0.1"),
+				},
+				Params: &Params{
+					Location:         to.StrPtr("northeurope"),
+					Name:             to.StrPtr("epiphany"),
+					AdminUsername:    to.StrPtr("operations"),
+					RsaPublicKeyPath: to.StrPtr("some-file-name"),
+					AddressSpace:     []string{"10.0.0.0/16", "10.2.0.0/16"},
+					Subnets: []Subnet{
+						{
+							Name:            to.StrPtr("main"),
+							AddressPrefixes: []string{"10.0.1.0/24", "10.1.1.0/24"},
+						},
+						{
+							Name:            to.StrPtr("second"),
+							AddressPrefixes: []string{"10.2.1.0/24"},
+						},
+					},
+					VmGroups: []VmGroup{
+						{
+							Name:        to.StrPtr("vm-group0"),
+							VmCount:     to.IntPtr(1),
+							VmSize:      to.StrPtr("Standard_DS2_v2"),
+							UsePublicIP: to.BoolPtr(false),
+							SubnetNames: []string{"main"},
+							VmImage: &VmImage{
+								Publisher: to.StrPtr("Canonical"),
+								Offer:     to.StrPtr("UbuntuServer"),
+								Sku:       to.StrPtr("18.04-LTS"),
+								Version:   to.StrPtr("18.04.202006101"),
+							},
+							DataDisks: []DataDisk{},
+						},
+					},
+				},
+				Unused: []string{},
+			},
+			wantErr: test.TestValidationErrors{
+				test.TestValidationError{
+					Key:   "Config.Params.Subnets[0].AddressPrefixes[1]",
+					Field: "Subnets[0].AddressPrefixes[1]",
+					Tag:   "inaddressspace",
+				},
+			},
+		},
+		{
+			name: "subnet bigger than address space",
+			config: &Config{
+				Meta: &Meta{
+					Kind:          to.StrPtr("azbiConfig"),
+					Version:       to.StrPtr("v0.2.1"),
+					ModuleVersion: to.StrPtr("v0.0.1"),
+				},
+				Params: &Params{
+					Location:         to.StrPtr("northeurope"),
+					Name:             to.StrPtr("epiphany"),
+					AdminUsername:    to.StrPtr("operations"),
+					RsaPublicKeyPath: to.StrPtr("some-file-name"),
+					AddressSpace:     []string{"10.0.0.0/24"},
+					Subnets: []Subnet{
+						{
+							Name:            to.StrPtr("main"),
+							AddressPrefixes: []string{"10.0.0.0/16"},
+						},
+					},
+					VmGroups: []VmGroup{
+						{
+							Name:        to.StrPtr("vm-group0"),
+							VmCount:     to.IntPtr(1),
+							VmSize:      to.StrPtr("Standard_DS2_v2"),
+							UsePublicIP: to.BoolPtr(false),
+							SubnetNames: []string{"main"},
+							VmImage: &VmImage{
+								Publisher: to.StrPtr("Canonical"),
+								Offer:     to.StrPtr("UbuntuServer"),
+								Sku:       to.StrPtr("18.04-LTS"),
+								Version:   to.StrPtr("18.04.202006101"),
+							},
+							DataDisks: []DataDisk{},
+						},
+					},
+				},
+				Unused: []string{},
+			},
+			wantErr: test.TestValidationErrors{
+				test.TestValidationError{
+					Key:   "Config.Params.Subnets[0].AddressPrefixes[0]",
+					Field: "Subnets[0].AddressPrefixes[0]",
+					Tag:   "inaddressspace",
+				},
+			},
+		},
+		{
+			name: "overlapping subnets",
+			config: &Config{
+				Meta: &Meta{
+					Kind:          to.StrPtr("azbiConfig"),
+					Version:       to.StrPtr("v0.2.1"),
+					ModuleVersion: to.StrPtr("v0.0.1"),
+				},
+				Params: &Params{
+					Location:         to.StrPtr("northeurope"),
+					Name:             to.StrPtr("epiphany"),
+					AdminUsername:    to.StrPtr("operations"),
+					RsaPublicKeyPath: to.StrPtr("some-file-name"),
+					AddressSpace:     []string{"10.0.0.0/16"},
+					Subnets: []Subnet{
+						{
+							Name:            to.StrPtr("main"),
+							AddressPrefixes: []string{"10.0.1.0/24"},
+						},
+						{
+							Name:            to.StrPtr("second"),
+							AddressPrefixes: []string{"10.0.2.0/24", "10.0.0.0/20"},
+						},
+					},
+					VmGroups: []VmGroup{
+						{
+							Name:        to.StrPtr("vm-group0"),
+							VmCount:     to.IntPtr(1),
+							VmSize:      to.StrPtr("Standard_DS2_v2"),
+							UsePublicIP: to.BoolPtr(false),
+							SubnetNames: []string{"main"},
+							VmImage: &VmImage{
+								Publisher: to.StrPtr("Canonical"),
+								Offer:     to.StrPtr("UbuntuServer"),
+								Sku:       to.StrPtr("18.04-LTS"),
+								Version:   to.StrPtr("18.04.202006101"),
+							},
+							DataDisks: []DataDisk{},
+						},
+					},
+				},
+				Unused: []string{},
+			},
+			wantErr: test.TestValidationErrors{
+				test.TestValidationError{
+					Key:   "Config.Params.Subnets[1].AddressPrefixes[1]",
+					Field: "Subnets[1].AddressPrefixes[1]",
+					Tag:   "nooverlap",
+				},
+			},
+		},
+		{
+			name: "subnet too small for attached vm groups",
+			config: &Config{
+				Meta: &Meta{
+					Kind:          to.StrPtr("azbiConfig"),
+					Version:       to.StrPtr("v0.2.1"),
+					ModuleVersion: to.StrPtr("v0.0.1"),
+				},
+				Params: &Params{
+					Location:         to.StrPtr("northeurope"),
+					Name:             to.StrPtr("epiphany"),
+					AdminUsername:    to.StrPtr("operations"),
+					RsaPublicKeyPath: to.StrPtr("some-file-name"),
+					AddressSpace:     []string{"10.0.0.0/16"},
+					Subnets: []Subnet{
+						{
+							Name:            to.StrPtr("main"),
+							AddressPrefixes: []string{"10.0.1.0/29"},
+						},
+						{
+							Name:            to.StrPtr("second"),
+							AddressPrefixes: []string{"10.0.2.0/29", "10.0.3.0/29"},
+						},
+					},
+					VmGroups: []VmGroup{
+						{
+							Name:        to.StrPtr("vm-group0"),
+							VmCount:     to.IntPtr(2),
+							VmSize:      to.StrPtr("Standard_DS2_v2"),
+							UsePublicIP: to.BoolPtr(false),
+							SubnetNames: []string{"main"},
+							VmImage: &VmImage{
+								Publisher: to.StrPtr("Canonical"),
+								Offer:     to.StrPtr("UbuntuServer"),
+								Sku:       to.StrPtr("18.04-LTS"),
+								Version:   to.StrPtr("18.04.202006101"),
+							},
+							DataDisks: []DataDisk{},
+						},
+						{
+							Name:        to.StrPtr("vm-group1"),
+							VmCount:     to.IntPtr(2),
+							VmSize:      to.StrPtr("Standard_DS2_v2"),
+							UsePublicIP: to.BoolPtr(false),
+							SubnetNames: []string{"main"},
+							VmImage: &VmImage{
+								Publisher: to.StrPtr("Canonical"),
+								Offer:     to.StrPtr("UbuntuServer"),
+								Sku:       to.StrPtr("18.04-LTS"),
+								Version:   to.StrPtr("18.04.202006101"),
+							},
+							DataDisks: []DataDisk{},
+						},
+						{
+							Name:        to.StrPtr("vm-group2"),
+							VmCount:     to.IntPtr(6),
+							VmSize:      to.StrPtr("Standard_DS2_v2"),
+							UsePublicIP: to.BoolPtr(false),
+							SubnetNames: []string{"second"},
+							VmImage: &VmImage{
+								Publisher: to.StrPtr("Canonical"),
+								Offer:     to.StrPtr("UbuntuServer"),
+								Sku:       to.StrPtr("18.04-LTS"),
+								Version:   to.StrPtr("18.04.202006101"),
+							},
+							DataDisks: []DataDisk{},
+						},
+					},
+				},
+				Unused: []string{},
+			},
+			wantErr: test.TestValidationErrors{
+				test.TestValidationError{
+					Key:   "Config.Params.Subnets[0].AddressPrefixes",
+					Field: "Subnets[0].AddressPrefixes",
+					Tag:   "fitsvms",
+				},
+			},
+		},
+		{
+			name: "subnet exactly fitting attached vm groups",
+			config: &Config{
+				Meta: &Meta{
+					Kind:          to.StrPtr("azbiConfig"),
+					Version:       to.StrPtr("v0.2.1"),
+					ModuleVersion: to.StrPtr("v0.0.1"),
+				},
+				Params: &Params{
+					Location:         to.StrPtr("northeurope"),
+					Name:             to.StrPtr("epiphany"),
+					AdminUsername:    to.StrPtr("operations"),
+					RsaPublicKeyPath: to.StrPtr("some-file-name"),
+					AddressSpace:     []string{"10.0.0.0/16"},
+					Subnets: []Subnet{
+						{
+							Name:            to.StrPtr("main"),
+							AddressPrefixes: []string{"10.0.1.0/29"},
+						},
+					},
+					VmGroups: []VmGroup{
+						{
+							Name:        to.StrPtr("vm-group0"),
+							VmCount:     to.IntPtr(2),
+							VmSize:      to.StrPtr("Standard_DS2_v2"),
+							UsePublicIP: to.BoolPtr(false),
+							SubnetNames: []string{"main"},
+							VmImage: &VmImage{
+								Publisher: to.StrPtr("Canonical"),
+								Offer:     to.StrPtr("UbuntuServer"),
+								Sku:       to.StrPtr("18.04-LTS"),
+								Version:   to.StrPtr("18.04.202006101"),
+							},
+							DataDisks: []DataDisk{},
+						},
+						{
+							Name:        to.StrPtr("vm-group1"),
+							VmCount:     to.IntPtr(1),
+							VmSize:      to.StrPtr("Standard_DS2_v2"),
+							UsePublicIP: to.BoolPtr(false),
+							SubnetNames: []string{"main"},
+							VmImage: &VmImage{
+								Publisher: to.StrPtr("Canonical"),
+								Offer:     to.StrPtr("UbuntuServer"),
+								Sku:       to.StrPtr("18.04-LTS"),
+								Version:   to.StrPtr("18.04.202006101"),
+							},
+							DataDisks: []DataDisk{},
+						},
+					},
+				},
+				Unused: []string{},
+			},
+			wantErr: nil,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -2593,9 +3196,9 @@ func TestConfig_Valid(t *testing.T) {
 				r.Error(err)
 				_, ok := err.(*validator.InvalidValidationError)
 				r.Equal(false, ok)
-				_, ok = err.(validator.ValidationErrors)
+				var errs validator.ValidationErrors
+				ok = errors.As(err, &errs)
 				r.Equal(true, ok)
-				errs := err.(validator.ValidationErrors)
 				a.Equal(len(tt.wantErr.(test.TestValidationErrors)), len(errs))
 
 				for _, e := range errs {
@@ -2617,6 +3220,124 @@ func TestConfig_Valid(t *testing.T) {
 	}
 }
 
+func TestConfig_ValidationError(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	c := &Config{}
+	c.Init("v0.0.1")
+	c.Meta.Kind = to.StrPtr("awsbiConfig")
+	c.Params.Name = to.StrPtr("")
+	c.Params.VmGroups[0].SubnetNames = []string{"unknown"}
+
+	err := c.Validate()
+	var verr *shared.ValidationError
+	r.True(errors.As(err, &verr))
+	a.Equal(shared.FieldErrors{
+		{
+			Path:     "meta.kind",
+			Severity: shared.SeverityError,
+			Tag:      "eq=azbiConfig|eq=azbiState",
+			Value:    "awsbiConfig",
+			Message:  `must be one of "azbiConfig", "azbiState"`,
+		},
+		{
+			Path:     "params.name",
+			Severity: shared.SeverityError,
+			Tag:      "min",
+			Param:    "1",
+			Value:    "",
+			Message:  "must be at least 1 characters long",
+		},
+		{
+			Path:     "params.vm_groups[0].subnet_names[0]",
+			Severity: shared.SeverityError,
+			Tag:      "insubnets",
+			Value:    "unknown",
+			Message:  "must be the name of a subnet defined in params.subnets",
+		},
+	}, verr.Fields)
+	a.Equal(`validation failed:
+  meta.kind: must be one of "azbiConfig", "azbiState" (got "awsbiConfig")
+  params.name: must be at least 1 characters long (got "")
+  params.vm_groups[0].subnet_names[0]: must be the name of a subnet defined in params.subnets (got "unknown")`, err.Error())
+}
+
+func TestConfig_SerialValidationError(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	c := &Config{}
+	c.Init("v0.0.1")
+	c.Meta.Serial = to.IntPtr(3)
+	c.Meta.Hash = to.StrPtr("abc")
+
+	err := c.Validate()
+	var verr *shared.ValidationError
+	r.True(errors.As(err, &verr))
+	a.Equal(shared.FieldErrors{
+		{
+			Path:     "meta.serial",
+			Severity: shared.SeverityError,
+			Tag:      "excluded",
+			Value:    3,
+			Message:  "must not be set",
+		},
+		{
+			Path:     "meta.hash",
+			Severity: shared.SeverityError,
+			Tag:      "excluded",
+			Value:    "abc",
+			Message:  "must not be set",
+		},
+	}, verr.Fields)
+}
+
+func TestConfig_SubnetsValidationError(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	c := &Config{}
+	c.Init("v0.0.1")
+	c.Params.Subnets = []Subnet{
+		{
+			Name:            to.StrPtr("main"),
+			AddressPrefixes: []string{"10.0.1.0/29"},
+		},
+		{
+			Name:            to.StrPtr("second"),
+			AddressPrefixes: []string{"10.0.1.0/24", "10.1.0.0/24"},
+		},
+	}
+	c.Params.VmGroups[0].VmCount = to.IntPtr(4)
+	err := c.Validate()
+	var verr *shared.ValidationError
+	r.True(errors.As(err, &verr))
+	sort.Sort(verr.Fields)
+	a.Equal(`validation failed:
+  params.subnets[0].address_prefixes: must have room for 4 VMs of attached VM groups (Azure reserves 5 addresses in every subnet) (got ["10.0.1.0/29"])
+  params.subnets[1].address_prefixes[0]: must not overlap 10.0.1.0/29 (got "10.0.1.0/24")
+  params.subnets[1].address_prefixes[1]: must be contained in one of params.address_space blocks (got "10.1.0.0/24")`, err.Error())
+}
+
+func TestConfig_Lint(t *testing.T) {
+	a := assert.New(t)
+	c := &Config{}
+	c.Init("v0.0.1")
+	a.Equal(shared.FieldErrors{
+		{
+			Path:     "params.vm_groups",
+			Severity: shared.SeverityWarning,
+			Tag:      WarningPublicIpOnAllVmGroups,
+			Message:  "every VM group uses public IP, consider keeping some of them private",
+		},
+	}, c.Lint())
+
+	c.Meta.SuppressWarnings = []string{WarningPublicIpOnAllVmGroups}
+	a.Empty(c.Lint())
+
+	c.Meta.SuppressWarnings = nil
+	c.Params.VmGroups[0].UsePublicIP = to.BoolPtr(false)
+	a.Empty(c.Lint())
+}
+
 func TestConfig_Upgrade(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -2810,7 +3531,8 @@ func TestConfig_Upgrade(t *testing.T) {
 				r.Error(err)
 				_, ok := err.(*validator.InvalidValidationError)
 				r.Equal(false, ok)
-				errs, ok := err.(validator.ValidationErrors)
+				var errs validator.ValidationErrors
+				ok = errors.As(err, &errs)
 				if ok {
 					for _, e := range errs {
 						found := false
@@ -2840,6 +3562,79 @@ func TestConfig_Upgrade(t *testing.T) {
 	}
 }
 
+func TestConfig_Downgrade(t *testing.T) {
+	tests := []struct {
+		name    string
+		force   bool
+		want    map[string]interface{}
+		wantErr error
+	}{
+		{
+			name:    "lossy downgrade is not performed without force",
+			force:   false,
+			want:    nil,
+			wantErr: shared.LossyMigrationError{From: "v0.2.1", To: "v0.2.0"},
+		},
+		{
+			name:  "forced downgrade v0.2.1 to v0.2.0",
+			force: true,
+			want: map[string]interface{}{
+				"meta": map[string]interface{}{
+					"kind":           "azbiConfig",
+					"version":        "v0.2.0",
+					"module_version": "v0.0.1",
+				},
+				"params": map[string]interface{}{
+					"location":     "northeurope",
+					"name":         "epiphany",
+					"rsa_pub_path": "some-file-name",
+				},
+			},
+			wantErr: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			r := require.New(t)
+			p, err := createTempDocumentFile("azbi-config-downgrade", []byte(`{
+	"meta": {
+		"kind": "azbiConfig",
+		"version": "v0.2.1",
+		"module_version": "v0.0.1"
+	},
+	"params": {
+		"location": "northeurope",
+		"name": "epiphany",
+		"admin_username": "operations",
+		"rsa_pub_path": "some-file-name"
+	}
+}
+`))
+			r.NoError(err)
+			original, err := ioutil.ReadFile(p)
+			r.NoError(err)
+			backup := p + ".backup"
+			err = (&Config{}).Downgrade(p, backup, "v0.2.0", tt.force)
+			if tt.wantErr != nil {
+				a.Equal(tt.wantErr, err)
+				_, err = os.Stat(backup)
+				a.True(os.IsNotExist(err))
+			} else {
+				a.NoError(err)
+				b, err := ioutil.ReadFile(p)
+				r.NoError(err)
+				got := make(map[string]interface{})
+				r.NoError(json.Unmarshal(b, &got))
+				a.Equal(tt.want, got)
+				b, err = ioutil.ReadFile(backup)
+				r.NoError(err)
+				a.Equal(string(original), string(b))
+			}
+		})
+	}
+}
+
 func TestParams_ExtractEmptySubnets(t *testing.T) {
 	tests := []struct {
 		name   string
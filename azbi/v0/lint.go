@@ -0,0 +1,22 @@
+package v0
+
+import "github.com/epiphany-platform/e-structures/shared"
+
+// WarningPublicIpOnAllVmGroups is reported when every VM group gets public IP, so there is no VM reachable only
+// from inside of virtual network.
+const WarningPublicIpOnAllVmGroups = "public-ip-on-all-vm-groups"
+
+func (p *Params) lint() []shared.FieldError {
+	if p == nil || len(p.VmGroups) == 0 {
+		return nil
+	}
+	for _, g := range p.VmGroups {
+		if g.UsePublicIP == nil || !*g.UsePublicIP {
+			return nil
+		}
+	}
+	return []shared.FieldError{
+		shared.Warning(WarningPublicIpOnAllVmGroups, "params.vm_groups", nil,
+			"every VM group uses public IP, consider keeping some of them private"),
+	}
+}
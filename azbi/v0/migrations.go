@@ -0,0 +1,42 @@
+package v0
+
+import (
+	"errors"
+
+	"github.com/epiphany-platform/e-structures/shared"
+)
+
+var configMigrations = shared.NewMigrations(configVersion,
+	shared.Migration{
+		From: "v0.2.0",
+		To:   "v0.2.1",
+		Func: func(input map[string]interface{}) error {
+			params, ok := input["params"].(map[string]interface{})
+			if !ok {
+				return errors.New("incorrect casting")
+			}
+			params["admin_username"] = "operations"
+			return nil
+		},
+		Reverse: func(input map[string]interface{}) error {
+			params, ok := input["params"].(map[string]interface{})
+			if !ok {
+				return errors.New("incorrect casting")
+			}
+			delete(params, "admin_username")
+			return nil
+		},
+		// admin_username value is dropped
+		Lossy: true,
+	},
+)
+
+var stateMigrations = shared.NewMigrations(stateVersion,
+	shared.Migration{
+		From: "v0.0.1",
+		To:   "v0.0.2",
+		Subtrees: map[string]string{
+			"config": "v0.2.0",
+		},
+	},
+).WithSubtree("config", configMigrations)
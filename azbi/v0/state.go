@@ -3,17 +3,19 @@ package v0
 import (
 	"errors"
 	"github.com/epiphany-platform/e-structures/shared"
+	"github.com/epiphany-platform/e-structures/storage"
 	"github.com/epiphany-platform/e-structures/utils/to"
 	"github.com/epiphany-platform/e-structures/utils/validators"
 	"github.com/go-playground/validator/v10"
 )
 
 type State struct {
-	Meta   *Meta         `json:"meta" validate:"required"`
-	Status shared.Status `json:"status" validate:"required,eq=initialized|eq=applied|eq=destroyed"`
-	Config *Config       `json:"config" validate:"omitempty"`
-	Output *Output       `json:"output" validate:"omitempty"`
-	Unused []string      `json:"-"`
+	Meta    *Meta                  `json:"meta" validate:"required"`
+	Status  shared.Status          `json:"status" validate:"required,eq=initialized|eq=applied|eq=destroyed"`
+	Config  *Config                `json:"config" validate:"omitempty"`
+	Output  *Output                `json:"output" validate:"omitempty"`
+	Unused  []string               `json:"-"`
+	Unknown map[string]interface{} `json:"-"`
 }
 
 func (s *State) Init(moduleVersion string) {
@@ -30,33 +32,54 @@ func (s *State) Init(moduleVersion string) {
 	}
 }
 
-func (s *State) Backup(path string) error {
-	return shared.Backup(s, path)
+func (s *State) Backup(path string, options ...shared.EncodeOption) error {
+	return shared.Backup(s, path, options...)
 }
 
-func (s *State) Load(path string) error {
-	i, err := shared.Load(s, path, stateVersion)
-	if err != nil {
-		return err
-	}
-	state, ok := i.(*State)
-	if !ok {
-		return errors.New("incorrect casting")
-	}
-	err = state.Validate() // TODO rethink if validation should be done here
-	if err != nil {
-		return err
-	}
-	*s = *state
-	return nil
+func (s *State) BackupRaw(path, new string) error {
+	_, err := shared.BackupRaw(path, new)
+	return err
 }
 
-func (s *State) Save(path string) error {
-	return shared.Save(s, path)
+func (s *State) BackupTo(st storage.Storage, name string, options ...shared.EncodeOption) error {
+	return shared.BackupTo(s, st, name, options...)
 }
 
-func (s *State) Print() ([]byte, error) {
-	return shared.Print(s)
+func (s *State) BackupRawTo(st storage.Storage, name, new string) error {
+	_, err := shared.BackupRawTo(st, name, st, new)
+	return err
+}
+
+func (s *State) Load(path string, options ...shared.DecodeOption) error {
+	return shared.Load(s, path, stateVersion, options...)
+}
+
+func (s *State) LoadFrom(st storage.Storage, name string, options ...shared.DecodeOption) error {
+	return shared.LoadFrom(s, st, name, stateVersion, options...)
+}
+
+func (s *State) Save(path string, options ...shared.EncodeOption) error {
+	return shared.SaveSerialized(s, path, func() ([]byte, error) {
+		return s.Print(options...)
+	}, options...)
+}
+
+func (s *State) SaveTo(st storage.Storage, name string, options ...shared.EncodeOption) error {
+	return shared.SaveSerializedTo(s, st, name, func() ([]byte, error) {
+		return s.Print(options...)
+	}, options...)
+}
+
+func (s *State) Print(options ...shared.EncodeOption) ([]byte, error) {
+	return shared.Print(s, options...)
+}
+
+func (s *State) PrintYAML(options ...shared.EncodeOption) ([]byte, error) {
+	return shared.PrintYAML(s, options...)
+}
+
+func (s *State) PrintRedacted(options shared.RedactOptions) ([]byte, error) {
+	return shared.PrintRedacted(s, options)
 }
 
 func (s *State) Validate() error {
@@ -73,72 +96,79 @@ func (s *State) Validate() error {
 		if _, ok := err.(*validator.InvalidValidationError); ok {
 			return err
 		}
-		return err
+		return shared.NewValidationError(s, err)
 	}
 	return nil
 }
 
-func (s *State) Upgrade(path string) error {
-	i, err := shared.Upgrade(s, path)
-	if err != nil {
-		return err
-	}
-	state, ok := i.(*State)
-	if !ok {
-		return errors.New("incorrect casting")
-	}
-	err = state.Validate() // TODO rethink if validation should be done here
-	if err != nil {
-		return err
+func (s *State) Lint() shared.FieldErrors {
+	if s == nil {
+		return nil
 	}
-	*s = *state
-	return nil
+	return shared.Lint(s, s.Unused, s.Meta.suppressed())
+}
+
+func (s *State) Upgrade(path string, options ...shared.DecodeOption) error {
+	return shared.Upgrade(s, path, options...)
+}
+
+func (s *State) UpgradeFrom(st storage.Storage, name string, options ...shared.DecodeOption) error {
+	return shared.UpgradeFrom(s, st, name, options...)
 }
 
 func (s *State) UpgradeFunc(input map[string]interface{}) error {
-	upgraded := false
-	for !upgraded {
-		v, err := shared.GetVersion(input)
-		if err != nil {
-			return err
-		}
-		switch v {
-		case "v0.0.1":
-			meta, ok := input["meta"].(map[string]interface{})
-			if !ok {
-				return errors.New("incorrect casting")
-			}
-			meta["version"] = "v0.0.2"
-			input["meta"] = meta
-
-			configSubtree, ok := input["config"].(map[string]interface{})
-			if !ok {
-				return errors.New("incorrect casting")
-			}
-			c := Config{}
-			err = c.UpgradeFunc(configSubtree)
-			if err != nil {
-				return err
-			}
-			input["config"] = configSubtree
-		default:
-			v, err2 := shared.GetVersion(input)
-			if err2 != nil {
-				return err2
-			}
-			if v != stateVersion {
-				return errors.New("unknown version to upgrade")
-			}
-			upgraded = true
-		}
-	}
-	return nil
+	_, err := stateMigrations.Migrate(input)
+	return err
+}
+
+func (s *State) Downgrade(path, backup, targetVersion string, force bool) error {
+	_, err := shared.Downgrade(stateMigrations, path, backup, targetVersion, force)
+	return err
+}
+
+func (s *State) DowngradeFrom(st storage.Storage, name, backup, targetVersion string, force bool) error {
+	_, err := shared.DowngradeFrom(stateMigrations, st, name, backup, targetVersion, force)
+	return err
 }
 
 func (s *State) SetUnused(unused []string) {
 	s.Unused = unused
 }
 
+func (s *State) SetUnknown(unknown map[string]interface{}) {
+	s.Unknown = unknown
+}
+
+func (s *State) GetUnknown() map[string]interface{} {
+	return s.Unknown
+}
+
+func (s *State) GetSerial() (int, string) {
+	if s == nil || s.Meta == nil {
+		return 0, ""
+	}
+	serial, hash := 0, ""
+	if s.Meta.Serial != nil {
+		serial = *s.Meta.Serial
+	}
+	if s.Meta.Hash != nil {
+		hash = *s.Meta.Hash
+	}
+	return serial, hash
+}
+
+func (s *State) SetSerial(serial int, hash string) {
+	if s.Meta == nil {
+		// structure without meta is not valid and won't be saved anyway
+		return
+	}
+	s.Meta.Serial = to.IntPtr(serial)
+	s.Meta.Hash = nil
+	if hash != "" {
+		s.Meta.Hash = to.StrPtr(hash)
+	}
+}
+
 // TODO consider validation in output ... but really think about it hard. It might not be desired.
 
 type Output struct {
@@ -155,7 +185,7 @@ type OutputVmGroup struct {
 type OutputVm struct {
 	Name       *string          `json:"vm_name"`
 	PrivateIps []string         `json:"private_ips"`
-	PublicIp   *string          `json:"public_ip"`
+	PublicIp   *string          `json:"public_ip" redact:"identifier"`
 	DataDisks  []OutputDataDisk `json:"data_disks"`
 }
 
@@ -274,6 +274,13 @@ func TestState_Load(t *testing.T) {
 					"output.unknown_key_4",
 					"unknown_key_1",
 				},
+				Unknown: map[string]interface{}{
+					"config.params.vm_groups[name=vm-group0].unknown_key_3":   "unknown_value_3",
+					"config.params.unknown_key_2":                             "unknown_value_2",
+					"output.vm_groups[vm_group_name=vm-group0].unknown_key_5": "unknown_value_5",
+					"output.unknown_key_4":                                    "unknown_value_4",
+					"unknown_key_1":                                           "unknown_value_1",
+				},
 			},
 			wantErr: nil,
 		},
@@ -340,7 +347,8 @@ func TestState_Load(t *testing.T) {
 				r.Error(err)
 				_, ok := err.(*validator.InvalidValidationError)
 				r.Equal(false, ok)
-				errs, ok := err.(validator.ValidationErrors)
+				var errs validator.ValidationErrors
+				ok = errors.As(err, &errs)
 				if ok {
 					for _, e := range errs {
 						found := false
@@ -373,10 +381,11 @@ func TestState_Load(t *testing.T) {
 
 func TestState_Save(t *testing.T) {
 	tests := []struct {
-		name    string
-		state   *State
-		want    []byte
-		wantErr error
+		name     string
+		existing []byte
+		state    *State
+		want     []byte
+		wantErr  error
 	}{
 		{
 			name: "happy path",
@@ -393,7 +402,9 @@ func TestState_Save(t *testing.T) {
 	"meta": {
 		"kind": "azbiState",
 		"version": "v0.0.2",
-		"module_version": "dev"
+		"module_version": "dev",
+		"serial": 1,
+		"hash": "87341eefee6746f6cd2533b591365d6706d1e11d6893aca74785a20568216f3f"
 	},
 	"status": "initialized",
 	"config": null,
@@ -401,6 +412,69 @@ func TestState_Save(t *testing.T) {
 }`),
 			wantErr: nil,
 		},
+		{
+			name: "serial is increased",
+			existing: []byte(`{
+	"meta": {
+		"kind": "azbiState",
+		"version": "v0.0.2",
+		"module_version": "dev",
+		"serial": 4,
+		"hash": "503a0ce155064c9ada4da84d527338c7e07123d0561a5767b4263cb5947ec3ab"
+	},
+	"status": "initialized"
+}`),
+			state: &State{
+				Meta: &Meta{
+					Kind:          to.StrPtr("azbiState"),
+					Version:       to.StrPtr("v0.0.2"),
+					ModuleVersion: to.StrPtr("dev"),
+					Serial:        to.IntPtr(4),
+					Hash:          to.StrPtr("503a0ce155064c9ada4da84d527338c7e07123d0561a5767b4263cb5947ec3ab"),
+				},
+				Status: shared.Applied,
+				Unused: []string{},
+			},
+			want: []byte(`{
+	"meta": {
+		"kind": "azbiState",
+		"version": "v0.0.2",
+		"module_version": "dev",
+		"serial": 5,
+		"hash": "0ec1ecd8f1e7a6863d5fc20fc7bd407fdcb52e1406608ec2f3c6bd99bc81df0d"
+	},
+	"status": "applied",
+	"config": null,
+	"output": null
+}`),
+			wantErr: nil,
+		},
+		{
+			name: "file saved by someone else after load",
+			existing: []byte(`{
+	"meta": {
+		"kind": "azbiState",
+		"version": "v0.0.2",
+		"module_version": "dev",
+		"serial": 5,
+		"hash": "other-hash"
+	},
+	"status": "applied"
+}`),
+			state: &State{
+				Meta: &Meta{
+					Kind:          to.StrPtr("azbiState"),
+					Version:       to.StrPtr("v0.0.2"),
+					ModuleVersion: to.StrPtr("dev"),
+					Serial:        to.IntPtr(4),
+					Hash:          to.StrPtr("some-hash"),
+				},
+				Status: shared.Applied,
+				Unused: []string{},
+			},
+			want:    nil,
+			wantErr: shared.ConflictError{Expected: 4, Found: 5},
+		},
 		{
 			name:  "invalid",
 			state: &State{},
@@ -426,12 +500,21 @@ func TestState_Save(t *testing.T) {
 			p, err := createTempDirectory("azbi-state-save")
 			a.NoError(err)
 
+			if tt.existing != nil {
+				r.NoError(ioutil.WriteFile(filepath.Join(p, "file.json"), tt.existing, 0644))
+			}
+
 			err = tt.state.Save(filepath.Join(p, "file.json"))
+			if cerr, ok := err.(shared.ConflictError); ok {
+				cerr.Path = ""
+				err = cerr
+			}
 			if tt.wantErr != nil {
 				a.Error(err)
 				_, ok := err.(*validator.InvalidValidationError)
 				r.Equal(false, ok)
-				errs, ok := err.(validator.ValidationErrors)
+				var errs validator.ValidationErrors
+				ok = errors.As(err, &errs)
 				if ok {
 					for _, e := range errs {
 						found := false
@@ -655,7 +738,8 @@ func TestState_Print(t *testing.T) {
 				a.Error(err)
 				_, ok := err.(*validator.InvalidValidationError)
 				r.Equal(false, ok)
-				errs, ok := err.(validator.ValidationErrors)
+				var errs validator.ValidationErrors
+				ok = errors.As(err, &errs)
 				if ok {
 					for _, e := range errs {
 						found := false
@@ -830,9 +914,9 @@ func TestState_Valid(t *testing.T) {
 				r.Error(err)
 				_, ok := err.(*validator.InvalidValidationError)
 				r.Equal(false, ok)
-				_, ok = err.(validator.ValidationErrors)
+				var errs validator.ValidationErrors
+				ok = errors.As(err, &errs)
 				r.Equal(true, ok)
-				errs := err.(validator.ValidationErrors)
 				a.Equal(len(tt.wantErr.(test.TestValidationErrors)), len(errs))
 
 				for _, e := range errs {
@@ -1200,7 +1284,8 @@ func TestState_Upgrade(t *testing.T) {
 				r.Error(err)
 				_, ok := err.(*validator.InvalidValidationError)
 				r.Equal(false, ok)
-				errs, ok := err.(validator.ValidationErrors)
+				var errs validator.ValidationErrors
+				ok = errors.As(err, &errs)
 				if ok {
 					for _, e := range errs {
 						found := false
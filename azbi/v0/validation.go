@@ -3,8 +3,18 @@ package v0
 import (
 	"fmt"
 	"github.com/go-playground/validator/v10"
+	"math"
+	"net"
+	"strconv"
 )
 
+// azureReservedAddresses is number of addresses Azure reserves in every subnet: network address, default gateway,
+// two addresses for Azure DNS and broadcast address.
+const azureReservedAddresses = 5
+
+// AzBISubnetsValidation checks that every subnet name used by VM groups refers to defined subnet, that address
+// prefixes of subnets are contained in address space and don't overlap each other and that subnets have enough
+// addresses for VMs of groups attached to them. It reports all failures, not only the first one.
 func AzBISubnetsValidation(sl validator.StructLevel) {
 	params := sl.Current().Interface().(Params)
 	if len(params.VmGroups) > 0 {
@@ -17,7 +27,7 @@ func AzBISubnetsValidation(sl validator.StructLevel) {
 						fmt.Sprintf("SubnetNames[%d]", j),
 						"required",
 						"")
-					return
+					continue
 				}
 				found := false
 				for _, s := range params.Subnets {
@@ -32,9 +42,145 @@ func AzBISubnetsValidation(sl validator.StructLevel) {
 						fmt.Sprintf("SubnetNames[%d]", j),
 						"insubnets",
 						"")
-					return
 				}
 			}
 		}
 	}
+	addressPrefixesValidation(sl, params)
+	subnetsCapacityValidation(sl, params)
+}
+
+// AzBIConfigMetaValidation checks that config doesn't carry serial and hash. They are kept only in state
+// (see State.Save) and wouldn't be checked or updated when set in config file.
+func AzBIConfigMetaValidation(sl validator.StructLevel) {
+	config := sl.Current().Interface().(Config)
+	if config.Meta == nil {
+		return
+	}
+	if config.Meta.Serial != nil {
+		sl.ReportError(*config.Meta.Serial, "Meta.Serial", "Serial", "excluded", "")
+	}
+	if config.Meta.Hash != nil {
+		sl.ReportError(*config.Meta.Hash, "Meta.Hash", "Hash", "excluded", "")
+	}
+}
+
+// addressPrefixesValidation checks that every address prefix of subnets is contained in one of address spaces
+// and that it doesn't overlap with prefixes listed before it. Prefixes which aren't valid CIDR blocks are skipped as
+// they are reported by cidr validation of field.
+func addressPrefixesValidation(sl validator.StructLevel, params Params) {
+	spaces := make([]*net.IPNet, 0, len(params.AddressSpace))
+	for _, as := range params.AddressSpace {
+		if _, n, err := net.ParseCIDR(as); err == nil {
+			spaces = append(spaces, n)
+		}
+	}
+	type prefix struct {
+		value   string
+		network *net.IPNet
+	}
+	checked := make([]prefix, 0)
+	for i, subnet := range params.Subnets {
+		for j, ap := range subnet.AddressPrefixes {
+			_, n, err := net.ParseCIDR(ap)
+			if err != nil {
+				continue
+			}
+			if len(spaces) > 0 {
+				contained := false
+				for _, space := range spaces {
+					if contains(space, n) {
+						contained = true
+						break
+					}
+				}
+				if !contained {
+					sl.ReportError(
+						params.Subnets[i].AddressPrefixes[j],
+						fmt.Sprintf("Subnets[%d].AddressPrefixes[%d]", i, j),
+						fmt.Sprintf("AddressPrefixes[%d]", j),
+						"inaddressspace",
+						"")
+				}
+			}
+			for _, p := range checked {
+				if contains(p.network, n) || contains(n, p.network) {
+					sl.ReportError(
+						params.Subnets[i].AddressPrefixes[j],
+						fmt.Sprintf("Subnets[%d].AddressPrefixes[%d]", i, j),
+						fmt.Sprintf("AddressPrefixes[%d]", j),
+						"nooverlap",
+						p.value)
+					break
+				}
+			}
+			checked = append(checked, prefix{value: ap, network: n})
+		}
+	}
+}
+
+// subnetsCapacityValidation checks that every subnet has enough usable addresses (that is addresses not reserved
+// by Azure) for all VMs of groups attached to it.
+func subnetsCapacityValidation(sl validator.StructLevel, params Params) {
+	for i, subnet := range params.Subnets {
+		if subnet.Name == nil {
+			continue
+		}
+		vms := 0
+		for _, vmGroup := range params.VmGroups {
+			if vmGroup.VmCount == nil {
+				continue
+			}
+			for _, sn := range vmGroup.SubnetNames {
+				if sn == *subnet.Name {
+					vms += *vmGroup.VmCount
+					break
+				}
+			}
+		}
+		if vms == 0 {
+			continue
+		}
+		capacity, valid := 0, false
+		for _, ap := range subnet.AddressPrefixes {
+			_, n, err := net.ParseCIDR(ap)
+			if err != nil {
+				continue
+			}
+			valid = true
+			capacity += usableAddresses(n)
+			if capacity >= vms {
+				break
+			}
+		}
+		if valid && capacity < vms {
+			sl.ReportError(
+				params.Subnets[i].AddressPrefixes,
+				fmt.Sprintf("Subnets[%d].AddressPrefixes", i),
+				"AddressPrefixes",
+				"fitsvms",
+				strconv.Itoa(vms))
+		}
+	}
+}
+
+// contains checks if network inner is part of network outer.
+func contains(outer, inner *net.IPNet) bool {
+	outerOnes, outerBits := outer.Mask.Size()
+	innerOnes, innerBits := inner.Mask.Size()
+	return outerBits == innerBits && outerOnes <= innerOnes && outer.Contains(inner.IP)
+}
+
+// usableAddresses returns number of addresses of network n which can be assigned to VMs.
+func usableAddresses(n *net.IPNet) int {
+	ones, bits := n.Mask.Size()
+	if bits-ones >= 31 {
+		// more than any VM count can reach
+		return math.MaxInt32
+	}
+	usable := 1<<uint(bits-ones) - azureReservedAddresses
+	if usable < 0 {
+		return 0
+	}
+	return usable
 }
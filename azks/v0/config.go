@@ -1,97 +1,29 @@
 package v0
 
 import (
-	"encoding/json"
+	"errors"
 
+	"github.com/epiphany-platform/e-structures/shared"
+	"github.com/epiphany-platform/e-structures/storage"
 	"github.com/epiphany-platform/e-structures/utils/to"
 	"github.com/epiphany-platform/e-structures/utils/validators"
 	"github.com/go-playground/validator/v10"
-	maps "github.com/mitchellh/mapstructure"
 )
 
-const (
-	kind    = "azks"
-	version = "v0.0.3"
-)
-
-type AzureAd struct {
-	Managed             *bool    `json:"managed" validate:"required"`
-	TenantId            *string  `json:"tenant_id" validate:"required,min=1"`
-	AdminGroupObjectIds []string `json:"admin_group_object_ids" validate:"required,min=1,dive,required,min=1"`
-}
-
-type AutoScalerProfile struct { //TODO consider changing types of string values here to make it more golang'ish
-	BalanceSimilarNodeGroups      *bool   `json:"balance_similar_node_groups" validate:"required"`
-	MaxGracefulTerminationSec     *string `json:"max_graceful_termination_sec" validate:"required,min=1"`
-	ScaleDownDelayAfterAdd        *string `json:"scale_down_delay_after_add" validate:"required,min=1"`
-	ScaleDownDelayAfterDelete     *string `json:"scale_down_delay_after_delete" validate:"required,min=1"`
-	ScaleDownDelayAfterFailure    *string `json:"scale_down_delay_after_failure" validate:"required,min=1"`
-	ScanInterval                  *string `json:"scan_interval" validate:"required,min=1"`
-	ScaleDownUnneeded             *string `json:"scale_down_unneeded" validate:"required,min=1"`
-	ScaleDownUnready              *string `json:"scale_down_unready" validate:"required,min=1"`
-	ScaleDownUtilizationThreshold *string `json:"scale_down_utilization_threshold" validate:"required,min=1"`
-}
-
-type DefaultNodePool struct {
-	Size        *int    `json:"size" validate:"required,min=0,gtefield=Min,ltefield=Max"`
-	Min         *int    `json:"min" validate:"required,min=0"`
-	Max         *int    `json:"max" validate:"required,min=0,gtefield=Min"`
-	VmSize      *string `json:"vm_size" validate:"required,min=1"`
-	DiskGbSize  *int    `json:"disk_gb_size" validate:"required,min=1"`
-	AutoScaling *bool   `json:"auto_scaling" validate:"required"`
-	Type        *string `json:"type" validate:"required,min=1"`
-}
-
-type Params struct {
-	Name               *string            `json:"name" validate:"required,min=1"`
-	Location           *string            `json:"location" validate:"required,min=1"`
-	RsaPublicKeyPath   *string            `json:"rsa_pub_path" validate:"required,min=1"`
-	RgName             *string            `json:"rg_name" validate:"required,min=1"`
-	VnetName           *string            `json:"vnet_name" validate:"required,min=1"`
-	SubnetName         *string            `json:"subnet_name" validate:"required,min=1"`
-	KubernetesVersion  *string            `json:"kubernetes_version" validate:"required,min=1"`
-	EnableNodePublicIp *bool              `json:"enable_node_public_ip" validate:"required"`
-	EnableRbac         *bool              `json:"enable_rbac" validate:"required"`
-	DefaultNodePool    *DefaultNodePool   `json:"default_node_pool" validate:"required,dive"`
-	AutoScalerProfile  *AutoScalerProfile `json:"auto_scaler_profile" validate:"required,dive"`
-	AzureAd            *AzureAd           `json:"azure_ad" validate:"omitempty"`
-	IdentityType       *string            `json:"identity_type" validate:"required,min=1"`
-	AdminUsername      *string            `json:"admin_username" validate:"required,min=1"`
-}
-
-func (p *Params) GetRsaPublicKeyV() string {
-	if p == nil {
-		return ""
-	}
-	return *p.RsaPublicKeyPath
-}
-
-func (p *Params) GetNameV() string {
-	if p == nil {
-		return ""
-	}
-	return *p.Name
-}
-
 type Config struct {
-	Kind    *string  `json:"kind" validate:"required,eq=azks"`
-	Version *string  `json:"version" validate:"required,version=~0"`
-	Params  *Params  `json:"params" validate:"required"`
-	Unused  []string `json:"-"`
+	Meta    *Meta                  `json:"meta" validate:"required"`
+	Params  *Params                `json:"params" validate:"required"`
+	Unused  []string               `json:"-"`
+	Unknown map[string]interface{} `json:"-"`
 }
 
-func (c *Config) GetParams() *Params {
-	if c == nil {
-		return nil
-	}
-	return c.Params
-}
-
-//TODO test
-func NewConfig() *Config {
-	return &Config{
-		Kind:    to.StrPtr(kind),
-		Version: to.StrPtr(version),
+func (c *Config) Init(moduleVersion string) {
+	*c = Config{
+		Meta: &Meta{
+			Kind:          to.StrPtr(configKind),
+			Version:       to.StrPtr(configVersion),
+			ModuleVersion: to.StrPtr(moduleVersion),
+		},
 		Params: &Params{
 			Name:             to.StrPtr("epiphany"),
 			Location:         to.StrPtr("northeurope"), //TODO possibly delete this value in future
@@ -134,55 +66,194 @@ func NewConfig() *Config {
 	}
 }
 
-func (c *Config) Marshal() ([]byte, error) {
-	err := c.isValid()
-	if err != nil {
-		return nil, err
-	}
-	return json.MarshalIndent(c, "", "\t")
+func (c *Config) Backup(path string, options ...shared.EncodeOption) error {
+	return shared.Backup(c, path, options...)
 }
 
-func (c *Config) Unmarshal(b []byte) (err error) {
-	var input map[string]interface{}
-	if err = json.Unmarshal(b, &input); err != nil {
-		return
-	}
-	var md maps.Metadata
-	d, err := maps.NewDecoder(&maps.DecoderConfig{
-		Metadata: &md,
-		TagName:  "json",
-		Result:   &c,
-	})
-	if err != nil {
-		return
-	}
-	err = d.Decode(input)
-	if err != nil {
-		return
-	}
-	c.Unused = md.Unused
-	err = c.isValid()
-	return
+func (c *Config) BackupRaw(path, new string) error {
+	_, err := shared.BackupRaw(path, new)
+	return err
+}
+
+func (c *Config) BackupTo(st storage.Storage, name string, options ...shared.EncodeOption) error {
+	return shared.BackupTo(c, st, name, options...)
+}
+
+func (c *Config) BackupRawTo(st storage.Storage, name, new string) error {
+	_, err := shared.BackupRawTo(st, name, st, new)
+	return err
+}
+
+func (c *Config) Load(path string, options ...shared.DecodeOption) error {
+	return shared.Load(c, path, configVersion, options...)
+}
+
+func (c *Config) LoadFrom(st storage.Storage, name string, options ...shared.DecodeOption) error {
+	return shared.LoadFrom(c, st, name, configVersion, options...)
 }
 
-func (c *Config) isValid() error {
+func (c *Config) Save(path string, options ...shared.EncodeOption) error {
+	return shared.Save(c, path, options...)
+}
+
+func (c *Config) SaveTo(st storage.Storage, name string, options ...shared.EncodeOption) error {
+	return shared.SaveTo(c, st, name, options...)
+}
+
+func (c *Config) Print(options ...shared.EncodeOption) ([]byte, error) {
+	return shared.Print(c, options...)
+}
+
+func (c *Config) PrintYAML(options ...shared.EncodeOption) ([]byte, error) {
+	return shared.PrintYAML(c, options...)
+}
+
+func (c *Config) PrintRedacted(options shared.RedactOptions) ([]byte, error) {
+	return shared.PrintRedacted(c, options)
+}
+
+func (c *Config) Validate() error {
+	if c == nil {
+		return errors.New("expected config is nil")
+	}
 	validate := validator.New()
 
 	err := validate.RegisterValidation("version", validators.HasVersion)
 	if err != nil {
 		return err
 	}
-
+	validate.RegisterStructValidation(AzKSConfigMetaValidation, Config{})
 	err = validate.Struct(c)
 	if err != nil {
 		if _, ok := err.(*validator.InvalidValidationError); ok {
 			return err
 		}
-		return err
+		return shared.NewValidationError(c, err)
 	}
 	return nil
 }
 
-type Output struct {
-	KubeConfig *string `json:"kubeconfig"`
+func (c *Config) Lint() shared.FieldErrors {
+	if c == nil {
+		return nil
+	}
+	return shared.Lint(c, c.Unused, c.Meta.suppressed())
+}
+
+func (c *Config) Upgrade(path string, options ...shared.DecodeOption) error {
+	return shared.Upgrade(c, path, options...)
+}
+
+func (c *Config) UpgradeFrom(st storage.Storage, name string, options ...shared.DecodeOption) error {
+	return shared.UpgradeFrom(c, st, name, options...)
+}
+
+func (c *Config) UpgradeFunc(input map[string]interface{}) error {
+	_, err := configMigrations.Migrate(input)
+	return err
+}
+
+func (c *Config) Downgrade(path, backup, targetVersion string, force bool) error {
+	_, err := shared.Downgrade(configMigrations, path, backup, targetVersion, force)
+	return err
+}
+
+func (c *Config) DowngradeFrom(st storage.Storage, name, backup, targetVersion string, force bool) error {
+	_, err := shared.DowngradeFrom(configMigrations, st, name, backup, targetVersion, force)
+	return err
+}
+
+func (c *Config) SetUnused(unused []string) {
+	c.Unused = unused
+}
+
+func (c *Config) SetUnknown(unknown map[string]interface{}) {
+	c.Unknown = unknown
+}
+
+func (c *Config) GetUnknown() map[string]interface{} {
+	return c.Unknown
+}
+
+func (c *Config) GetParams() *Params {
+	if c == nil {
+		return nil
+	}
+	return c.Params
+}
+
+type Meta struct {
+	Kind          *string `json:"kind" validate:"required,eq=azksConfig|eq=azksState"`
+	Version       *string `json:"version" validate:"required,version=~0"`
+	ModuleVersion *string `json:"module_version" validate:"required"`
+	Serial        *int    `json:"serial,omitempty" validate:"omitempty,min=0"`
+	Hash          *string `json:"hash,omitempty"`
+	// SuppressWarnings lists codes of lint findings which shouldn't be reported for document.
+	SuppressWarnings []string `json:"suppress_warnings,omitempty" validate:"omitempty,dive,min=1"`
+}
+
+func (m *Meta) suppressed() []string {
+	if m == nil {
+		return nil
+	}
+	return m.SuppressWarnings
+}
+
+type AzureAd struct {
+	Managed             *bool    `json:"managed" validate:"required"`
+	TenantId            *string  `json:"tenant_id" validate:"required,min=1" redact:"identifier"`
+	AdminGroupObjectIds []string `json:"admin_group_object_ids" validate:"required,min=1,dive,required,min=1" redact:"identifier"`
+}
+
+type AutoScalerProfile struct { //TODO consider changing types of string values here to make it more golang'ish
+	BalanceSimilarNodeGroups      *bool   `json:"balance_similar_node_groups" validate:"required"`
+	MaxGracefulTerminationSec     *string `json:"max_graceful_termination_sec" validate:"required,min=1"`
+	ScaleDownDelayAfterAdd        *string `json:"scale_down_delay_after_add" validate:"required,min=1"`
+	ScaleDownDelayAfterDelete     *string `json:"scale_down_delay_after_delete" validate:"required,min=1"`
+	ScaleDownDelayAfterFailure    *string `json:"scale_down_delay_after_failure" validate:"required,min=1"`
+	ScanInterval                  *string `json:"scan_interval" validate:"required,min=1"`
+	ScaleDownUnneeded             *string `json:"scale_down_unneeded" validate:"required,min=1"`
+	ScaleDownUnready              *string `json:"scale_down_unready" validate:"required,min=1"`
+	ScaleDownUtilizationThreshold *string `json:"scale_down_utilization_threshold" validate:"required,min=1"`
+}
+
+type DefaultNodePool struct {
+	Size        *int    `json:"size" validate:"required,min=0,gtefield=Min,ltefield=Max"`
+	Min         *int    `json:"min" validate:"required,min=0"`
+	Max         *int    `json:"max" validate:"required,min=0,gtefield=Min"`
+	VmSize      *string `json:"vm_size" validate:"required,min=1"`
+	DiskGbSize  *int    `json:"disk_gb_size" validate:"required,min=1"`
+	AutoScaling *bool   `json:"auto_scaling" validate:"required"`
+	Type        *string `json:"type" validate:"required,min=1"`
+}
+
+type Params struct {
+	Name               *string            `json:"name" validate:"required,min=1"`
+	Location           *string            `json:"location" validate:"required,min=1"`
+	RsaPublicKeyPath   *string            `json:"rsa_pub_path" validate:"required,min=1" redact:"identifier"`
+	RgName             *string            `json:"rg_name" validate:"required,min=1"`
+	VnetName           *string            `json:"vnet_name" validate:"required,min=1"`
+	SubnetName         *string            `json:"subnet_name" validate:"required,min=1"`
+	KubernetesVersion  *string            `json:"kubernetes_version" validate:"required,min=1"`
+	EnableNodePublicIp *bool              `json:"enable_node_public_ip" validate:"required"`
+	EnableRbac         *bool              `json:"enable_rbac" validate:"required"`
+	DefaultNodePool    *DefaultNodePool   `json:"default_node_pool" validate:"required,dive"`
+	AutoScalerProfile  *AutoScalerProfile `json:"auto_scaler_profile" validate:"required,dive"`
+	AzureAd            *AzureAd           `json:"azure_ad" validate:"omitempty"`
+	IdentityType       *string            `json:"identity_type" validate:"required,min=1"`
+	AdminUsername      *string            `json:"admin_username" validate:"required,min=1"`
+}
+
+func (p *Params) GetRsaPublicKeyV() string {
+	if p == nil {
+		return ""
+	}
+	return *p.RsaPublicKeyPath
+}
+
+func (p *Params) GetNameV() string {
+	if p == nil {
+		return ""
+	}
+	return *p.Name
 }
@@ -1,14 +1,50 @@
 package v0
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
+	"github.com/epiphany-platform/e-structures/shared"
 	"github.com/epiphany-platform/e-structures/utils/test"
 	"github.com/epiphany-platform/e-structures/utils/to"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+func TestConfig_Init(t *testing.T) {
+	tests := []struct {
+		name          string
+		moduleVersion string
+		want          *Config
+	}{
+		{
+			name:          "happy path",
+			moduleVersion: "v1.1.1",
+			want: func() *Config {
+				c := minimalConfig()
+				c.Meta.ModuleVersion = to.StrPtr("v1.1.1")
+				c.Params.RsaPublicKeyPath = to.StrPtr("/shared/vms_rsa.pub")
+				return c
+			}(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			got := &Config{}
+			got.Init(tt.moduleVersion)
+			a.Equal(tt.want, got)
+			a.NoError(got.Validate())
+		})
+	}
+}
+
 // TestConfig_Load_general contains all general types of scenarios: happy path, unknown fields,
 // kind and version validation, minimal correct and full json.
 func TestConfig_Load_general(t *testing.T) {
@@ -21,8 +57,11 @@ func TestConfig_Load_general(t *testing.T) {
 		{
 			name: "happy path",
 			json: []byte(`{
-	"kind": "azks",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"location": "northeurope",
@@ -59,8 +98,11 @@ func TestConfig_Load_general(t *testing.T) {
 	}
 }`),
 			want: &Config{
-				Kind:    to.StrPtr("azks"),
-				Version: to.StrPtr("v0.0.1"),
+				Meta: &Meta{
+					Kind:          to.StrPtr("azksConfig"),
+					Version:       to.StrPtr("v0.1.0"),
+					ModuleVersion: to.StrPtr("v0.0.1"),
+				},
 				Params: &Params{
 					Location:           to.StrPtr("northeurope"),
 					Name:               to.StrPtr("epiphany"),
@@ -102,8 +144,11 @@ func TestConfig_Load_general(t *testing.T) {
 		{
 			name: "unknown fields in multiple places",
 			json: []byte(`{
-	"kind": "azks",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"extra_outer_field" : "extra_outer_value",
 	"params": {
 		"name": "epiphany",
@@ -142,8 +187,11 @@ func TestConfig_Load_general(t *testing.T) {
 	}
 }`),
 			want: &Config{
-				Kind:    to.StrPtr("azks"),
-				Version: to.StrPtr("v0.0.1"),
+				Meta: &Meta{
+					Kind:          to.StrPtr("azksConfig"),
+					Version:       to.StrPtr("v0.1.0"),
+					ModuleVersion: to.StrPtr("v0.0.1"),
+				},
 				Params: &Params{
 					Location:           to.StrPtr("northeurope"),
 					Name:               to.StrPtr("epiphany"),
@@ -179,24 +227,24 @@ func TestConfig_Load_general(t *testing.T) {
 					AdminUsername: to.StrPtr("operations"),
 				},
 				Unused: []string{"params.extra_inner_field", "extra_outer_field"},
+				Unknown: map[string]interface{}{
+					"params.extra_inner_field": "extra_inner_value",
+					"extra_outer_field":        "extra_outer_value",
+				},
 			},
 			wantErr: nil,
 		},
 		{
-			name: "empty json",
-			json: []byte(`{}`),
+			name: "ensure load is performing validation",
+			json: []byte(`{
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	}
+}`),
 			want: nil,
 			wantErr: test.TestValidationErrors{
-				test.TestValidationError{
-					Key:   "Config.Kind",
-					Field: "Kind",
-					Tag:   "required",
-				},
-				test.TestValidationError{
-					Key:   "Config.Version",
-					Field: "Version",
-					Tag:   "required",
-				},
 				test.TestValidationError{
 					Key:   "Config.Params",
 					Field: "Params",
@@ -207,8 +255,11 @@ func TestConfig_Load_general(t *testing.T) {
 		{
 			name: "major version mismatch",
 			json: []byte(`{
-"kind": "azks",
-"version": "100.0.0",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "100.0.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"location": "northeurope",
@@ -243,20 +294,17 @@ func TestConfig_Load_general(t *testing.T) {
 		"admin_username": "operations"
 	}
 }`),
-			want: nil,
-			wantErr: test.TestValidationErrors{
-				test.TestValidationError{
-					Key:   "Config.Version",
-					Field: "Version",
-					Tag:   "version",
-				},
-			},
+			want:    nil,
+			wantErr: shared.NotCurrentVersionError{Version: "100.0.0"},
 		},
 		{
 			name: "full json",
 			json: []byte(`{
-	"kind": "azks",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"location": "northeurope",
@@ -299,8 +347,11 @@ func TestConfig_Load_general(t *testing.T) {
 	}
 }`),
 			want: &Config{
-				Kind:    to.StrPtr("azks"),
-				Version: to.StrPtr("v0.0.1"),
+				Meta: &Meta{
+					Kind:          to.StrPtr("azksConfig"),
+					Version:       to.StrPtr("v0.1.0"),
+					ModuleVersion: to.StrPtr("v0.0.1"),
+				},
 				Params: &Params{
 					Location:           to.StrPtr("northeurope"),
 					Name:               to.StrPtr("epiphany"),
@@ -362,8 +413,11 @@ func TestConfig_Load_Params(t *testing.T) {
 		{
 			name: "missing params",
 			json: []byte(`{
-	"kind": "azks",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"default_node_pool": {
 			"size": 2,
@@ -457,8 +511,11 @@ func TestConfig_Load_Params(t *testing.T) {
 		{
 			name: "empty params",
 			json: []byte(`{
-	"kind": "azks",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "",
 		"location": "",
@@ -568,8 +625,11 @@ func TestConfig_Load_DefaultNodePool(t *testing.T) {
 		{
 			name: "missing default_node_pool",
 			json: []byte(`{
-	"kind": "azks",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"location": "northeurope",
@@ -614,8 +674,11 @@ func TestConfig_Load_DefaultNodePool(t *testing.T) {
 		{
 			name: "empty default_node_pool aka missing params",
 			json: []byte(`{
-	"kind": "azks",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"location": "northeurope",
@@ -691,8 +754,11 @@ func TestConfig_Load_DefaultNodePool(t *testing.T) {
 		{
 			name: "empty default_node_pool params",
 			json: []byte(`{
-	"kind": "azks",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"location": "northeurope",
@@ -756,8 +822,11 @@ func TestConfig_Load_DefaultNodePool(t *testing.T) {
 		{
 			name: "missing default_node_pool.min",
 			json: []byte(`{
-	"kind": "azks",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"location": "northeurope",
@@ -820,8 +889,11 @@ func TestConfig_Load_DefaultNodePool(t *testing.T) {
 		{
 			name: "missing default_node_pool.max",
 			json: []byte(`{
-	"kind": "azks",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"location": "northeurope",
@@ -879,8 +951,11 @@ func TestConfig_Load_DefaultNodePool(t *testing.T) {
 		{
 			name: "default_node_pool min > max",
 			json: []byte(`{
-	"kind": "azks",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"location": "northeurope",
@@ -939,8 +1014,11 @@ func TestConfig_Load_DefaultNodePool(t *testing.T) {
 		{
 			name: "default_node_pool size < min",
 			json: []byte(`{
-	"kind": "azks",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"location": "northeurope",
@@ -994,8 +1072,11 @@ func TestConfig_Load_DefaultNodePool(t *testing.T) {
 		{
 			name: "default_node_pool size > max",
 			json: []byte(`{
-	"kind": "azks",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"location": "northeurope",
@@ -1049,8 +1130,11 @@ func TestConfig_Load_DefaultNodePool(t *testing.T) {
 		{
 			name: "default_node_pool negative sizes",
 			json: []byte(`{
-	"kind": "azks",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"location": "northeurope",
@@ -1130,8 +1214,11 @@ func TestConfig_Load_AutoScalerProfile(t *testing.T) {
 		{
 			name: "missing auto_scaler_profile",
 			json: []byte(`{
-	"kind": "azks",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"location": "northeurope",
@@ -1174,8 +1261,11 @@ func TestConfig_Load_AutoScalerProfile(t *testing.T) {
 		{
 			name: "empty auto_scaler_profile aka missing params",
 			json: []byte(`{
-	"kind": "azks",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"location": "northeurope",
@@ -1259,8 +1349,11 @@ func TestConfig_Load_AutoScalerProfile(t *testing.T) {
 		{
 			name: "empty auto_scaler_profile params",
 			json: []byte(`{
-	"kind": "azks",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"location": "northeurope",
@@ -1365,8 +1458,11 @@ func TestConfig_Load_AzureAd(t *testing.T) {
 		{
 			name: "missing azure_ad",
 			json: []byte(`{
-	"kind": "azks",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"location": "northeurope",
@@ -1402,8 +1498,11 @@ func TestConfig_Load_AzureAd(t *testing.T) {
 	}
 }`),
 			want: &Config{
-				Kind:    to.StrPtr("azks"),
-				Version: to.StrPtr("v0.0.1"),
+				Meta: &Meta{
+					Kind:          to.StrPtr("azksConfig"),
+					Version:       to.StrPtr("v0.1.0"),
+					ModuleVersion: to.StrPtr("v0.0.1"),
+				},
 				Params: &Params{
 					Location:           to.StrPtr("northeurope"),
 					Name:               to.StrPtr("epiphany"),
@@ -1444,8 +1543,11 @@ func TestConfig_Load_AzureAd(t *testing.T) {
 		{
 			name: "null azure_ad",
 			json: []byte(`{
-	"kind": "azks",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"location": "northeurope",
@@ -1482,8 +1584,11 @@ func TestConfig_Load_AzureAd(t *testing.T) {
 	}
 }`),
 			want: &Config{
-				Kind:    to.StrPtr("azks"),
-				Version: to.StrPtr("v0.0.1"),
+				Meta: &Meta{
+					Kind:          to.StrPtr("azksConfig"),
+					Version:       to.StrPtr("v0.1.0"),
+					ModuleVersion: to.StrPtr("v0.0.1"),
+				},
 				Params: &Params{
 					Location:           to.StrPtr("northeurope"),
 					Name:               to.StrPtr("epiphany"),
@@ -1524,8 +1629,11 @@ func TestConfig_Load_AzureAd(t *testing.T) {
 		{
 			name: "empty azure_ad aka missing params",
 			json: []byte(`{
-	"kind": "azks",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"location": "northeurope",
@@ -1583,8 +1691,11 @@ func TestConfig_Load_AzureAd(t *testing.T) {
 		{
 			name: "empty azure_ad params",
 			json: []byte(`{
-	"kind": "azks",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"location": "northeurope",
@@ -1641,8 +1752,11 @@ func TestConfig_Load_AzureAd(t *testing.T) {
 		{
 			name: "empty azure_ad.admin_group_object_ids element",
 			json: []byte(`{
-	"kind": "azks",
-	"version": "v0.0.1",
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
 	"params": {
 		"name": "epiphany",
 		"location": "northeurope",
@@ -1702,17 +1816,274 @@ func TestConfig_Load_AzureAd(t *testing.T) {
 	}
 }
 
+func TestConfig_PrintRedacted(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	c := &Config{}
+	c.Init("v0.0.1")
+	c.Params.AzureAd = &AzureAd{
+		Managed:             to.BoolPtr(true),
+		TenantId:            to.StrPtr("123123123123"),
+		AdminGroupObjectIds: []string{"123123123123", "234234234234"},
+	}
+
+	plain, err := c.Print()
+	r.NoError(err)
+	redacted, err := c.PrintRedacted(shared.RedactOptions{Identifiers: true})
+	r.NoError(err)
+	a.NotContains(string(redacted), "123123123123")
+	a.NotContains(string(redacted), "234234234234")
+
+	// everything but masked values is the same
+	var want, got map[string]interface{}
+	r.NoError(json.Unmarshal(plain, &want))
+	r.NoError(json.Unmarshal(redacted, &got))
+	params := want["params"].(map[string]interface{})
+	params["rsa_pub_path"] = shared.RedactedValue
+	azureAd := params["azure_ad"].(map[string]interface{})
+	azureAd["tenant_id"] = shared.RedactedValue
+	azureAd["admin_group_object_ids"] = []interface{}{shared.RedactedValue, shared.RedactedValue}
+	a.Equal(want, got)
+
+	// identifiers are masked on request only
+	redacted, err = c.PrintRedacted(shared.RedactOptions{})
+	r.NoError(err)
+	a.Equal(string(plain), string(redacted))
+}
+
+func TestConfig_Upgrade(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    []byte
+		want    *Config
+		wantErr error
+	}{
+		{
+			name:    "happy path nothing to upgrade",
+			json:    []byte(minimalConfigJson),
+			want:    minimalConfig(),
+			wantErr: nil,
+		},
+		{
+			name: "upgrade v0.0.3 to v0.1.0",
+			json: []byte(`{
+	"kind": "azks",
+	"version": "v0.0.3",
+	"params": {
+		"name": "epiphany",
+		"location": "northeurope",
+		"rsa_pub_path": "some-name",
+		"rg_name": "epiphany-rg",
+		"vnet_name": "epiphany-vnet",
+		"subnet_name": "azks",
+		"kubernetes_version": "1.18.14",
+		"enable_node_public_ip": false,
+		"enable_rbac": false,
+		"default_node_pool": {
+			"size": 2,
+			"min": 2,
+			"max": 5,
+			"vm_size": "Standard_DS2_v2",
+			"disk_gb_size": 36,
+			"auto_scaling": true,
+			"type": "VirtualMachineScaleSets"
+		},
+		"auto_scaler_profile": {
+			"balance_similar_node_groups": false,
+			"max_graceful_termination_sec": "600",
+			"scale_down_delay_after_add": "10m",
+			"scale_down_delay_after_delete": "10s",
+			"scale_down_delay_after_failure": "10m",
+			"scan_interval": "10s",
+			"scale_down_unneeded": "10m",
+			"scale_down_unready": "10m",
+			"scale_down_utilization_threshold": "0.5"
+		},
+		"azure_ad": null,
+		"identity_type": "SystemAssigned",
+		"admin_username": "operations"
+	}
+}`),
+			want: func() *Config {
+				c := minimalConfig()
+				c.Meta.ModuleVersion = to.StrPtr("unknown")
+				return c
+			}(),
+			wantErr: nil,
+		},
+		{
+			name: "ensure that validation is also performed in upgrade",
+			json: []byte(`{
+	"kind": "azks",
+	"version": "v0.0.3"
+}`),
+			want: nil,
+			wantErr: test.TestValidationErrors{
+				test.TestValidationError{
+					Key:   "Config.Params",
+					Field: "Params",
+					Tag:   "required",
+				},
+			},
+		},
+		{
+			name: "some unknown version",
+			json: []byte(`{
+	"kind": "azks",
+	"version": "v0.0.2"
+}`),
+			want:    nil,
+			wantErr: errors.New("unknown version to upgrade"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			r := require.New(t)
+			p, err := createTempDocumentFile("azks-config-upgrade", tt.json)
+			r.NoError(err)
+			got := &Config{}
+			err = got.Upgrade(p)
+			if tt.wantErr != nil {
+				r.Error(err)
+				var errs validator.ValidationErrors
+				ok := errors.As(err, &errs)
+				if ok {
+					for _, e := range errs {
+						found := false
+						for _, we := range tt.wantErr.(test.TestValidationErrors) {
+							if we.Key == e.Namespace() && we.Tag == e.Tag() && we.Field == e.Field() {
+								found = true
+								break
+							}
+						}
+						if !found {
+							t.Errorf("Got unknown error:\n%s\nAll expected errors: \n%s", e.Error(), tt.wantErr.Error())
+						}
+					}
+					a.Equal(len(tt.wantErr.(test.TestValidationErrors)), len(errs))
+				} else {
+					a.Equal(tt.wantErr, err)
+				}
+			} else {
+				a.NoError(err)
+				wj, err2 := tt.want.Print()
+				a.NoError(err2)
+				gj, err2 := got.Print()
+				a.NoError(err2)
+				a.Equal(string(wj), string(gj))
+			}
+		})
+	}
+}
+
+const minimalConfigJson = `{
+	"meta": {
+		"kind": "azksConfig",
+		"version": "v0.1.0",
+		"module_version": "v0.0.1"
+	},
+	"params": {
+		"name": "epiphany",
+		"location": "northeurope",
+		"rsa_pub_path": "some-name",
+		"rg_name": "epiphany-rg",
+		"vnet_name": "epiphany-vnet",
+		"subnet_name": "azks",
+		"kubernetes_version": "1.18.14",
+		"enable_node_public_ip": false,
+		"enable_rbac": false,
+		"default_node_pool": {
+			"size": 2,
+			"min": 2,
+			"max": 5,
+			"vm_size": "Standard_DS2_v2",
+			"disk_gb_size": 36,
+			"auto_scaling": true,
+			"type": "VirtualMachineScaleSets"
+		},
+		"auto_scaler_profile": {
+			"balance_similar_node_groups": false,
+			"max_graceful_termination_sec": "600",
+			"scale_down_delay_after_add": "10m",
+			"scale_down_delay_after_delete": "10s",
+			"scale_down_delay_after_failure": "10m",
+			"scan_interval": "10s",
+			"scale_down_unneeded": "10m",
+			"scale_down_unready": "10m",
+			"scale_down_utilization_threshold": "0.5"
+		},
+		"azure_ad": null,
+		"identity_type": "SystemAssigned",
+		"admin_username": "operations"
+	}
+}`
+
+func minimalConfig() *Config {
+	return &Config{
+		Meta: &Meta{
+			Kind:          to.StrPtr("azksConfig"),
+			Version:       to.StrPtr("v0.1.0"),
+			ModuleVersion: to.StrPtr("v0.0.1"),
+		},
+		Params: &Params{
+			Name:               to.StrPtr("epiphany"),
+			Location:           to.StrPtr("northeurope"),
+			RsaPublicKeyPath:   to.StrPtr("some-name"),
+			RgName:             to.StrPtr("epiphany-rg"),
+			VnetName:           to.StrPtr("epiphany-vnet"),
+			SubnetName:         to.StrPtr("azks"),
+			KubernetesVersion:  to.StrPtr("1.18.14"),
+			EnableNodePublicIp: to.BoolPtr(false),
+			EnableRbac:         to.BoolPtr(false),
+			DefaultNodePool: &DefaultNodePool{
+				Size:        to.IntPtr(2),
+				Min:         to.IntPtr(2),
+				Max:         to.IntPtr(5),
+				VmSize:      to.StrPtr("Standard_DS2_v2"),
+				DiskGbSize:  to.IntPtr(36),
+				AutoScaling: to.BoolPtr(true),
+				Type:        to.StrPtr("VirtualMachineScaleSets"),
+			},
+			AutoScalerProfile: &AutoScalerProfile{
+				BalanceSimilarNodeGroups:      to.BoolPtr(false),
+				MaxGracefulTerminationSec:     to.StrPtr("600"),
+				ScaleDownDelayAfterAdd:        to.StrPtr("10m"),
+				ScaleDownDelayAfterDelete:     to.StrPtr("10s"),
+				ScaleDownDelayAfterFailure:    to.StrPtr("10m"),
+				ScanInterval:                  to.StrPtr("10s"),
+				ScaleDownUnneeded:             to.StrPtr("10m"),
+				ScaleDownUnready:              to.StrPtr("10m"),
+				ScaleDownUtilizationThreshold: to.StrPtr("0.5"),
+			},
+			IdentityType:  to.StrPtr("SystemAssigned"),
+			AdminUsername: to.StrPtr("operations"),
+		},
+		Unused: []string{},
+	}
+}
+
 func configLoadTestingBody(t *testing.T, json []byte, want *Config, wantErr error) {
+	p, err := createTempDocumentFile("azks-config-load", json)
+	if err != nil {
+		t.Fatal(err)
+	}
 	got := &Config{}
-	err := got.Unmarshal(json)
+	err = got.Load(p)
 
 	if wantErr != nil {
-
 		if err != nil {
 			if _, ok := err.(*validator.InvalidValidationError); ok {
 				t.Fatal(err)
 			}
-			errs := err.(validator.ValidationErrors)
+			var errs validator.ValidationErrors
+			ok := errors.As(err, &errs)
+			if !ok {
+				if diff := cmp.Diff(wantErr, err); diff != "" {
+					t.Errorf("Load() error mismatch (-want +got):\n%s", diff)
+				}
+				return
+			}
 			if len(errs) != len(wantErr.(test.TestValidationErrors)) {
 				t.Fatalf("incorrect length of found errors. Got: \n%s\nExpected: \n%s", errs.Error(), wantErr.Error())
 			}
@@ -1733,10 +2104,52 @@ func configLoadTestingBody(t *testing.T, json []byte, want *Config, wantErr erro
 		}
 	} else {
 		if diff := cmp.Diff(want, got); diff != "" {
-			t.Errorf("Unmarshal() mismatch (-want +got):\n%s", diff)
+			t.Errorf("Load() mismatch (-want +got):\n%s", diff)
 		}
 		if err != nil {
-			t.Errorf("Unmarshal() unexpected error occured: %v", err)
+			t.Errorf("Load() unexpected error occured: %v", err)
 		}
 	}
 }
+
+func createTempDocumentFile(name string, document []byte) (string, error) {
+	p, err := ioutil.TempDir("", fmt.Sprintf("e-structures-%s-*", name))
+	if err != nil {
+		return "", err
+	}
+	err = ioutil.WriteFile(filepath.Join(p, "file.json"), document, 0644)
+	return filepath.Join(p, "file.json"), err
+}
+
+func createTempDirectory(name string) (string, error) {
+	return ioutil.TempDir("", fmt.Sprintf("e-structures-%s-*", name))
+}
+
+func TestConfig_SerialValidationError(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	c := &Config{}
+	c.Init("v0.0.1")
+	c.Meta.Serial = to.IntPtr(3)
+	c.Meta.Hash = to.StrPtr("abc")
+
+	err := c.Validate()
+	var verr *shared.ValidationError
+	r.True(errors.As(err, &verr))
+	a.Equal(shared.FieldErrors{
+		{
+			Path:     "meta.serial",
+			Severity: shared.SeverityError,
+			Tag:      "excluded",
+			Value:    3,
+			Message:  "must not be set",
+		},
+		{
+			Path:     "meta.hash",
+			Severity: shared.SeverityError,
+			Tag:      "excluded",
+			Value:    "abc",
+			Message:  "must not be set",
+		},
+	}, verr.Fields)
+}
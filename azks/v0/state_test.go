@@ -0,0 +1,262 @@
+package v0
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/epiphany-platform/e-structures/shared"
+	"github.com/epiphany-platform/e-structures/storage"
+	"github.com/epiphany-platform/e-structures/utils/test"
+	"github.com/epiphany-platform/e-structures/utils/to"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestState_Init(t *testing.T) {
+	tests := []struct {
+		name          string
+		moduleVersion string
+		want          *State
+	}{
+		{
+			name:          "happy path",
+			moduleVersion: "v1.1.1",
+			want: &State{
+				Meta: &Meta{
+					Kind:          to.StrPtr("azksState"),
+					Version:       to.StrPtr("v0.0.1"),
+					ModuleVersion: to.StrPtr("v1.1.1"),
+				},
+				Status: shared.Initialized,
+				Config: nil,
+				Output: nil,
+				Unused: []string{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			got := &State{}
+			got.Init(tt.moduleVersion)
+			a.Equal(tt.want, got)
+		})
+	}
+}
+
+func TestState_Load(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    []byte
+		want    *State
+		wantErr error
+	}{
+		{
+			name: "happy path",
+			json: []byte(`{
+	"meta": {
+		"kind": "azksState",
+		"version": "v0.0.1",
+		"module_version": "v0.0.1"
+	},
+	"status": "applied",
+	"config": ` + minimalConfigJson + `,
+	"output": {
+		"kubeconfig": "apiVersion: v1\nkind: Config\n"
+	}
+}`),
+			want: &State{
+				Meta: &Meta{
+					Kind:          to.StrPtr("azksState"),
+					Version:       to.StrPtr("v0.0.1"),
+					ModuleVersion: to.StrPtr("v0.0.1"),
+				},
+				Status: shared.Applied,
+				Config: minimalConfig(),
+				Output: &Output{
+					KubeConfig: to.StrPtr("apiVersion: v1\nkind: Config\n"),
+				},
+				Unused: []string{},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "ensure load is performing validation",
+			json: []byte(`{
+	"meta": {
+		"kind": "azksState",
+		"version": "v0.0.1",
+		"module_version": "v0.0.1"
+	},
+	"status": "unknown"
+}`),
+			want: nil,
+			wantErr: test.TestValidationErrors{
+				test.TestValidationError{
+					Key:   "State.Status",
+					Field: "Status",
+					Tag:   "eq=initialized|eq=applied|eq=destroyed",
+				},
+			},
+		},
+		{
+			name: "not current version",
+			json: []byte(`{
+	"meta": {
+		"kind": "azksState",
+		"version": "v0.0.100",
+		"module_version": "v0.0.1"
+	},
+	"status": "initialized"
+}`),
+			want:    nil,
+			wantErr: shared.NotCurrentVersionError{Version: "v0.0.100"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			r := require.New(t)
+			p, err := createTempDocumentFile("azks-state-load", tt.json)
+			r.NoError(err)
+			got := &State{}
+			err = got.Load(p)
+			if tt.wantErr != nil {
+				r.Error(err)
+				var errs validator.ValidationErrors
+				ok := errors.As(err, &errs)
+				if ok {
+					for _, e := range errs {
+						found := false
+						for _, we := range tt.wantErr.(test.TestValidationErrors) {
+							if we.Key == e.Namespace() && we.Tag == e.Tag() && we.Field == e.Field() {
+								found = true
+								break
+							}
+						}
+						if !found {
+							t.Errorf("Got unknown error:\n%s\nAll expected errors: \n%s", e.Error(), tt.wantErr.Error())
+						}
+					}
+					a.Equal(len(tt.wantErr.(test.TestValidationErrors)), len(errs))
+				} else {
+					a.Equal(tt.wantErr, err)
+				}
+			} else {
+				a.NoError(err)
+				wj, err2 := tt.want.Print()
+				a.NoError(err2)
+				gj, err2 := got.Print()
+				a.NoError(err2)
+				a.Equal(string(wj), string(gj))
+				a.Equal(tt.want.GetOutput(), got.GetOutput())
+			}
+		})
+	}
+}
+
+func TestState_Upgrade(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    []byte
+		wantErr error
+	}{
+		{
+			name: "happy path nothing to upgrade",
+			json: []byte(`{
+	"meta": {
+		"kind": "azksState",
+		"version": "v0.0.1",
+		"module_version": "v0.0.1"
+	},
+	"status": "initialized"
+}`),
+			wantErr: nil,
+		},
+		{
+			name: "some unknown version",
+			json: []byte(`{
+	"meta": {
+		"kind": "azksState",
+		"version": "v0.0.100",
+		"module_version": "v0.0.1"
+	},
+	"status": "initialized"
+}`),
+			wantErr: errors.New("unknown version to upgrade"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			r := require.New(t)
+			p, err := createTempDocumentFile("azks-state-upgrade", tt.json)
+			r.NoError(err)
+			got := &State{}
+			err = got.Upgrade(p)
+			if tt.wantErr != nil {
+				a.Equal(tt.wantErr, err)
+			} else {
+				a.NoError(err)
+			}
+		})
+	}
+}
+
+func TestState_SaveSensitive(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	d, err := createTempDirectory("azks-state-sensitive")
+	r.NoError(err)
+	k, err := shared.GenerateKeyFile(filepath.Join(d, "key"))
+	r.NoError(err)
+
+	s := &State{}
+	s.Init("v0.0.1")
+	s.Output = &Output{KubeConfig: to.StrPtr("apiVersion: v1\nkind: Config\n")}
+	p := filepath.Join(d, "state.json")
+	r.NoError(s.Save(p, shared.EncryptWith(k)))
+	r.NoError(s.Backup(filepath.Join(d, "backup.json"), shared.EncryptWith(k)))
+	a.Equal("apiVersion: v1\nkind: Config\n", *s.Output.KubeConfig)
+	for _, f := range []string{"state.json", "backup.json"} {
+		b, err := ioutil.ReadFile(filepath.Join(d, f))
+		r.NoError(err)
+		a.NotContains(string(b), "kind: Config")
+		a.Contains(string(b), `"kubeconfig": "enc:v1:`+k.KeyID()+`:`)
+	}
+
+	got := &State{}
+	r.NoError(got.Load(p, shared.DecryptWith(k)))
+	a.Equal(s.Output, got.Output)
+
+	a.EqualError(got.Load(p), "Output: KubeConfig: value is encrypted but key provider is not set")
+}
+
+func TestState_SaveConflict(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	st := storage.NewMemory()
+	state := &State{}
+	state.Init("v0.0.1")
+	r.NoError(state.SaveTo(st, "state.json"))
+	serial, hash := state.GetSerial()
+	a.Equal(1, serial)
+	a.NotEmpty(hash)
+
+	other := &State{}
+	r.NoError(other.LoadFrom(st, "state.json"))
+	a.Equal(state.Meta.Hash, other.Meta.Hash)
+
+	state.Status = shared.Applied
+	r.NoError(state.SaveTo(st, "state.json"))
+	serial, _ = state.GetSerial()
+	a.Equal(2, serial)
+
+	err := other.SaveTo(st, "state.json")
+	a.Equal(shared.ConflictError{Path: "state.json", Expected: 1, Found: 2}, err)
+	serial, _ = other.GetSerial()
+	a.Equal(1, serial)
+}
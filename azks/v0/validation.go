@@ -0,0 +1,20 @@
+package v0
+
+import (
+	"github.com/go-playground/validator/v10"
+)
+
+// AzKSConfigMetaValidation checks that config doesn't carry serial and hash. They are kept only in state
+// (see State.Save) and wouldn't be checked or updated when set in config file.
+func AzKSConfigMetaValidation(sl validator.StructLevel) {
+	config := sl.Current().Interface().(Config)
+	if config.Meta == nil {
+		return
+	}
+	if config.Meta.Serial != nil {
+		sl.ReportError(*config.Meta.Serial, "Meta.Serial", "Serial", "excluded", "")
+	}
+	if config.Meta.Hash != nil {
+		sl.ReportError(*config.Meta.Hash, "Meta.Hash", "Hash", "excluded", "")
+	}
+}
@@ -1,11 +1,22 @@
 module github.com/epiphany-platform/e-structures
 
-go 1.15
+go 1.18
 
 require (
 	github.com/Masterminds/semver v1.5.0
 	github.com/go-playground/validator/v10 v10.4.1
 	github.com/google/go-cmp v0.5.3
 	github.com/mitchellh/mapstructure v1.3.3
-	github.com/stretchr/testify v1.6.1 // indirect
+	github.com/stretchr/testify v1.10.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/go-playground/locales v0.13.0 // indirect
+	github.com/go-playground/universal-translator v0.17.0 // indirect
+	github.com/leodido/go-urn v1.2.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9 // indirect
+	golang.org/x/sys v0.0.0-20190412213103-97732733099d // indirect
 )
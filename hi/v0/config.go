@@ -0,0 +1,205 @@
+package v0
+
+import (
+	"errors"
+
+	"github.com/epiphany-platform/e-structures/shared"
+	"github.com/epiphany-platform/e-structures/storage"
+	"github.com/epiphany-platform/e-structures/utils/to"
+	"github.com/epiphany-platform/e-structures/utils/validators"
+	"github.com/go-playground/validator/v10"
+)
+
+type Config struct {
+	Meta    *Meta                  `json:"meta" validate:"required"`
+	Params  *Params                `json:"params" validate:"required"`
+	Unused  []string               `json:"-"`
+	Unknown map[string]interface{} `json:"-"`
+}
+
+func (c *Config) Init(moduleVersion string) {
+	*c = Config{
+		Meta: &Meta{
+			Kind:          to.StrPtr(configKind),
+			Version:       to.StrPtr(configVersion),
+			ModuleVersion: to.StrPtr(moduleVersion),
+		},
+		Params: &Params{
+			VmGroups: []VmGroup{
+				{
+					Name:      to.StrPtr("vm-group0"),
+					AdminUser: to.StrPtr("operations"),
+					Hosts: []Host{
+						{
+							Name: to.StrPtr("epiphany-vm-group0-1"),
+							Ip:   to.StrPtr("10.0.1.4"),
+						},
+					},
+					MountPoints: []MountPoint{
+						{
+							Lun:  to.IntPtr(10),
+							Path: to.StrPtr("/data/test"),
+						},
+					},
+				},
+			},
+			RsaPrivateKeyPath: to.StrPtr("/shared/vms_rsa"),
+		},
+		Unused: []string{},
+	}
+}
+
+func (c *Config) Backup(path string, options ...shared.EncodeOption) error {
+	return shared.Backup(c, path, options...)
+}
+
+func (c *Config) BackupRaw(path, new string) error {
+	_, err := shared.BackupRaw(path, new)
+	return err
+}
+
+func (c *Config) BackupTo(st storage.Storage, name string, options ...shared.EncodeOption) error {
+	return shared.BackupTo(c, st, name, options...)
+}
+
+func (c *Config) BackupRawTo(st storage.Storage, name, new string) error {
+	_, err := shared.BackupRawTo(st, name, st, new)
+	return err
+}
+
+func (c *Config) Load(path string, options ...shared.DecodeOption) error {
+	return shared.Load(c, path, configVersion, options...)
+}
+
+func (c *Config) LoadFrom(st storage.Storage, name string, options ...shared.DecodeOption) error {
+	return shared.LoadFrom(c, st, name, configVersion, options...)
+}
+
+func (c *Config) Save(path string, options ...shared.EncodeOption) error {
+	return shared.Save(c, path, options...)
+}
+
+func (c *Config) SaveTo(st storage.Storage, name string, options ...shared.EncodeOption) error {
+	return shared.SaveTo(c, st, name, options...)
+}
+
+func (c *Config) Print(options ...shared.EncodeOption) ([]byte, error) {
+	return shared.Print(c, options...)
+}
+
+func (c *Config) PrintYAML(options ...shared.EncodeOption) ([]byte, error) {
+	return shared.PrintYAML(c, options...)
+}
+
+func (c *Config) PrintRedacted(options shared.RedactOptions) ([]byte, error) {
+	return shared.PrintRedacted(c, options)
+}
+
+func (c *Config) Validate() error {
+	if c == nil {
+		return errors.New("expected config is nil")
+	}
+	validate := validator.New()
+
+	err := validate.RegisterValidation("version", validators.HasVersion)
+	if err != nil {
+		return err
+	}
+	validate.RegisterStructValidation(HiConfigMetaValidation, Config{})
+	err = validate.Struct(c)
+	if err != nil {
+		if _, ok := err.(*validator.InvalidValidationError); ok {
+			return err
+		}
+		return shared.NewValidationError(c, err)
+	}
+	return nil
+}
+
+func (c *Config) Lint() shared.FieldErrors {
+	if c == nil {
+		return nil
+	}
+	return shared.Lint(c, c.Unused, c.Meta.suppressed())
+}
+
+func (c *Config) Upgrade(path string, options ...shared.DecodeOption) error {
+	return shared.Upgrade(c, path, options...)
+}
+
+func (c *Config) UpgradeFrom(st storage.Storage, name string, options ...shared.DecodeOption) error {
+	return shared.UpgradeFrom(c, st, name, options...)
+}
+
+func (c *Config) UpgradeFunc(input map[string]interface{}) error {
+	_, err := configMigrations.Migrate(input)
+	return err
+}
+
+func (c *Config) Downgrade(path, backup, targetVersion string, force bool) error {
+	_, err := shared.Downgrade(configMigrations, path, backup, targetVersion, force)
+	return err
+}
+
+func (c *Config) DowngradeFrom(st storage.Storage, name, backup, targetVersion string, force bool) error {
+	_, err := shared.DowngradeFrom(configMigrations, st, name, backup, targetVersion, force)
+	return err
+}
+
+func (c *Config) SetUnused(unused []string) {
+	c.Unused = unused
+}
+
+func (c *Config) SetUnknown(unknown map[string]interface{}) {
+	c.Unknown = unknown
+}
+
+func (c *Config) GetUnknown() map[string]interface{} {
+	return c.Unknown
+}
+
+func (c *Config) GetParams() *Params {
+	if c == nil {
+		return nil
+	}
+	return c.Params
+}
+
+type Meta struct {
+	Kind          *string `json:"kind" validate:"required,eq=hiConfig|eq=hiState"`
+	Version       *string `json:"version" validate:"required,version=~0"`
+	ModuleVersion *string `json:"module_version" validate:"required"`
+	Serial        *int    `json:"serial,omitempty" validate:"omitempty,min=0"`
+	Hash          *string `json:"hash,omitempty"`
+	// SuppressWarnings lists codes of lint findings which shouldn't be reported for document.
+	SuppressWarnings []string `json:"suppress_warnings,omitempty" validate:"omitempty,dive,min=1"`
+}
+
+func (m *Meta) suppressed() []string {
+	if m == nil {
+		return nil
+	}
+	return m.SuppressWarnings
+}
+
+type MountPoint struct {
+	Lun  *int    `json:"lun" validate:"required,min=0"`
+	Path *string `json:"path" validate:"required,min=1"`
+}
+
+type Host struct {
+	Name *string `json:"name" validate:"required,min=1"`
+	Ip   *string `json:"ip" validate:"required,min=1" redact:"identifier"`
+}
+
+type VmGroup struct {
+	Name        *string      `json:"name" validate:"required,min=1"`
+	AdminUser   *string      `json:"admin_user" validate:"required,min=1"`
+	Hosts       []Host       `json:"hosts" validate:"required,min=1,dive"`
+	MountPoints []MountPoint `json:"mount_point" validate:"omitempty,dive"`
+}
+
+type Params struct {
+	VmGroups          []VmGroup `json:"vm_groups" validate:"required,dive"`
+	RsaPrivateKeyPath *string   `json:"rsa_private_path" validate:"required,min=1" redact:"identifier"`
+}
@@ -1,14 +1,73 @@
 package v0
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
+	"github.com/epiphany-platform/e-structures/shared"
 	"github.com/epiphany-platform/e-structures/utils/test"
 	"github.com/epiphany-platform/e-structures/utils/to"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+func TestConfig_Init(t *testing.T) {
+	tests := []struct {
+		name          string
+		moduleVersion string
+		want          *Config
+	}{
+		{
+			name:          "happy path",
+			moduleVersion: "v1.1.1",
+			want: &Config{
+				Meta: &Meta{
+					Kind:          to.StrPtr("hiConfig"),
+					Version:       to.StrPtr("v0.1.0"),
+					ModuleVersion: to.StrPtr("v1.1.1"),
+				},
+				Params: &Params{
+					VmGroups: []VmGroup{
+						{
+							Name:      to.StrPtr("vm-group0"),
+							AdminUser: to.StrPtr("operations"),
+							Hosts: []Host{
+								{
+									Name: to.StrPtr("epiphany-vm-group0-1"),
+									Ip:   to.StrPtr("10.0.1.4"),
+								},
+							},
+							MountPoints: []MountPoint{
+								{
+									Lun:  to.IntPtr(10),
+									Path: to.StrPtr("/data/test"),
+								},
+							},
+						},
+					},
+					RsaPrivateKeyPath: to.StrPtr("/shared/vms_rsa"),
+				},
+				Unused: []string{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			got := &Config{}
+			got.Init(tt.moduleVersion)
+			a.Equal(tt.want, got)
+			a.NoError(got.Validate())
+		})
+	}
+}
+
 func TestConfig_Load_General(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -19,8 +78,11 @@ func TestConfig_Load_General(t *testing.T) {
 		{
 			name: "happy path",
 			json: []byte(`{
-  "kind": "hi",
-  "version": "v0.0.1",
+  "meta": {
+    "kind": "hiConfig",
+    "version": "v0.1.0",
+    "module_version": "v0.0.1"
+  },
   "params": {
     "vm_groups": [
       {
@@ -45,8 +107,11 @@ func TestConfig_Load_General(t *testing.T) {
 }
 `),
 			want: &Config{
-				Kind:    to.StrPtr(kind),
-				Version: to.StrPtr(version),
+				Meta: &Meta{
+					Kind:          to.StrPtr("hiConfig"),
+					Version:       to.StrPtr("v0.1.0"),
+					ModuleVersion: to.StrPtr("v0.0.1"),
+				},
 				Params: &Params{
 					VmGroups: []VmGroup{
 						{
@@ -75,8 +140,11 @@ func TestConfig_Load_General(t *testing.T) {
 		{
 			name: "unknown fields in multiple places",
 			json: []byte(`{
-  "kind": "hi",
-  "version": "v0.0.1",
+  "meta": {
+    "kind": "hiConfig",
+    "version": "v0.1.0",
+    "module_version": "v0.0.1"
+  },
   "extra_outer_field" : "extra_outer_value",
   "params": {
     "extra_inner_field" : "extra_inner_value",
@@ -103,8 +171,11 @@ func TestConfig_Load_General(t *testing.T) {
 }
 `),
 			want: &Config{
-				Kind:    to.StrPtr(kind),
-				Version: to.StrPtr(version),
+				Meta: &Meta{
+					Kind:          to.StrPtr("hiConfig"),
+					Version:       to.StrPtr("v0.1.0"),
+					ModuleVersion: to.StrPtr("v0.0.1"),
+				},
 				Params: &Params{
 					VmGroups: []VmGroup{
 						{
@@ -127,24 +198,24 @@ func TestConfig_Load_General(t *testing.T) {
 					RsaPrivateKeyPath: to.StrPtr("/shared/vms_rsa"),
 				},
 				Unused: []string{"params.extra_inner_field", "extra_outer_field"},
+				Unknown: map[string]interface{}{
+					"params.extra_inner_field": "extra_inner_value",
+					"extra_outer_field":        "extra_outer_value",
+				},
 			},
 			wantErr: nil,
 		},
 		{
-			name: "empty json",
-			json: []byte(`{}`),
+			name: "ensure load is performing validation",
+			json: []byte(`{
+  "meta": {
+    "kind": "hiConfig",
+    "version": "v0.1.0",
+    "module_version": "v0.0.1"
+  }
+}`),
 			want: nil,
 			wantErr: test.TestValidationErrors{
-				test.TestValidationError{
-					Key:   "Config.Kind",
-					Field: "Kind",
-					Tag:   "required",
-				},
-				test.TestValidationError{
-					Key:   "Config.Version",
-					Field: "Version",
-					Tag:   "required",
-				},
 				test.TestValidationError{
 					Key:   "Config.Params",
 					Field: "Params",
@@ -155,8 +226,11 @@ func TestConfig_Load_General(t *testing.T) {
 		{
 			name: "minimal correct json",
 			json: []byte(`{
-  "kind": "hi",
-  "version": "v0.0.1",
+  "meta": {
+    "kind": "hiConfig",
+    "version": "v0.1.0",
+    "module_version": "v0.0.1"
+  },
   "params": {
     "vm_groups": [],
     "rsa_private_path": "/shared/vms_rsa"
@@ -164,8 +238,11 @@ func TestConfig_Load_General(t *testing.T) {
 }
 `),
 			want: &Config{
-				Kind:    to.StrPtr(kind),
-				Version: to.StrPtr(version),
+				Meta: &Meta{
+					Kind:          to.StrPtr("hiConfig"),
+					Version:       to.StrPtr("v0.1.0"),
+					ModuleVersion: to.StrPtr("v0.0.1"),
+				},
 				Params: &Params{
 					VmGroups:          []VmGroup{},
 					RsaPrivateKeyPath: to.StrPtr("/shared/vms_rsa"),
@@ -177,66 +254,53 @@ func TestConfig_Load_General(t *testing.T) {
 		{
 			name: "major version mismatch",
 			json: []byte(`{
-  "kind": "hi",
-  "version": "v100.0.1",
+  "meta": {
+    "kind": "hiConfig",
+    "version": "v100.0.1",
+    "module_version": "v0.0.1"
+  },
   "params": {
     "vm_groups": [],
     "rsa_private_path": "/shared/vms_rsa"
   }
 }
 `),
-			want: nil,
-			wantErr: test.TestValidationErrors{
-				test.TestValidationError{
-					Key:   "Config.Version",
-					Field: "Version",
-					Tag:   "version",
-				},
-			},
+			want:    nil,
+			wantErr: shared.NotCurrentVersionError{Version: "v100.0.1"},
 		},
 		{
 			name: "minor version mismatch",
 			json: []byte(`{
-  "kind": "hi",
-  "version": "v0.100.1",
+  "meta": {
+    "kind": "hiConfig",
+    "version": "v0.100.1",
+    "module_version": "v0.0.1"
+  },
   "params": {
     "vm_groups": [],
     "rsa_private_path": "/shared/vms_rsa"
   }
 }
 `),
-			want: &Config{
-				Kind:    to.StrPtr(kind),
-				Version: to.StrPtr("v0.100.1"),
-				Params: &Params{
-					VmGroups:          []VmGroup{},
-					RsaPrivateKeyPath: to.StrPtr("/shared/vms_rsa"),
-				},
-				Unused: []string{},
-			},
-			wantErr: nil,
+			want:    nil,
+			wantErr: shared.NotCurrentVersionError{Version: "v0.100.1"},
 		},
 		{
 			name: "patch version mismatch",
 			json: []byte(`{
-  "kind": "hi",
-  "version": "v0.0.100",
+  "meta": {
+    "kind": "hiConfig",
+    "version": "v0.0.100",
+    "module_version": "v0.0.1"
+  },
   "params": {
     "vm_groups": [],
     "rsa_private_path": "/shared/vms_rsa"
   }
 }
 `),
-			want: &Config{
-				Kind:    to.StrPtr(kind),
-				Version: to.StrPtr("v0.0.100"),
-				Params: &Params{
-					VmGroups:          []VmGroup{},
-					RsaPrivateKeyPath: to.StrPtr("/shared/vms_rsa"),
-				},
-				Unused: []string{},
-			},
-			wantErr: nil,
+			want:    nil,
+			wantErr: shared.NotCurrentVersionError{Version: "v0.0.100"},
 		},
 	}
 	for _, tt := range tests {
@@ -256,8 +320,11 @@ func TestConfig_Load_Params(t *testing.T) {
 		{
 			name: "nothing in params",
 			json: []byte(`{
-  "kind": "hi",
-  "version": "v0.0.1",
+  "meta": {
+    "kind": "hiConfig",
+    "version": "v0.1.0",
+    "module_version": "v0.0.1"
+  },
   "params": {}
 }
 `),
@@ -278,8 +345,11 @@ func TestConfig_Load_Params(t *testing.T) {
 		{
 			name: "empty params elements",
 			json: []byte(`{
-  "kind": "hi",
-  "version": "v0.0.1",
+  "meta": {
+    "kind": "hiConfig",
+    "version": "v0.1.0",
+    "module_version": "v0.0.1"
+  },
   "params": {
     "vm_groups": [],
     "rsa_private_path": ""
@@ -313,8 +383,11 @@ func TestConfig_Load_VmGroups(t *testing.T) {
 		{
 			name: "empty vm groups elements",
 			json: []byte(`{
-  "kind": "hi",
-  "version": "v0.0.1",
+  "meta": {
+    "kind": "hiConfig",
+    "version": "v0.1.0",
+    "module_version": "v0.0.1"
+  },
   "params": {
     "vm_groups": [
       {
@@ -349,8 +422,11 @@ func TestConfig_Load_VmGroups(t *testing.T) {
 		{
 			name: "empty vm groups arrays elements",
 			json: []byte(`{
-  "kind": "hi",
-  "version": "v0.0.1",
+  "meta": {
+    "kind": "hiConfig",
+    "version": "v0.1.0",
+    "module_version": "v0.0.1"
+  },
   "params": {
     "vm_groups": [
       {
@@ -395,8 +471,11 @@ func TestConfig_Load_VmGroups(t *testing.T) {
 		{
 			name: "empty vm groups arrays object elements",
 			json: []byte(`{
-  "kind": "hi",
-  "version": "v0.0.1",
+  "meta": {
+    "kind": "hiConfig",
+    "version": "v0.1.0",
+    "module_version": "v0.0.1"
+  },
   "params": {
     "vm_groups": [
       {
@@ -452,16 +531,154 @@ func TestConfig_Load_VmGroups(t *testing.T) {
 	}
 }
 
+func TestConfig_Upgrade(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    []byte
+		want    *Config
+		wantErr error
+	}{
+		{
+			name: "happy path nothing to upgrade",
+			json: []byte(`{
+  "meta": {
+    "kind": "hiConfig",
+    "version": "v0.1.0",
+    "module_version": "v0.0.1"
+  },
+  "params": {
+    "vm_groups": [],
+    "rsa_private_path": "/shared/vms_rsa"
+  }
+}
+`),
+			want: &Config{
+				Meta: &Meta{
+					Kind:          to.StrPtr("hiConfig"),
+					Version:       to.StrPtr("v0.1.0"),
+					ModuleVersion: to.StrPtr("v0.0.1"),
+				},
+				Params: &Params{
+					VmGroups:          []VmGroup{},
+					RsaPrivateKeyPath: to.StrPtr("/shared/vms_rsa"),
+				},
+				Unused: []string{},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "upgrade v0.0.1 to v0.1.0",
+			json: []byte(`{
+  "kind": "hi",
+  "version": "v0.0.1",
+  "params": {
+    "vm_groups": [],
+    "rsa_private_path": "/shared/vms_rsa"
+  }
+}
+`),
+			want: &Config{
+				Meta: &Meta{
+					Kind:          to.StrPtr("hiConfig"),
+					Version:       to.StrPtr("v0.1.0"),
+					ModuleVersion: to.StrPtr("unknown"),
+				},
+				Params: &Params{
+					VmGroups:          []VmGroup{},
+					RsaPrivateKeyPath: to.StrPtr("/shared/vms_rsa"),
+				},
+				Unused: []string{},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "ensure that validation is also performed in upgrade",
+			json: []byte(`{
+  "kind": "hi",
+  "version": "v0.0.1",
+  "params": {
+    "vm_groups": []
+  }
+}
+`),
+			want: nil,
+			wantErr: test.TestValidationErrors{
+				test.TestValidationError{
+					Key:   "Config.Params.RsaPrivateKeyPath",
+					Field: "RsaPrivateKeyPath",
+					Tag:   "required",
+				},
+			},
+		},
+		{
+			name: "some unknown version",
+			json: []byte(`{
+  "kind": "hi",
+  "version": "v0.0.100"
+}
+`),
+			want:    nil,
+			wantErr: errors.New("unknown version to upgrade"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			r := require.New(t)
+			p, err := createTempDocumentFile("hi-config-upgrade", tt.json)
+			r.NoError(err)
+			got := &Config{}
+			err = got.Upgrade(p)
+			if tt.wantErr != nil {
+				r.Error(err)
+				var errs validator.ValidationErrors
+				ok := errors.As(err, &errs)
+				if ok {
+					for _, e := range errs {
+						found := false
+						for _, we := range tt.wantErr.(test.TestValidationErrors) {
+							if we.Key == e.Namespace() && we.Tag == e.Tag() && we.Field == e.Field() {
+								found = true
+								break
+							}
+						}
+						if !found {
+							t.Errorf("Got unknown error:\n%s\nAll expected errors: \n%s", e.Error(), tt.wantErr.Error())
+						}
+					}
+					a.Equal(len(tt.wantErr.(test.TestValidationErrors)), len(errs))
+				} else {
+					a.Equal(tt.wantErr, err)
+				}
+			} else {
+				a.NoError(err)
+				a.Equal(tt.want, got)
+			}
+		})
+	}
+}
+
 func configLoadTestingBody(t *testing.T, json []byte, want *Config, wantErr error) {
+	p, err := createTempDocumentFile("hi-config-load", json)
+	if err != nil {
+		t.Fatal(err)
+	}
 	got := &Config{}
-	err := got.Unmarshal(json)
+	err = got.Load(p)
 
 	if wantErr != nil {
 		if err != nil {
 			if _, ok := err.(*validator.InvalidValidationError); ok {
 				t.Fatal(err)
 			}
-			errs := err.(validator.ValidationErrors)
+			var errs validator.ValidationErrors
+			ok := errors.As(err, &errs)
+			if !ok {
+				if diff := cmp.Diff(wantErr, err); diff != "" {
+					t.Errorf("Load() error mismatch (-want +got):\n%s", diff)
+				}
+				return
+			}
 			if len(errs) != len(wantErr.(test.TestValidationErrors)) {
 				t.Fatalf("incorrect length of found errors. Got: \n%s\nExpected: \n%s", errs.Error(), wantErr.Error())
 			}
@@ -482,10 +699,81 @@ func configLoadTestingBody(t *testing.T, json []byte, want *Config, wantErr erro
 		}
 	} else {
 		if diff := cmp.Diff(want, got); diff != "" {
-			t.Errorf("Unmarshal() mismatch (-want +got):\n%s", diff)
+			t.Errorf("Load() mismatch (-want +got):\n%s", diff)
 		}
 		if err != nil {
-			t.Errorf("Unmarshal() unexpected error occured: %v", err)
+			t.Errorf("Load() unexpected error occured: %v", err)
 		}
 	}
 }
+
+func createTempDocumentFile(name string, document []byte) (string, error) {
+	p, err := ioutil.TempDir("", fmt.Sprintf("e-structures-%s-*", name))
+	if err != nil {
+		return "", err
+	}
+	err = ioutil.WriteFile(filepath.Join(p, "file.json"), document, 0644)
+	return filepath.Join(p, "file.json"), err
+}
+
+func createTempDirectory(name string) (string, error) {
+	return ioutil.TempDir("", fmt.Sprintf("e-structures-%s-*", name))
+}
+
+func TestConfig_SerialValidationError(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	c := &Config{}
+	c.Init("v0.0.1")
+	c.Meta.Serial = to.IntPtr(3)
+	c.Meta.Hash = to.StrPtr("abc")
+
+	err := c.Validate()
+	var verr *shared.ValidationError
+	r.True(errors.As(err, &verr))
+	a.Equal(shared.FieldErrors{
+		{
+			Path:     "meta.serial",
+			Severity: shared.SeverityError,
+			Tag:      "excluded",
+			Value:    3,
+			Message:  "must not be set",
+		},
+		{
+			Path:     "meta.hash",
+			Severity: shared.SeverityError,
+			Tag:      "excluded",
+			Value:    "abc",
+			Message:  "must not be set",
+		},
+	}, verr.Fields)
+}
+
+func TestConfig_PrintRedacted(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	c := &Config{}
+	c.Init("v0.0.1")
+
+	plain, err := c.Print()
+	r.NoError(err)
+	redacted, err := c.PrintRedacted(shared.RedactOptions{Identifiers: true})
+	r.NoError(err)
+	a.NotContains(string(redacted), "/shared/vms_rsa")
+	a.NotContains(string(redacted), "10.0.1.4")
+
+	// everything but masked values is the same
+	var want, got map[string]interface{}
+	r.NoError(json.Unmarshal(plain, &want))
+	r.NoError(json.Unmarshal(redacted, &got))
+	params := want["params"].(map[string]interface{})
+	params["rsa_private_path"] = shared.RedactedValue
+	host := params["vm_groups"].([]interface{})[0].(map[string]interface{})["hosts"].([]interface{})[0].(map[string]interface{})
+	host["ip"] = shared.RedactedValue
+	a.Equal(want, got)
+
+	// identifiers are masked on request only
+	redacted, err = c.PrintRedacted(shared.RedactOptions{})
+	r.NoError(err)
+	a.Equal(string(plain), string(redacted))
+}
@@ -0,0 +1,16 @@
+package v0
+
+import (
+	"github.com/epiphany-platform/e-structures/shared"
+)
+
+var configMigrations = shared.NewMigrations(configVersion,
+	shared.MetaMigration("v0.0.1", "v0.1.0", configKind, "hi"),
+)
+
+var stateMigrations = shared.NewMigrations(stateVersion)
+
+// ConfigMigrations returns migrations of hi config, i.e. to migrate config embedded in other structures.
+func ConfigMigrations() *shared.Migrations {
+	return configMigrations
+}
@@ -0,0 +1,224 @@
+package v0
+
+import (
+	"errors"
+
+	"github.com/epiphany-platform/e-structures/shared"
+	"github.com/epiphany-platform/e-structures/storage"
+	"github.com/epiphany-platform/e-structures/utils/to"
+	"github.com/epiphany-platform/e-structures/utils/validators"
+	"github.com/go-playground/validator/v10"
+)
+
+type State struct {
+	Meta    *Meta                  `json:"meta" validate:"required"`
+	Status  shared.Status          `json:"status" validate:"required,eq=initialized|eq=applied|eq=destroyed"`
+	Config  *Config                `json:"config" validate:"omitempty"`
+	Output  *Output                `json:"output" validate:"omitempty"`
+	Unused  []string               `json:"-"`
+	Unknown map[string]interface{} `json:"-"`
+}
+
+func (s *State) Init(moduleVersion string) {
+	*s = State{
+		Meta: &Meta{
+			Kind:          to.StrPtr(stateKind),
+			Version:       to.StrPtr(stateVersion),
+			ModuleVersion: to.StrPtr(moduleVersion),
+		},
+		Status: shared.Initialized,
+		Config: nil,
+		Output: nil,
+		Unused: []string{},
+	}
+}
+
+func (s *State) Backup(path string, options ...shared.EncodeOption) error {
+	return shared.Backup(s, path, options...)
+}
+
+func (s *State) BackupRaw(path, new string) error {
+	_, err := shared.BackupRaw(path, new)
+	return err
+}
+
+func (s *State) BackupTo(st storage.Storage, name string, options ...shared.EncodeOption) error {
+	return shared.BackupTo(s, st, name, options...)
+}
+
+func (s *State) BackupRawTo(st storage.Storage, name, new string) error {
+	_, err := shared.BackupRawTo(st, name, st, new)
+	return err
+}
+
+func (s *State) Load(path string, options ...shared.DecodeOption) error {
+	return shared.Load(s, path, stateVersion, options...)
+}
+
+func (s *State) LoadFrom(st storage.Storage, name string, options ...shared.DecodeOption) error {
+	return shared.LoadFrom(s, st, name, stateVersion, options...)
+}
+
+func (s *State) Save(path string, options ...shared.EncodeOption) error {
+	return shared.SaveSerialized(s, path, func() ([]byte, error) {
+		return s.Print(options...)
+	}, options...)
+}
+
+func (s *State) SaveTo(st storage.Storage, name string, options ...shared.EncodeOption) error {
+	return shared.SaveSerializedTo(s, st, name, func() ([]byte, error) {
+		return s.Print(options...)
+	}, options...)
+}
+
+func (s *State) Print(options ...shared.EncodeOption) ([]byte, error) {
+	return shared.Print(s, options...)
+}
+
+func (s *State) PrintYAML(options ...shared.EncodeOption) ([]byte, error) {
+	return shared.PrintYAML(s, options...)
+}
+
+func (s *State) PrintRedacted(options shared.RedactOptions) ([]byte, error) {
+	return shared.PrintRedacted(s, options)
+}
+
+func (s *State) Validate() error {
+	if s == nil {
+		return errors.New("expected state is nil")
+	}
+	validate := validator.New()
+	err := validate.RegisterValidation("version", validators.HasVersion)
+	if err != nil {
+		return err
+	}
+	err = validate.Struct(s)
+	if err != nil {
+		if _, ok := err.(*validator.InvalidValidationError); ok {
+			return err
+		}
+		return shared.NewValidationError(s, err)
+	}
+	return nil
+}
+
+func (s *State) Lint() shared.FieldErrors {
+	if s == nil {
+		return nil
+	}
+	return shared.Lint(s, s.Unused, s.Meta.suppressed())
+}
+
+func (s *State) Upgrade(path string, options ...shared.DecodeOption) error {
+	return shared.Upgrade(s, path, options...)
+}
+
+func (s *State) UpgradeFrom(st storage.Storage, name string, options ...shared.DecodeOption) error {
+	return shared.UpgradeFrom(s, st, name, options...)
+}
+
+func (s *State) UpgradeFunc(input map[string]interface{}) error {
+	_, err := stateMigrations.Migrate(input)
+	return err
+}
+
+func (s *State) Downgrade(path, backup, targetVersion string, force bool) error {
+	_, err := shared.Downgrade(stateMigrations, path, backup, targetVersion, force)
+	return err
+}
+
+func (s *State) DowngradeFrom(st storage.Storage, name, backup, targetVersion string, force bool) error {
+	_, err := shared.DowngradeFrom(stateMigrations, st, name, backup, targetVersion, force)
+	return err
+}
+
+func (s *State) SetUnused(unused []string) {
+	s.Unused = unused
+}
+
+func (s *State) SetUnknown(unknown map[string]interface{}) {
+	s.Unknown = unknown
+}
+
+func (s *State) GetUnknown() map[string]interface{} {
+	return s.Unknown
+}
+
+func (s *State) GetSerial() (int, string) {
+	if s == nil || s.Meta == nil {
+		return 0, ""
+	}
+	serial, hash := 0, ""
+	if s.Meta.Serial != nil {
+		serial = *s.Meta.Serial
+	}
+	if s.Meta.Hash != nil {
+		hash = *s.Meta.Hash
+	}
+	return serial, hash
+}
+
+func (s *State) SetSerial(serial int, hash string) {
+	if s.Meta == nil {
+		// structure without meta is not valid and won't be saved anyway
+		return
+	}
+	s.Meta.Serial = to.IntPtr(serial)
+	s.Meta.Hash = nil
+	if hash != "" {
+		s.Meta.Hash = to.StrPtr(hash)
+	}
+}
+
+func (s *State) GetConfig() *Config {
+	if s == nil {
+		return nil
+	}
+	return s.Config
+}
+
+func (s *State) GetOutput() *Output {
+	if s == nil {
+		return nil
+	}
+	return s.Output
+}
+
+// Output records outcome of host initialization per VmGroup and per host.
+type Output struct {
+	VmGroups []OutputVmGroup `json:"vm_groups"`
+}
+
+type OutputVmGroup struct {
+	Name  *string      `json:"name"`
+	Hosts []OutputHost `json:"hosts"`
+}
+
+type OutputHost struct {
+	Name        *string            `json:"name"`
+	Ip          *string            `json:"ip" redact:"identifier"`
+	Configured  *bool              `json:"configured"`
+	MountPoints []OutputMountPoint `json:"mount_points"`
+}
+
+type OutputMountPoint struct {
+	Lun     *int    `json:"lun"`
+	Path    *string `json:"path"`
+	Created *bool   `json:"created"`
+}
+
+// ConfiguredHosts returns names of hosts reported as configured across all VmGroups.
+func (o *Output) ConfiguredHosts() []string {
+	if o == nil {
+		return nil
+	}
+	result := make([]string, 0)
+	for _, vmGroup := range o.VmGroups {
+		for _, host := range vmGroup.Hosts {
+			if host.Name != nil && host.Configured != nil && *host.Configured {
+				result = append(result, *host.Name)
+			}
+		}
+	}
+	return result
+}
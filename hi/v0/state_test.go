@@ -0,0 +1,383 @@
+package v0
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/epiphany-platform/e-structures/shared"
+	"github.com/epiphany-platform/e-structures/storage"
+	"github.com/epiphany-platform/e-structures/utils/test"
+	"github.com/epiphany-platform/e-structures/utils/to"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestState_Init(t *testing.T) {
+	tests := []struct {
+		name          string
+		moduleVersion string
+		want          *State
+	}{
+		{
+			name:          "happy path",
+			moduleVersion: "v1.1.1",
+			want: &State{
+				Meta: &Meta{
+					Kind:          to.StrPtr("hiState"),
+					Version:       to.StrPtr("v0.0.1"),
+					ModuleVersion: to.StrPtr("v1.1.1"),
+				},
+				Status: shared.Initialized,
+				Config: nil,
+				Output: nil,
+				Unused: []string{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			got := &State{}
+			got.Init(tt.moduleVersion)
+			a.Equal(tt.want, got)
+		})
+	}
+}
+
+func TestState_Load(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    []byte
+		want    *State
+		wantErr error
+	}{
+		{
+			name: "happy path",
+			json: []byte(`{
+  "meta": {
+    "kind": "hiState",
+    "version": "v0.0.1",
+    "module_version": "v0.0.1"
+  },
+  "status": "applied",
+  "config": {
+    "meta": {
+      "kind": "hiConfig",
+      "version": "v0.1.0",
+      "module_version": "v0.0.1"
+    },
+    "params": {
+      "vm_groups": [],
+      "rsa_private_path": "/shared/vms_rsa"
+    }
+  },
+  "output": {
+    "vm_groups": [
+      {
+        "name": "vm-group0",
+        "hosts": [
+          {
+            "name": "epiphany-vm-group0-1",
+            "ip": "10.0.1.4",
+            "configured": true,
+            "mount_points": [
+              {
+                "lun": 10,
+                "path": "/data/test",
+                "created": true
+              }
+            ]
+          },
+          {
+            "name": "epiphany-vm-group0-2",
+            "ip": "10.0.1.5",
+            "configured": false,
+            "mount_points": []
+          }
+        ]
+      }
+    ]
+  }
+}`),
+			want: &State{
+				Meta: &Meta{
+					Kind:          to.StrPtr("hiState"),
+					Version:       to.StrPtr("v0.0.1"),
+					ModuleVersion: to.StrPtr("v0.0.1"),
+				},
+				Status: shared.Applied,
+				Config: &Config{
+					Meta: &Meta{
+						Kind:          to.StrPtr("hiConfig"),
+						Version:       to.StrPtr("v0.1.0"),
+						ModuleVersion: to.StrPtr("v0.0.1"),
+					},
+					Params: &Params{
+						VmGroups:          []VmGroup{},
+						RsaPrivateKeyPath: to.StrPtr("/shared/vms_rsa"),
+					},
+					Unused: []string{},
+				},
+				Output: &Output{
+					VmGroups: []OutputVmGroup{
+						{
+							Name: to.StrPtr("vm-group0"),
+							Hosts: []OutputHost{
+								{
+									Name:       to.StrPtr("epiphany-vm-group0-1"),
+									Ip:         to.StrPtr("10.0.1.4"),
+									Configured: to.BoolPtr(true),
+									MountPoints: []OutputMountPoint{
+										{
+											Lun:     to.IntPtr(10),
+											Path:    to.StrPtr("/data/test"),
+											Created: to.BoolPtr(true),
+										},
+									},
+								},
+								{
+									Name:        to.StrPtr("epiphany-vm-group0-2"),
+									Ip:          to.StrPtr("10.0.1.5"),
+									Configured:  to.BoolPtr(false),
+									MountPoints: []OutputMountPoint{},
+								},
+							},
+						},
+					},
+				},
+				Unused: []string{},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "ensure load is performing validation",
+			json: []byte(`{
+	"meta": {
+		"kind": "hiState",
+		"version": "v0.0.1",
+		"module_version": "v0.0.1"
+	},
+	"status": "unknown"
+}`),
+			want: nil,
+			wantErr: test.TestValidationErrors{
+				test.TestValidationError{
+					Key:   "State.Status",
+					Field: "Status",
+					Tag:   "eq=initialized|eq=applied|eq=destroyed",
+				},
+			},
+		},
+		{
+			name: "not current version",
+			json: []byte(`{
+	"meta": {
+		"kind": "hiState",
+		"version": "v0.0.100",
+		"module_version": "v0.0.1"
+	},
+	"status": "initialized"
+}`),
+			want:    nil,
+			wantErr: shared.NotCurrentVersionError{Version: "v0.0.100"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			r := require.New(t)
+			p, err := createTempDocumentFile("hi-state-load", tt.json)
+			r.NoError(err)
+			got := &State{}
+			err = got.Load(p)
+			if tt.wantErr != nil {
+				r.Error(err)
+				var errs validator.ValidationErrors
+				ok := errors.As(err, &errs)
+				if ok {
+					for _, e := range errs {
+						found := false
+						for _, we := range tt.wantErr.(test.TestValidationErrors) {
+							if we.Key == e.Namespace() && we.Tag == e.Tag() && we.Field == e.Field() {
+								found = true
+								break
+							}
+						}
+						if !found {
+							t.Errorf("Got unknown error:\n%s\nAll expected errors: \n%s", e.Error(), tt.wantErr.Error())
+						}
+					}
+					a.Equal(len(tt.wantErr.(test.TestValidationErrors)), len(errs))
+				} else {
+					a.Equal(tt.wantErr, err)
+				}
+			} else {
+				a.NoError(err)
+				wj, err2 := tt.want.Print()
+				a.NoError(err2)
+				gj, err2 := got.Print()
+				a.NoError(err2)
+				a.Equal(string(wj), string(gj))
+				a.Equal(tt.want.GetOutput(), got.GetOutput())
+			}
+		})
+	}
+}
+
+func TestOutput_ConfiguredHosts(t *testing.T) {
+	tests := []struct {
+		name   string
+		output *Output
+		want   []string
+	}{
+		{
+			name:   "nil output",
+			output: nil,
+			want:   nil,
+		},
+		{
+			name: "happy path",
+			output: &Output{
+				VmGroups: []OutputVmGroup{
+					{
+						Name: to.StrPtr("vm-group0"),
+						Hosts: []OutputHost{
+							{
+								Name:       to.StrPtr("epiphany-vm-group0-1"),
+								Configured: to.BoolPtr(true),
+							},
+							{
+								Name:       to.StrPtr("epiphany-vm-group0-2"),
+								Configured: to.BoolPtr(false),
+							},
+							{
+								Name: to.StrPtr("epiphany-vm-group0-3"),
+							},
+						},
+					},
+					{
+						Name: to.StrPtr("vm-group1"),
+						Hosts: []OutputHost{
+							{
+								Name:       to.StrPtr("epiphany-vm-group1-1"),
+								Configured: to.BoolPtr(true),
+							},
+						},
+					},
+				},
+			},
+			want: []string{"epiphany-vm-group0-1", "epiphany-vm-group1-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			a.Equal(tt.want, tt.output.ConfiguredHosts())
+		})
+	}
+}
+
+func TestState_Upgrade(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    []byte
+		wantErr error
+	}{
+		{
+			name: "happy path nothing to upgrade",
+			json: []byte(`{
+	"meta": {
+		"kind": "hiState",
+		"version": "v0.0.1",
+		"module_version": "v0.0.1"
+	},
+	"status": "initialized"
+}`),
+			wantErr: nil,
+		},
+		{
+			name: "some unknown version",
+			json: []byte(`{
+	"meta": {
+		"kind": "hiState",
+		"version": "v0.0.100",
+		"module_version": "v0.0.1"
+	},
+	"status": "initialized"
+}`),
+			wantErr: errors.New("unknown version to upgrade"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			r := require.New(t)
+			p, err := createTempDocumentFile("hi-state-upgrade", tt.json)
+			r.NoError(err)
+			got := &State{}
+			err = got.Upgrade(p)
+			if tt.wantErr != nil {
+				a.Equal(tt.wantErr, err)
+			} else {
+				a.NoError(err)
+			}
+		})
+	}
+}
+
+func TestState_SaveConflict(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	st := storage.NewMemory()
+	state := &State{}
+	state.Init("v0.0.1")
+	r.NoError(state.SaveTo(st, "state.json"))
+	serial, hash := state.GetSerial()
+	a.Equal(1, serial)
+	a.NotEmpty(hash)
+
+	other := &State{}
+	r.NoError(other.LoadFrom(st, "state.json"))
+	a.Equal(state.Meta.Hash, other.Meta.Hash)
+
+	state.Status = shared.Applied
+	r.NoError(state.SaveTo(st, "state.json"))
+	serial, _ = state.GetSerial()
+	a.Equal(2, serial)
+
+	err := other.SaveTo(st, "state.json")
+	a.Equal(shared.ConflictError{Path: "state.json", Expected: 1, Found: 2}, err)
+	serial, _ = other.GetSerial()
+	a.Equal(1, serial)
+}
+
+func TestState_PrintRedacted(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	s := &State{}
+	s.Init("v0.0.1")
+	s.Config = &Config{}
+	s.Config.Init("v0.0.1")
+	s.Output = &Output{
+		VmGroups: []OutputVmGroup{
+			{
+				Name: to.StrPtr("vm-group0"),
+				Hosts: []OutputHost{
+					{
+						Name:        to.StrPtr("epiphany-vm-group0-1"),
+						Ip:          to.StrPtr("10.0.1.4"),
+						Configured:  to.BoolPtr(true),
+						MountPoints: []OutputMountPoint{},
+					},
+				},
+			},
+		},
+	}
+
+	redacted, err := s.PrintRedacted(shared.RedactOptions{Identifiers: true})
+	r.NoError(err)
+	a.NotContains(string(redacted), "10.0.1.4")
+	a.NotContains(string(redacted), "/shared/vms_rsa")
+	a.Contains(string(redacted), "epiphany-vm-group0-1")
+}
@@ -0,0 +1,353 @@
+package imh
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/epiphany-platform/e-structures/shared"
+	"github.com/epiphany-platform/e-structures/storage"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	backupManifestFileName = "manifest.json"
+	backupTimeFormat       = "20060102-150405.000000"
+	// legacyBackupTimeFormat was used by older versions of this package to name config-<ts>.json and
+	// state-<ts>.json files stored directly in backup directory.
+	legacyBackupTimeFormat = "20060102-150405.999999"
+)
+
+// Reasons of taking backup recorded in BackupManifest.
+const (
+	ReasonInitialize = "initialize"
+	// ReasonLoad was recorded by older versions of this package which took backup on every Load.
+	ReasonLoad       = "load"
+	ReasonPreUpgrade = "pre-upgrade"
+	ReasonPreSave    = "pre-save"
+)
+
+// RetentionPolicy describes which backups are removed by InfrastructureModuleHelper.PruneBackups. Zero value
+// keeps all backups. The most recent backup is never removed.
+type RetentionPolicy struct {
+	// KeepLast is number of most recent backups to keep. Ignored if not positive.
+	KeepLast int
+	// MaxAge is maximal age of backup to keep. Ignored if not positive.
+	MaxAge time.Duration
+}
+
+// limited tells if policy removes any backups at all.
+func (p RetentionPolicy) limited() bool {
+	return p.KeepLast > 0 || p.MaxAge > 0
+}
+
+// ErrRetentionRequired is returned when backup would be taken into storage which requires retention limit (see
+// storage.Bounded) while InfrastructureModuleHelper.Retention keeps all backups.
+var ErrRetentionRequired = errors.New("storage requires backups to be pruned, set Retention to limit number of backups")
+
+// BackupFile describes single file stored in backup directory.
+type BackupFile struct {
+	Name     string `json:"name"`
+	Document string `json:"document"`
+	Raw      bool   `json:"raw"`
+	Version  string `json:"version,omitempty"`
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// BackupManifest describes content of single backup directory. It is stored in that directory in manifest.json
+// file.
+type BackupManifest struct {
+	ID            string       `json:"id"`
+	CreatedAt     time.Time    `json:"created_at"`
+	ModuleVersion string       `json:"module_version"`
+	Reason        string       `json:"reason"`
+	Files         []BackupFile `json:"files"`
+	// Legacy is set for backups written by older versions of this package as config-<ts>.json and state-<ts>.json
+	// pair stored directly in backup directory. They have no manifest, so only ID, CreatedAt and Files are known.
+	Legacy bool `json:"-"`
+}
+
+// ListBackups returns manifests of all backups found in module backup directory ordered from the oldest one.
+// Pairs of config-<ts>.json and state-<ts>.json files left in backup directory by older versions of this package
+// are listed as Legacy backups identified by their timestamp.
+func (h InfrastructureModuleHelper) ListBackups() ([]BackupManifest, error) {
+	st, err := h.storage()
+	if err != nil {
+		return nil, err
+	}
+	names, err := st.List(backupDirectoryName + "/")
+	if err != nil {
+		return nil, err
+	}
+	result := make([]BackupManifest, 0)
+	legacy := make(map[string]*BackupManifest)
+	for _, name := range names {
+		parts := strings.Split(name, "/")
+		if len(parts) == 2 {
+			m, f, ok := legacyBackupFile(st, parts[1])
+			if !ok {
+				continue
+			}
+			if _, ok := legacy[m.ID]; !ok {
+				legacy[m.ID] = &m
+			}
+			legacy[m.ID].Files = append(legacy[m.ID].Files, f)
+			continue
+		}
+		if len(parts) != 3 || parts[2] != backupManifestFileName {
+			continue
+		}
+		b, err := st.Read(name)
+		if err != nil {
+			return nil, err
+		}
+		var m BackupManifest
+		err = json.Unmarshal(b, &m)
+		if err != nil {
+			return nil, fmt.Errorf("incorrect manifest of backup %s: %v", parts[1], err)
+		}
+		result = append(result, m)
+	}
+	for _, m := range legacy {
+		result = append(result, *m)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].ID < result[j].ID
+		}
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result, nil
+}
+
+// legacyBackupFile describes file named config-<ts>.json or state-<ts>.json found in backup directory. It returns
+// manifest of legacy backup file belongs to (without files) and false if name doesn't match.
+func legacyBackupFile(st storage.Storage, name string) (BackupManifest, BackupFile, bool) {
+	for _, document := range []string{"config", "state"} {
+		if !strings.HasPrefix(name, document+"-") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		id := strings.TrimSuffix(strings.TrimPrefix(name, document+"-"), ".json")
+		createdAt, err := time.ParseInLocation(legacyBackupTimeFormat, id, time.Local)
+		if err != nil {
+			return BackupManifest{}, BackupFile{}, false
+		}
+		m := BackupManifest{
+			ID:        id,
+			CreatedAt: createdAt,
+			Files:     []BackupFile{},
+			Legacy:    true,
+		}
+		f := BackupFile{
+			Name:     name,
+			Document: document,
+			Raw:      false,
+			Version:  documentVersion(st, backupDirectoryName+"/"+name),
+		}
+		return m, f, true
+	}
+	return BackupManifest{}, BackupFile{}, false
+}
+
+// PruneBackups removes backups not matching Retention policy and returns identifiers of removed backups.
+func (h InfrastructureModuleHelper) PruneBackups() ([]string, error) {
+	st, err := h.storage()
+	if err != nil {
+		return nil, err
+	}
+	backups, err := h.ListBackups()
+	if err != nil {
+		return nil, err
+	}
+	removed := make([]string, 0)
+	now := time.Now()
+	for i, b := range backups {
+		fromNewest := len(backups) - 1 - i
+		if fromNewest == 0 {
+			break
+		}
+		tooMany := h.Retention.KeepLast > 0 && fromNewest >= h.Retention.KeepLast
+		tooOld := h.Retention.MaxAge > 0 && now.Sub(b.CreatedAt) > h.Retention.MaxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+		err = removeBackup(st, b)
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, b.ID)
+	}
+	return removed, nil
+}
+
+// backupRun collects files of single backup stored in its own directory.
+type backupRun struct {
+	storage  storage.Storage
+	prefix   string
+	manifest BackupManifest
+	options  []shared.EncodeOption
+}
+
+// newBackupRun starts backup in st. It fails with ErrRetentionRequired if st requires retention limit and none is
+// set.
+func (h InfrastructureModuleHelper) newBackupRun(st storage.Storage) (*backupRun, error) {
+	if b, ok := st.(storage.Bounded); ok && b.RequiresRetention() && !h.Retention.limited() {
+		return nil, ErrRetentionRequired
+	}
+	now := time.Now()
+	id := now.Format(backupTimeFormat)
+	// runs started within the same microsecond get distinguished by suffix
+	for i := 1; ; i++ {
+		existing, err := st.List(backupPrefix(id))
+		if err != nil || len(existing) == 0 {
+			break
+		}
+		id = fmt.Sprintf("%s-%d", now.Format(backupTimeFormat), i)
+	}
+	return &backupRun{
+		storage: st,
+		prefix:  backupPrefix(id),
+		options: h.encodeOptions(),
+		manifest: BackupManifest{
+			ID:            id,
+			CreatedAt:     now,
+			ModuleVersion: h.ModuleVersion,
+			Files:         []BackupFile{},
+		},
+	}, nil
+}
+
+// raw copies untouched document into backup if it exists. Copy is named after format of document (i.e.
+// config.raw.yaml).
+func (r *backupRun) raw(document string, name string, b shared.Backupper) error {
+	content, err := r.storage.Read(name)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%s raw backup failed: %v", document, err)
+	}
+	rawName := fmt.Sprintf("%s.raw.%s", document, shared.DetectFormat(name, content))
+	err = b.BackupRawTo(r.storage, name, r.prefix+rawName)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%s raw backup failed: %v", document, err)
+	}
+	checksum, err := r.storage.Read(r.prefix + rawName + shared.ChecksumFileSuffix)
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(checksum))
+	if len(fields) == 0 {
+		return fmt.Errorf("%s raw backup checksum is empty", document)
+	}
+	r.manifest.Files = append(r.manifest.Files, BackupFile{
+		Name:     rawName,
+		Document: document,
+		Raw:      true,
+		Version:  documentVersion(r.storage, r.prefix+rawName),
+		Checksum: fields[0],
+	})
+	return nil
+}
+
+// structure stores current form of document structure in backup.
+func (r *backupRun) structure(document string, m Modulator) error {
+	name := fmt.Sprintf("%s.json", document)
+	err := m.BackupTo(r.storage, r.prefix+name, r.options...)
+	if err != nil {
+		return fmt.Errorf("%s backup failed: %v", document, err)
+	}
+	r.manifest.Files = append(r.manifest.Files, BackupFile{
+		Name:     name,
+		Document: document,
+		Raw:      false,
+		Version:  documentVersion(r.storage, r.prefix+name),
+	})
+	return nil
+}
+
+// finish writes manifest of backup. Nothing is written if no file was stored in backup.
+func (r *backupRun) finish(reason string) error {
+	if len(r.manifest.Files) == 0 {
+		return nil
+	}
+	r.manifest.Reason = reason
+	bytes, err := json.MarshalIndent(r.manifest, "", "\t")
+	if err != nil {
+		return err
+	}
+	return r.storage.Write(r.prefix+backupManifestFileName, bytes)
+}
+
+// abort removes incomplete backup.
+func (r *backupRun) abort(cause error) error {
+	if err := removeAll(r.storage, r.prefix); err != nil {
+		return fmt.Errorf("%v (removing incomplete backup failed: %v)", cause, err)
+	}
+	return cause
+}
+
+func backupPrefix(id string) string {
+	return backupDirectoryName + "/" + id + "/"
+}
+
+// backupFileName returns name of document keeping file f of backup m.
+func backupFileName(m BackupManifest, f BackupFile) string {
+	if m.Legacy {
+		return backupDirectoryName + "/" + f.Name
+	}
+	return backupPrefix(m.ID) + f.Name
+}
+
+// removeBackup removes all files of backup m.
+func removeBackup(st storage.Storage, m BackupManifest) error {
+	if !m.Legacy {
+		return removeAll(st, backupPrefix(m.ID))
+	}
+	for _, f := range m.Files {
+		err := st.Remove(backupFileName(m, f))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeAll removes all documents which names start with prefix.
+func removeAll(st storage.Storage, prefix string) error {
+	names, err := st.List(prefix)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		err = st.Remove(name)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// documentVersion returns version of structure stored in document or empty string if it cannot be determined.
+func documentVersion(st storage.Storage, name string) string {
+	b, err := st.Read(name)
+	if err != nil {
+		return ""
+	}
+	b, err = shared.ToJSON(name, b)
+	if err != nil {
+		return ""
+	}
+	var input map[string]interface{}
+	if err := json.Unmarshal(b, &input); err != nil {
+		return ""
+	}
+	v, err := shared.GetVersion(input)
+	if err != nil {
+		return ""
+	}
+	return v
+}
@@ -0,0 +1,208 @@
+package imh
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	azbi "github.com/epiphany-platform/e-structures/azbi/v0"
+	"github.com/epiphany-platform/e-structures/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInfrastructureModuleHelper_Backups(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	h := InfrastructureModuleHelper{
+		ModuleDirectoryPath: t.TempDir(),
+		ModuleVersion:       "v0.0.1",
+	}
+	// file left by older versions of helper
+	r.NoError(ioutil.WriteFile(filepath.Join(h.ModuleDirectoryPath, "config.json"), []byte(`{
+	"meta": {
+		"kind": "azbiConfig",
+		"version": "v0.2.0",
+		"module_version": "v0.0.1"
+	},
+	"params": {
+		"name": "epiphany",
+		"location": "northeurope",
+		"address_space": ["10.0.0.0/16"],
+		"rsa_pub_path": "/shared/vms_rsa.pub",
+		"subnets": [{"name": "main", "address_prefixes": ["10.0.1.0/24"]}],
+		"vm_groups": []
+	}
+}`), 0644))
+	r.NoError(ioutil.WriteFile(filepath.Join(h.ModuleDirectoryPath, "state.json"), []byte(`{
+	"meta": {
+		"kind": "azbiState",
+		"version": "v0.0.2",
+		"module_version": "v0.0.1"
+	},
+	"status": "initialized"
+}`), 0644))
+	r.NoError(os.MkdirAll(filepath.Join(h.ModuleDirectoryPath, "backup"), os.ModePerm))
+	r.NoError(ioutil.WriteFile(filepath.Join(h.ModuleDirectoryPath, "backup", "config-20210101-000000.json"), []byte(`{}`), 0644))
+
+	config, state, err := h.Initialize(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+	r.NoError(h.Save(config, state))
+	_, _, err = h.Load(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+
+	backups, err := h.ListBackups()
+	r.NoError(err)
+	// nothing was upgraded by Load, so no backup was taken
+	r.Len(backups, 3)
+
+	// file left by older versions of helper is listed as the oldest backup
+	legacy := backups[0]
+	a.True(legacy.Legacy)
+	a.Equal("20210101-000000", legacy.ID)
+	a.Equal([]string{"config-20210101-000000.json"}, names(legacy.Files))
+	backups = backups[1:]
+
+	a.Equal(ReasonPreUpgrade, backups[0].Reason)
+	a.Equal("v0.0.1", backups[0].ModuleVersion)
+	a.Equal([]string{"config.raw.json", "state.raw.json", "config.json", "state.json"}, names(backups[0].Files))
+	a.Equal("v0.2.0", backups[0].Files[0].Version)
+	a.NotEmpty(backups[0].Files[0].Checksum)
+	a.Equal("v0.2.1", backups[0].Files[2].Version)
+	raw, err := ioutil.ReadFile(filepath.Join(h.ModuleDirectoryPath, "backup", backups[0].ID, "config.raw.json"))
+	r.NoError(err)
+	a.Contains(string(raw), `"version": "v0.2.0"`)
+
+	a.Equal(ReasonPreSave, backups[1].Reason)
+	a.Equal([]string{"config.raw.json", "state.raw.json"}, names(backups[1].Files))
+	a.Equal("v0.2.0", backups[1].Files[0].Version)
+
+	h.Retention = RetentionPolicy{KeepLast: 1}
+	removed, err := h.PruneBackups()
+	r.NoError(err)
+	a.Equal([]string{legacy.ID, backups[0].ID}, removed)
+	a.NoDirExists(filepath.Join(h.ModuleDirectoryPath, "backup", backups[0].ID))
+	a.NoFileExists(filepath.Join(h.ModuleDirectoryPath, "backup", "config-20210101-000000.json"))
+}
+
+func TestInfrastructureModuleHelper_BackupYAML(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	h := InfrastructureModuleHelper{
+		ModuleDirectoryPath: t.TempDir(),
+		ModuleVersion:       "v0.0.1",
+	}
+	r.NoError(ioutil.WriteFile(filepath.Join(h.ModuleDirectoryPath, "state.json"), []byte(`meta:
+  kind: azbiState
+  version: v0.0.1
+  module_version: v0.0.1
+status: initialized
+`), 0644))
+
+	config, state, err := h.Initialize(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+	r.NoError(h.Save(config, state))
+
+	backups, err := h.ListBackups()
+	r.NoError(err)
+	r.Len(backups, 2)
+	a.Equal(ReasonPreUpgrade, backups[0].Reason)
+	a.Equal([]string{"state.raw.yaml", "config.json", "state.json"}, names(backups[0].Files))
+	a.Equal("v0.0.1", backups[0].Files[0].Version)
+	raw, err := ioutil.ReadFile(filepath.Join(h.ModuleDirectoryPath, "backup", backups[0].ID, "state.raw.yaml"))
+	r.NoError(err)
+	a.Contains(string(raw), "version: v0.0.1")
+}
+
+func TestInfrastructureModuleHelper_PruneBackups(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention RetentionPolicy
+		backups   int
+		want      int
+	}{
+		{
+			name:      "zero policy keeps everything",
+			retention: RetentionPolicy{},
+			backups:   3,
+			want:      3,
+		},
+		{
+			name:      "keep last",
+			retention: RetentionPolicy{KeepLast: 2},
+			backups:   4,
+			want:      2,
+		},
+		{
+			name:      "most recent is kept even if too old",
+			retention: RetentionPolicy{MaxAge: 1},
+			backups:   3,
+			want:      1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			r := require.New(t)
+			h := InfrastructureModuleHelper{
+				ModuleDirectoryPath: t.TempDir(),
+				ModuleVersion:       "v0.0.1",
+			}
+			for i := 0; i < tt.backups; i++ {
+				st, err := h.storage()
+				r.NoError(err)
+				run, err := h.newBackupRun(st)
+				r.NoError(err)
+				r.NoError(run.structure("config", &azbi.Config{}))
+				r.NoError(run.finish(ReasonLoad))
+			}
+			h.Retention = tt.retention
+			_, err := h.PruneBackups()
+			r.NoError(err)
+			backups, err := h.ListBackups()
+			r.NoError(err)
+			a.Len(backups, tt.want)
+		})
+	}
+}
+
+func names(files []BackupFile) []string {
+	result := make([]string, 0)
+	for _, f := range files {
+		result = append(result, f.Name)
+	}
+	return result
+}
+
+// boundedStorage is memory storage reporting that backups kept in it have to be pruned.
+type boundedStorage struct {
+	*storage.Memory
+}
+
+func (boundedStorage) RequiresRetention() bool {
+	return true
+}
+
+func TestInfrastructureModuleHelper_RetentionRequired(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	st := boundedStorage{storage.NewMemory()}
+	h := InfrastructureModuleHelper{
+		ModuleVersion: "v0.0.1",
+		Storage:       st,
+	}
+
+	_, _, err := h.Initialize(&azbi.Config{}, &azbi.State{})
+	a.Equal(ErrRetentionRequired, err)
+	names, err := st.List("")
+	r.NoError(err)
+	a.Empty(names)
+
+	h.Retention = RetentionPolicy{KeepLast: 2}
+	_, _, err = h.Initialize(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+	backups, err := h.ListBackups()
+	r.NoError(err)
+	a.Len(backups, 1)
+}
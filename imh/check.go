@@ -0,0 +1,42 @@
+package imh
+
+import (
+	"github.com/epiphany-platform/e-structures/shared"
+	"os"
+	"sort"
+)
+
+// Check reads config and state of module the way Load does (upgrading older versions in memory) but instead of
+// stopping at the first failure it reports every problem found in both documents, sorted by document and path.
+// Lint findings of documents which loaded correctly are reported as well. Documents which don't exist yet are
+// skipped. Nothing is written and no backup is taken. Error is returned only
+// if storage can't be used at all.
+func (h InfrastructureModuleHelper) Check(config Modulator, state Modulator) (shared.FieldErrors, error) {
+	st, err := h.storage()
+	if err != nil {
+		return nil, err
+	}
+	result := make(shared.FieldErrors, 0)
+	for _, d := range []struct {
+		name string
+		m    Modulator
+	}{
+		{name: configFileName, m: config},
+		{name: stateFileName, m: state},
+	} {
+		err := load(d.m, st, d.name, h.decodeOptions())
+		if os.IsNotExist(err) {
+			continue
+		}
+		problems := shared.Problems(err)
+		if err == nil {
+			problems = d.m.Lint()
+		}
+		for _, p := range problems {
+			p.Document = d.name
+			result = append(result, p)
+		}
+	}
+	sort.Stable(result)
+	return result, nil
+}
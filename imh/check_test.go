@@ -0,0 +1,93 @@
+package imh
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	azbi "github.com/epiphany-platform/e-structures/azbi/v0"
+	"github.com/epiphany-platform/e-structures/shared"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInfrastructureModuleHelper_Check(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	h := InfrastructureModuleHelper{
+		ModuleDirectoryPath: t.TempDir(),
+		ModuleVersion:       "v0.0.1",
+	}
+
+	problems, err := h.Check(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+	a.Empty(problems)
+
+	// valid documents are linted
+	config, state, err := h.Initialize(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+	r.NoError(h.Save(config, state))
+	problems, err = h.Check(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+	a.False(problems.HasErrors())
+	a.Equal(shared.FieldErrors{
+		{
+			Document: "config.json",
+			Path:     "params.vm_groups",
+			Severity: shared.SeverityWarning,
+			Tag:      azbi.WarningPublicIpOnAllVmGroups,
+			Message:  "every VM group uses public IP, consider keeping some of them private",
+		},
+	}, problems)
+
+	b, err := config.Print()
+	r.NoError(err)
+	// VM group refers to unknown subnets and its vm_count can't be decoded, state is broken as well
+	var document map[string]interface{}
+	r.NoError(json.Unmarshal(b, &document))
+	group := document["params"].(map[string]interface{})["vm_groups"].([]interface{})[0].(map[string]interface{})
+	group["vm_count"] = "one"
+	group["subnet_names"] = []string{"other", "", "another"}
+	b, err = json.Marshal(document)
+	r.NoError(err)
+	r.NoError(ioutil.WriteFile(filepath.Join(h.ModuleDirectoryPath, "config.json"), b, 0644))
+	r.NoError(ioutil.WriteFile(filepath.Join(h.ModuleDirectoryPath, "state.json"), []byte(`{
+	"meta": {"kind": "azbiState", "version": "v0.0.2", "module_version": "v0.0.1"},
+	"status": "unknown"
+}`), 0644))
+
+	problems, err = h.Check(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+	a.True(problems.HasErrors())
+	a.True(sort.IsSorted(problems))
+	got := make([]string, 0)
+	for _, p := range problems {
+		a.Equal(shared.SeverityError, p.Severity)
+		got = append(got, p.Document+" "+p.Path+" "+p.Tag)
+	}
+	a.Equal([]string{
+		"config.json params.vm_groups[0].subnet_names[0] insubnets",
+		"config.json params.vm_groups[0].subnet_names[1] required",
+		"config.json params.vm_groups[0].subnet_names[2] insubnets",
+		"config.json params.vm_groups[0].vm_count type",
+		"state.json status eq=initialized|eq=applied|eq=destroyed",
+	}, got)
+
+	// strict mode reports unknown fields instead of collecting them
+	r.NoError(ioutil.WriteFile(filepath.Join(h.ModuleDirectoryPath, "state.json"), []byte(`{
+	"meta": {"kind": "azbiState", "version": "v0.0.2", "module_version": "v0.0.1"},
+	"stauts": "applied"
+}`), 0644))
+	h.Strict = true
+	problems, err = h.Check(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+	a.Contains(problems, shared.FieldError{
+		Document: "state.json",
+		Path:     "stauts",
+		Severity: shared.SeverityError,
+		Tag:      "unknown",
+		Message:  "is not known field, did you mean status?",
+	})
+}
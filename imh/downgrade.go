@@ -0,0 +1,71 @@
+package imh
+
+import (
+	"fmt"
+	"github.com/epiphany-platform/e-structures/storage"
+)
+
+// ReasonPreDowngrade is recorded in manifest of backup taken just before module files are downgraded.
+const ReasonPreDowngrade = "pre-downgrade"
+
+// Downgrade rewrites module config and state files into older versions of structures, i.e. before module is
+// rolled back to release which doesn't understand current ones. Document is left untouched if its target version
+// is empty. Files are replaced only if both of them were downgraded (see shared.Downgrader) and untouched copies
+// of them were backed up.
+func (h InfrastructureModuleHelper) Downgrade(config Modulator, state Modulator, configVersion, stateVersion string, force bool) error {
+	// check if required fields are set
+	if h.ModuleVersion == "" {
+		return fmt.Errorf("setup module version first")
+	}
+	st, err := h.storage()
+	if err != nil {
+		return err
+	}
+
+	// downgrade copies of documents so nothing is replaced if any of them fails
+	staging := storage.NewMemory()
+	_, err = downgrade(config, st, staging, configFileName, configVersion, force)
+	if err != nil {
+		return fmt.Errorf("downgrade config failed: %w", err)
+	}
+	stateDocumentVersion, err := downgrade(state, st, staging, stateFileName, stateVersion, force)
+	if err != nil {
+		return fmt.Errorf("downgrade state failed: %w", err)
+	}
+
+	// backup files about to be overwritten
+	run, err := h.newBackupRun(st)
+	if err != nil {
+		return err
+	}
+	err = run.raw("config", configFileName, config)
+	if err != nil {
+		return run.abort(err)
+	}
+	err = run.raw("state", stateFileName, state)
+	if err != nil {
+		return run.abort(err)
+	}
+	err = h.backup(run, ReasonPreDowngrade, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	// state and config are replaced together, state only if nobody saved it since it was read
+	return replace(st, staging, stateDocumentVersion)
+}
+
+// downgrade copies document name from st into staging and downgrades it there to version (if not empty). It
+// returns version of copied document (see storage.ReadVersion).
+func downgrade(m Modulator, st storage.Storage, staging storage.Storage, name string, version string, force bool) (string, error) {
+	b, documentVersion, err := storage.ReadVersion(st, name)
+	if err != nil {
+		return "", err
+	}
+	err = staging.Write(name, b)
+	if err != nil || version == "" {
+		return documentVersion, err
+	}
+	// untouched copy is kept in staging only, it is backed up by caller in module backup layout
+	return documentVersion, m.DowngradeFrom(staging, name, name+".raw", version, force)
+}
@@ -0,0 +1,62 @@
+package imh
+
+import (
+	"errors"
+	"testing"
+
+	azbi "github.com/epiphany-platform/e-structures/azbi/v0"
+	"github.com/epiphany-platform/e-structures/shared"
+	"github.com/epiphany-platform/e-structures/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInfrastructureModuleHelper_Downgrade(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	st := storage.NewMemory()
+	h := InfrastructureModuleHelper{
+		ModuleVersion: "v0.0.1",
+		Storage:       st,
+	}
+	config, state, err := h.Initialize(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+	r.NoError(h.Save(config, state))
+	configBefore, err := st.Read("config.json")
+	r.NoError(err)
+	stateBefore, err := st.Read("state.json")
+	r.NoError(err)
+	backups, err := h.ListBackups()
+	r.NoError(err)
+
+	// lossy downgrade of config fails without force and nothing is changed
+	err = h.Downgrade(&azbi.Config{}, &azbi.State{}, "v0.2.0", "v0.0.1", false)
+	var lerr shared.LossyMigrationError
+	a.True(errors.As(err, &lerr))
+	b, err := st.Read("state.json")
+	r.NoError(err)
+	a.Equal(string(stateBefore), string(b))
+	after, err := h.ListBackups()
+	r.NoError(err)
+	a.Equal(backups, after)
+
+	r.NoError(h.Downgrade(&azbi.Config{}, &azbi.State{}, "v0.2.0", "v0.0.1", true))
+	a.Equal("v0.2.0", documentVersion(st, "config.json"))
+	a.Equal("v0.0.1", documentVersion(st, "state.json"))
+	names, err := st.List("")
+	r.NoError(err)
+	a.NotContains(names, "config.json.raw")
+
+	// untouched files are backed up
+	after, err = h.ListBackups()
+	r.NoError(err)
+	r.Len(after, len(backups)+1)
+	last := after[len(after)-1]
+	a.Equal(ReasonPreDowngrade, last.Reason)
+	b, err = st.Read(backupPrefix(last.ID) + "config.raw.json")
+	r.NoError(err)
+	a.Equal(string(configBefore), string(b))
+	b, err = st.Read(backupPrefix(last.ID) + "state.raw.json")
+	r.NoError(err)
+	a.Equal(string(stateBefore), string(b))
+}
@@ -4,8 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/epiphany-platform/e-structures/shared"
+	"github.com/epiphany-platform/e-structures/storage"
 	"os"
-	"path/filepath"
 	"time"
 )
 
@@ -16,7 +16,9 @@ type Modulator interface {
 	shared.Saver
 	shared.Printer
 	shared.Validator
+	shared.Linter
 	shared.Upgrader
+	shared.Downgrader
 	shared.WithUnused
 }
 
@@ -31,59 +33,82 @@ var ncverr shared.NotCurrentVersionError
 type InfrastructureModuleHelper struct {
 	ModuleDirectoryPath string
 	ModuleVersion       string
+	// Storage keeps module config, state and backups. Local storage of ModuleDirectoryPath is used if not set.
+	Storage storage.Storage
+	// Retention is applied to module backups every time new backup is taken.
+	Retention RetentionPolicy
+	// LockTimeout is how long Open waits for module directory lock held by other process.
+	LockTimeout time.Duration
+	// Strict makes loading config and state fail on fields unknown to structures (see shared.Strict).
+	Strict bool
+	// KeyProvider encrypts sensitive fields of saved and backed up documents and decrypts them on load (see
+	// shared.EncryptWith and shared.DecryptWith). Sensitive fields are kept in plain text if not set.
+	KeyProvider shared.KeyProvider
 }
 
 func (h InfrastructureModuleHelper) Initialize(config Modulator, state Modulator) (Modulator, Modulator, error) {
 	// TODO test
 	// check if required fields are set
-	if h.ModuleDirectoryPath == "" {
-		return nil, nil, fmt.Errorf("setup module directory path first")
-	}
 	if h.ModuleVersion == "" {
 		return nil, nil, fmt.Errorf("setup module version first")
 	}
-
-	// ensure module directory
-	err := os.MkdirAll(h.ModuleDirectoryPath, os.ModePerm)
+	st, err := h.storage()
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// create default files paths
-	configFilePath := filepath.Join(h.ModuleDirectoryPath, configFileName)
-	stateFilePath := filepath.Join(h.ModuleDirectoryPath, stateFileName)
+	// backup untouched files before they get decoded or upgraded
+	run, err := h.newBackupRun(st)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = run.raw("config", configFileName, config)
+	if err != nil {
+		return nil, nil, run.abort(err)
+	}
+	err = run.raw("state", stateFileName, state)
+	if err != nil {
+		return nil, nil, run.abort(err)
+	}
 
+	upgraded := false
 	// load state file
-	err = state.Load(stateFilePath)
+	err = state.LoadFrom(st, stateFileName, h.decodeOptions()...)
 	if os.IsNotExist(err) {
 		// if no state loaded then init it
 		state.Init(h.ModuleVersion)
 	} else if errors.As(err, &ncverr) {
 		// if old version was found try to upgrade it
-		err2 := state.Upgrade(stateFilePath)
+		err2 := state.UpgradeFrom(st, stateFileName, h.decodeOptions()...)
 		if err2 != nil {
-			return nil, nil, err2
+			return nil, nil, run.abort(err2)
 		}
+		upgraded = true
 	} else if err != nil {
-		return nil, nil, fmt.Errorf("load state failed: %v", err)
+		return nil, nil, run.abort(fmt.Errorf("load state failed: %v", err))
 	}
 	// load config file
-	err = config.Load(configFilePath)
+	err = config.LoadFrom(st, configFileName, h.decodeOptions()...)
 	if os.IsNotExist(err) {
 		// if no config loaded then init it
 		config.Init(h.ModuleVersion)
 	} else if errors.As(err, &ncverr) {
 		// if old version was found try to upgrade it
-		err2 := config.Upgrade(configFilePath)
+		err2 := config.UpgradeFrom(st, configFileName, h.decodeOptions()...)
 		if err2 != nil {
-			return nil, nil, err2
+			return nil, nil, run.abort(err2)
 		}
+		upgraded = true
 	} else if err != nil {
-		return nil, nil, fmt.Errorf("load config failed: %v", err)
+		return nil, nil, run.abort(fmt.Errorf("load config failed: %v", err))
 	}
 
 	// backup
-	err = backup(h.ModuleDirectoryPath, config, state)
+	reason := ReasonInitialize
+	if upgraded {
+		reason = ReasonPreUpgrade
+	}
+	err = h.backup(run, reason, config, state)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -91,51 +116,62 @@ func (h InfrastructureModuleHelper) Initialize(config Modulator, state Modulator
 	return config, state, nil
 }
 
+// Load loads module config and state, upgrading them if they are in older versions. Backup is taken only if
+// anything was upgraded, as files are not changed otherwise and Save backs them up before they get overwritten.
 func (h InfrastructureModuleHelper) Load(config Modulator, state Modulator) (Modulator, Modulator, error) {
 	// TODO test
 	// check if required fields are set
-	if h.ModuleDirectoryPath == "" {
-		return nil, nil, fmt.Errorf("setup module directory path first")
-	}
 	if h.ModuleVersion == "" {
 		return nil, nil, fmt.Errorf("setup module version first")
 	}
-
-	// ensure module directory
-	err := os.MkdirAll(h.ModuleDirectoryPath, os.ModePerm)
+	st, err := h.storage()
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// create default files paths
-	configFilePath := filepath.Join(h.ModuleDirectoryPath, configFileName)
-	stateFilePath := filepath.Join(h.ModuleDirectoryPath, stateFileName)
-
+	upgraded := false
 	// load state file
-	err = state.Load(stateFilePath)
+	err = state.LoadFrom(st, stateFileName, h.decodeOptions()...)
 	if errors.As(err, &ncverr) {
 		// if old version was found try to upgrade it
-		err2 := state.Upgrade(stateFilePath)
-		if err2 != nil {
-			return nil, nil, err2
+		err = state.UpgradeFrom(st, stateFileName, h.decodeOptions()...)
+		if err != nil {
+			return nil, nil, err
 		}
+		upgraded = true
 	} else if err != nil {
 		return nil, nil, fmt.Errorf("load state failed: %v", err)
 	}
 	// load config file
-	err = config.Load(configFilePath)
+	err = config.LoadFrom(st, configFileName, h.decodeOptions()...)
 	if errors.As(err, &ncverr) {
 		// if old version was found try to upgrade it
-		err2 := config.Upgrade(configFilePath)
-		if err2 != nil {
-			return nil, nil, err2
+		err = config.UpgradeFrom(st, configFileName, h.decodeOptions()...)
+		if err != nil {
+			return nil, nil, err
 		}
+		upgraded = true
 	} else if err != nil {
 		return nil, nil, fmt.Errorf("load config failed: %v", err)
 	}
+	if !upgraded {
+		return config, state, nil
+	}
 
-	// backup
-	err = backup(h.ModuleDirectoryPath, config, state)
+	// backup untouched files together with upgraded structures
+	run, err := h.newBackupRun(st)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = run.raw("config", configFileName, config)
+	if err != nil {
+		return nil, nil, run.abort(err)
+	}
+	err = run.raw("state", stateFileName, state)
+	if err != nil {
+		return nil, nil, run.abort(err)
+	}
+	err = h.backup(run, ReasonPreUpgrade, config, state)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -143,57 +179,182 @@ func (h InfrastructureModuleHelper) Load(config Modulator, state Modulator) (Mod
 	return config, state, nil
 }
 
-func (h InfrastructureModuleHelper) Save(config Modulator, state Modulator) error {
+func (h InfrastructureModuleHelper) Save(config Modulator, state Modulator) (err error) {
 	// TODO test
 	// check if required fields are set
-	if h.ModuleDirectoryPath == "" {
-		return fmt.Errorf("setup module directory path first")
-	}
 	if h.ModuleVersion == "" {
 		return fmt.Errorf("setup module version first")
 	}
+	st, err := h.storage()
+	if err != nil {
+		return err
+	}
+
+	// refuse to overwrite state saved by someone else after it was loaded
+	serialized, ok := state.(shared.Serialized)
+	if !ok {
+		return fmt.Errorf("state %T doesn't carry serial, so saves conflicting with it cannot be detected", state)
+	}
+	stateVersion, err := shared.CheckSerialVersion(serialized, st, stateFileName)
+	if err != nil {
+		return err
+	}
+	// serial is increased when state is staged, it has to be reverted if it doesn't reach storage
+	serial, hash := serialized.GetSerial()
+	defer func() {
+		if err != nil {
+			serialized.SetSerial(serial, hash)
+		}
+	}()
 
-	// ensure module directory
-	err := os.MkdirAll(h.ModuleDirectoryPath, os.ModePerm)
+	// files are saved back in format they were found in (i.e. YAML config.json written by user stays YAML)
+	stateFormat, err := formatOf(st, stateFileName)
+	if err != nil {
+		return err
+	}
+	configFormat, err := formatOf(st, configFileName)
 	if err != nil {
 		return err
 	}
 
-	// create default files paths
-	configFilePath := filepath.Join(h.ModuleDirectoryPath, configFileName)
-	stateFilePath := filepath.Join(h.ModuleDirectoryPath, stateFileName)
+	// prepare both files first so invalid structure doesn't replace anything
+	staging := storage.NewMemory()
+	err = state.SaveTo(staging, stateFileName, append(h.encodeOptions(), shared.InFormat(stateFormat))...)
+	if err != nil {
+		return err
+	}
+	err = config.SaveTo(staging, configFileName, append(h.encodeOptions(), shared.InFormat(configFormat))...)
+	if err != nil {
+		return err
+	}
 
-	err = state.Save(stateFilePath)
+	// backup files about to be overwritten
+	run, err := h.newBackupRun(st)
 	if err != nil {
 		return err
 	}
-	err = config.Save(configFilePath)
+	err = run.raw("config", configFileName, config)
+	if err != nil {
+		return run.abort(err)
+	}
+	err = run.raw("state", stateFileName, state)
+	if err != nil {
+		return run.abort(err)
+	}
+	err = h.backup(run, ReasonPreSave, nil, nil)
 	if err != nil {
 		return err
 	}
+
+	// state and config are replaced together, state only if it wasn't saved by someone else since it was checked
+	err = replace(st, staging, stateVersion)
+	if errors.Is(err, storage.ErrConflict) {
+		return shared.ConflictIn(st, stateFileName, serial)
+	}
+	return err
+}
+
+// decodeOptions returns options config and state are loaded and upgraded with.
+func (h InfrastructureModuleHelper) decodeOptions() []shared.DecodeOption {
+	var options []shared.DecodeOption
+	if h.Strict {
+		options = append(options, shared.Strict())
+	}
+	if h.KeyProvider != nil {
+		options = append(options, shared.DecryptWith(h.KeyProvider))
+	}
+	return options
+}
+
+// encodeOptions returns options config and state are saved and backed up with.
+func (h InfrastructureModuleHelper) encodeOptions() []shared.EncodeOption {
+	if h.KeyProvider != nil {
+		return []shared.EncodeOption{shared.EncryptWith(h.KeyProvider)}
+	}
 	return nil
 }
 
-func backup(moduleDirectoryPath string, config Modulator, state Modulator) error {
-	backupDirectoryPath := filepath.Join(moduleDirectoryPath, backupDirectoryName)
+// storage returns Storage module documents are kept in.
+func (h InfrastructureModuleHelper) storage() (storage.Storage, error) {
+	if h.Storage != nil {
+		return h.Storage, nil
+	}
+	if h.ModuleDirectoryPath == "" {
+		return nil, fmt.Errorf("setup module directory path first")
+	}
+	return storage.NewLocal(h.ModuleDirectoryPath), nil
+}
 
-	// ensure backups directory
-	err := os.MkdirAll(backupDirectoryPath, os.ModePerm)
+// formatOf returns format document with provided name is kept in st in (see shared.DetectFormat). Format expected
+// for its name is returned if document doesn't exist yet.
+func formatOf(st storage.Storage, name string) (shared.Format, error) {
+	b, err := st.Read(name)
+	if os.IsNotExist(err) {
+		return shared.FormatOf(name), nil
+	}
 	if err != nil {
-		return err
+		return "", err
 	}
+	return shared.DetectFormat(name, b), nil
+}
 
-	// prepare timestamp
-	t := time.Now().Format("20060102-150405.999999")
-	// backup config to
-	err = config.Backup(filepath.Join(backupDirectoryPath, fmt.Sprintf("config-%s.json", t)))
+// backup stores provided structures in backup run (if not nil), writes its manifest and applies retention policy.
+func (h InfrastructureModuleHelper) backup(run *backupRun, reason string, config Modulator, state Modulator) error {
+	if config != nil {
+		err := run.structure("config", config)
+		if err != nil {
+			return run.abort(err)
+		}
+	}
+	if state != nil {
+		err := run.structure("state", state)
+		if err != nil {
+			return run.abort(err)
+		}
+	}
+	err := run.finish(reason)
 	if err != nil {
-		return fmt.Errorf("config backup failed: %v", err)
+		return run.abort(err)
 	}
-	err = state.Backup(filepath.Join(backupDirectoryPath, fmt.Sprintf("state-%s.json", t)))
+	_, err = h.PruneBackups()
+	return err
+}
+
+// replace copies state and config documents from staging into st as one logical unit: if config cannot be
+// written previous state is put back. State is replaced only if it is still in stateVersion (see
+// storage.WriteVersion).
+func replace(st storage.Storage, staging storage.Storage, stateVersion string) error {
+	stateBytes, err := staging.Read(stateFileName)
 	if err != nil {
-		return fmt.Errorf("state backup failed: %v", err)
+		return err
+	}
+	configBytes, err := staging.Read(configFileName)
+	if err != nil {
+		return err
+	}
+	previous, err := st.Read(stateFileName)
+	existed := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return err
 	}
 
+	err = storage.WriteVersion(st, stateFileName, stateBytes, stateVersion)
+	if err != nil {
+		return err
+	}
+	err = st.Write(configFileName, configBytes)
+	if err != nil {
+		// do not leave module with new state and old config
+		var err2 error
+		if existed {
+			err2 = st.Write(stateFileName, previous)
+		} else {
+			err2 = st.Remove(stateFileName)
+		}
+		if err2 != nil {
+			return fmt.Errorf("%v (reverting state failed: %v)", err, err2)
+		}
+		return err
+	}
 	return nil
 }
@@ -0,0 +1,283 @@
+package imh
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	azbi "github.com/epiphany-platform/e-structures/azbi/v0"
+	azks "github.com/epiphany-platform/e-structures/azks/v0"
+	"github.com/epiphany-platform/e-structures/shared"
+	"github.com/epiphany-platform/e-structures/storage"
+	"github.com/epiphany-platform/e-structures/utils/test"
+	"github.com/epiphany-platform/e-structures/utils/to"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInfrastructureModuleHelper_Save(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	h := InfrastructureModuleHelper{
+		ModuleDirectoryPath: t.TempDir(),
+		ModuleVersion:       "v0.0.1",
+	}
+	config, state, err := h.Initialize(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+	r.NoError(h.Save(config, state))
+	configBefore, err := ioutil.ReadFile(filepath.Join(h.ModuleDirectoryPath, "config.json"))
+	r.NoError(err)
+	stateBefore, err := ioutil.ReadFile(filepath.Join(h.ModuleDirectoryPath, "state.json"))
+	r.NoError(err)
+
+	// valid state and invalid config are not saved at all
+	state.(*azbi.State).Status = "applied"
+	config.(*azbi.Config).Params.Name = nil
+	r.Error(h.Save(config, state))
+
+	configAfter, err := ioutil.ReadFile(filepath.Join(h.ModuleDirectoryPath, "config.json"))
+	r.NoError(err)
+	a.Equal(string(configBefore), string(configAfter))
+	stateAfter, err := ioutil.ReadFile(filepath.Join(h.ModuleDirectoryPath, "state.json"))
+	r.NoError(err)
+	a.Equal(string(stateBefore), string(stateAfter))
+
+	matches, err := filepath.Glob(filepath.Join(h.ModuleDirectoryPath, ".*"))
+	r.NoError(err)
+	a.Empty(matches)
+}
+
+func TestInfrastructureModuleHelper_SaveConflict(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	h := InfrastructureModuleHelper{
+		ModuleDirectoryPath: t.TempDir(),
+		ModuleVersion:       "v0.0.1",
+	}
+	config, state, err := h.Initialize(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+	r.NoError(h.Save(config, state))
+
+	// two runs load the same state
+	config1, state1, err := h.Load(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+	config2, state2, err := h.Load(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+
+	r.NoError(h.Save(config1, state1))
+	serial, _ := state1.(*azbi.State).GetSerial()
+	a.Equal(2, serial)
+
+	err = h.Save(config2, state2)
+	var cerr shared.ConflictError
+	r.True(errors.As(err, &cerr))
+	a.Equal(1, cerr.Expected)
+	a.Equal(2, cerr.Found)
+	serial, _ = state2.(*azbi.State).GetSerial()
+	a.Equal(1, serial)
+}
+
+// racingStorage calls race once when next document is created in it, i.e. while backup is taken.
+type racingStorage struct {
+	*storage.Memory
+	race func()
+}
+
+func (s *racingStorage) Create(name string, data []byte) error {
+	if race := s.race; race != nil {
+		s.race = nil
+		race()
+	}
+	return s.Memory.Create(name, data)
+}
+
+func TestInfrastructureModuleHelper_SaveConcurrent(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	st := &racingStorage{Memory: storage.NewMemory()}
+	h := InfrastructureModuleHelper{
+		ModuleVersion: "v0.0.1",
+		Storage:       st,
+	}
+	config, state, err := h.Initialize(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+	r.NoError(h.Save(config, state))
+
+	// other run saves the same state after this one checked serial but before it replaced state
+	otherConfig, other, err := h.Load(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+	st.race = func() {
+		other.(*azbi.State).Status = "destroyed"
+		r.NoError(h.Save(otherConfig, other))
+	}
+	state.(*azbi.State).Status = "applied"
+	err = h.Save(config, state)
+	a.Equal(shared.ConflictError{Path: "state.json", Expected: 1, Found: 2}, err)
+	serial, _ := state.(*azbi.State).GetSerial()
+	a.Equal(1, serial)
+
+	_, state, err = h.Load(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+	a.Equal(shared.Status("destroyed"), state.(*azbi.State).Status)
+}
+
+func TestInfrastructureModuleHelper_SaveKeepsFormat(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	st := storage.NewMemory()
+	h := InfrastructureModuleHelper{
+		ModuleVersion: "v0.0.1",
+		Storage:       st,
+	}
+	config, state, err := h.Initialize(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+	r.NoError(h.Save(config, state))
+
+	// user rewrites config.json in YAML
+	b, err := st.Read("config.json")
+	r.NoError(err)
+	b, err = shared.ToYAML(b)
+	r.NoError(err)
+	r.NoError(st.Write("config.json", b))
+
+	config, state, err = h.Load(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+	config.(*azbi.Config).Params.Name = to.StrPtr("renamed")
+	r.NoError(h.Save(config, state))
+
+	b, err = st.Read("config.json")
+	r.NoError(err)
+	a.Equal(shared.YAML, shared.DetectFormat("config.json", b))
+	want, err := config.PrintYAML()
+	r.NoError(err)
+	a.Equal(string(want), string(b))
+	b, err = st.Read("state.json")
+	r.NoError(err)
+	a.Equal(shared.JSON, shared.DetectFormat("state.json", b))
+
+	config, _, err = h.Load(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+	a.Equal("renamed", *config.(*azbi.Config).Params.Name)
+}
+
+func TestInfrastructureModuleHelper_Storage(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage func(t *testing.T) storage.Storage
+	}{
+		{
+			name: "memory",
+			storage: func(t *testing.T) storage.Storage {
+				return storage.NewMemory()
+			},
+		},
+		{
+			name: "s3",
+			storage: func(t *testing.T) storage.Storage {
+				server := test.NewS3Server("modules", "key", "secret")
+				t.Cleanup(server.Close)
+				return storage.NewS3(storage.S3Config{
+					Endpoint:        server.URL,
+					Region:          "us-east-1",
+					Bucket:          "modules",
+					Prefix:          "azbi/",
+					AccessKeyID:     "key",
+					SecretAccessKey: "secret",
+				})
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			r := require.New(t)
+			st := tt.storage(t)
+			h := InfrastructureModuleHelper{
+				ModuleVersion: "v0.0.1",
+				Storage:       st,
+			}
+			s, err := h.Open()
+			r.NoError(err)
+			config, state, err := s.Initialize(&azbi.Config{}, &azbi.State{})
+			r.NoError(err)
+			state.(*azbi.State).Status = "applied"
+			r.NoError(s.Save(config, state))
+			r.NoError(s.Close())
+
+			names, err := st.List("")
+			r.NoError(err)
+			a.Contains(names, "config.json")
+			a.Contains(names, "state.json")
+			a.NotContains(names, ".lock")
+
+			_, state, err = h.Load(&azbi.Config{}, &azbi.State{})
+			r.NoError(err)
+			a.Equal(shared.Status("applied"), state.(*azbi.State).Status)
+			backups, err := h.ListBackups()
+			r.NoError(err)
+			a.NotEmpty(backups)
+
+			// state saved by someone else in the meantime is not overwritten
+			_, other, err := h.Load(&azbi.Config{}, &azbi.State{})
+			r.NoError(err)
+			r.NoError(h.Save(config, other))
+			var cerr shared.ConflictError
+			a.True(errors.As(h.Save(config, state), &cerr))
+		})
+	}
+}
+
+func TestInfrastructureModuleHelper_KeyProvider(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	k, err := shared.GenerateKeyFile(filepath.Join(t.TempDir(), "key"))
+	r.NoError(err)
+	st := storage.NewMemory()
+	h := InfrastructureModuleHelper{
+		ModuleVersion: "v0.0.1",
+		Storage:       st,
+		KeyProvider:   k,
+	}
+	// helper without key provider working at the same time isn't affected
+	plain := InfrastructureModuleHelper{
+		ModuleVersion: "v0.0.1",
+		Storage:       storage.NewMemory(),
+	}
+
+	for _, helper := range []InfrastructureModuleHelper{h, plain} {
+		config, state, err := helper.Initialize(&azks.Config{}, &azks.State{})
+		r.NoError(err)
+		state.(*azks.State).Output = &azks.Output{KubeConfig: to.StrPtr("apiVersion: v1\nkind: Config\n")}
+		r.NoError(helper.Save(config, state))
+		// initialize again to back up decoded structures as well
+		_, _, err = helper.Initialize(&azks.Config{}, &azks.State{})
+		r.NoError(err)
+	}
+
+	names, err := st.List("")
+	r.NoError(err)
+	encrypted := make([]string, 0)
+	for _, name := range names {
+		b, err := st.Read(name)
+		r.NoError(err)
+		a.NotContains(string(b), "kind: Config", name)
+		if strings.Contains(string(b), `"kubeconfig": "enc:v1:`+k.KeyID()+`:`) {
+			encrypted = append(encrypted, name)
+		}
+	}
+	// saved state, its raw backup taken by second Initialize and backup of decoded state
+	a.Len(encrypted, 3)
+	a.Contains(encrypted, "state.json")
+	b, err := plain.Storage.Read("state.json")
+	r.NoError(err)
+	a.Contains(string(b), `"kubeconfig": "apiVersion: v1\nkind: Config\n"`)
+
+	_, state, err := h.Load(&azks.Config{}, &azks.State{})
+	r.NoError(err)
+	a.Equal("apiVersion: v1\nkind: Config\n", *state.(*azks.State).Output.KubeConfig)
+	h.KeyProvider = nil
+	_, _, err = h.Load(&azks.Config{}, &azks.State{})
+	a.Error(err)
+}
@@ -0,0 +1,137 @@
+package imh
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/epiphany-platform/e-structures/shared"
+	"github.com/epiphany-platform/e-structures/storage"
+	"os"
+)
+
+// ReasonPreRestore is recorded in manifest of backup taken just before other backup is restored.
+const ReasonPreRestore = "pre-restore"
+
+// Restore replaces module config and state files with ones stored in backup identified by id (including Legacy
+// backups, see ListBackups). Untouched (raw) copy of document is restored if backup has one, decoded copy
+// otherwise. Both documents are validated with
+// provided Modulators (upgrade is allowed) and current files are backed up before they get replaced. Loaded
+// structures are returned.
+func (h InfrastructureModuleHelper) Restore(id string, config Modulator, state Modulator) (Modulator, Modulator, error) {
+	// check if required fields are set
+	if h.ModuleVersion == "" {
+		return nil, nil, fmt.Errorf("setup module version first")
+	}
+	st, err := h.storage()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	backups, err := h.ListBackups()
+	if err != nil {
+		return nil, nil, err
+	}
+	var manifest *BackupManifest
+	for i := range backups {
+		if backups[i].ID == id {
+			manifest = &backups[i]
+			break
+		}
+	}
+	if manifest == nil {
+		return nil, nil, fmt.Errorf("backup %s not found", id)
+	}
+
+	// stage restored documents so they can be validated before anything is replaced
+	staging := storage.NewMemory()
+	err = stage(st, *manifest, "config", staging, configFileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = stage(st, *manifest, "state", staging, stateFileName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// validate staged documents
+	err = load(state, staging, stateFileName, h.decodeOptions())
+	if err != nil {
+		return nil, nil, fmt.Errorf("restored state is incorrect: %v", err)
+	}
+	err = load(config, staging, configFileName, h.decodeOptions())
+	if err != nil {
+		return nil, nil, fmt.Errorf("restored config is incorrect: %v", err)
+	}
+
+	// current state is replaced only if nobody saves it in the meantime
+	_, stateVersion, err := storage.ReadVersion(st, stateFileName)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	// safety backup of current files
+	run, err := h.newBackupRun(st)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = run.raw("config", configFileName, config)
+	if err != nil {
+		return nil, nil, run.abort(err)
+	}
+	err = run.raw("state", stateFileName, state)
+	if err != nil {
+		return nil, nil, run.abort(err)
+	}
+	err = run.finish(ReasonPreRestore)
+	if err != nil {
+		return nil, nil, run.abort(err)
+	}
+
+	// replace files
+	err = replace(st, staging, stateVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return config, state, nil
+}
+
+// stage copies document from backup into document name in staging storage. Checksum of raw documents is verified.
+func stage(st storage.Storage, manifest BackupManifest, document string, staging storage.Storage, name string) error {
+	var file *BackupFile
+	for i := range manifest.Files {
+		f := manifest.Files[i]
+		if f.Document != document {
+			continue
+		}
+		if file == nil || f.Raw {
+			file = &f
+		}
+	}
+	if file == nil {
+		return fmt.Errorf("backup %s does not contain %s", manifest.ID, document)
+	}
+
+	b, err := st.Read(backupFileName(manifest, *file))
+	if err != nil {
+		return err
+	}
+	if file.Checksum != "" {
+		sum := sha256.Sum256(b)
+		if hex.EncodeToString(sum[:]) != file.Checksum {
+			return fmt.Errorf("checksum of %s in backup %s does not match", file.Name, manifest.ID)
+		}
+	}
+
+	return staging.Write(name, b)
+}
+
+// load loads structure from document falling back to upgrade if it is in older version.
+func load(m Modulator, st storage.Storage, name string, options []shared.DecodeOption) error {
+	err := m.LoadFrom(st, name, options...)
+	if errors.As(err, &ncverr) {
+		return m.UpgradeFrom(st, name, options...)
+	}
+	return err
+}
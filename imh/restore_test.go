@@ -0,0 +1,200 @@
+package imh
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	azbi "github.com/epiphany-platform/e-structures/azbi/v0"
+	"github.com/epiphany-platform/e-structures/shared"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInfrastructureModuleHelper_Restore(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	h := InfrastructureModuleHelper{
+		ModuleDirectoryPath: t.TempDir(),
+		ModuleVersion:       "v0.0.1",
+	}
+	oldConfig := `{
+	"meta": {
+		"kind": "azbiConfig",
+		"version": "v0.2.0",
+		"module_version": "v0.0.1"
+	},
+	"params": {
+		"name": "restored",
+		"location": "northeurope",
+		"address_space": ["10.0.0.0/16"],
+		"rsa_pub_path": "/shared/vms_rsa.pub",
+		"subnets": [{"name": "main", "address_prefixes": ["10.0.1.0/24"]}],
+		"vm_groups": []
+	}
+}`
+	r.NoError(ioutil.WriteFile(filepath.Join(h.ModuleDirectoryPath, "config.json"), []byte(oldConfig), 0644))
+
+	// first run upgrades config and initializes state, saving it creates backup without state
+	config, state, err := h.Initialize(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+	config.(*azbi.Config).Init("v0.0.1")
+	r.NoError(h.Save(config, state))
+
+	backups, err := h.ListBackups()
+	r.NoError(err)
+	r.Len(backups, 2)
+	r.Equal(ReasonPreUpgrade, backups[0].Reason)
+
+	t.Run("unknown backup", func(t *testing.T) {
+		_, _, err := h.Restore("unknown", &azbi.Config{}, &azbi.State{})
+		assert.EqualError(t, err, "backup unknown not found")
+	})
+
+	t.Run("incomplete backup", func(t *testing.T) {
+		_, _, err := h.Restore(backups[1].ID, &azbi.Config{}, &azbi.State{})
+		assert.EqualError(t, err, "backup "+backups[1].ID+" does not contain state")
+	})
+
+	t.Run("restore upgraded config", func(t *testing.T) {
+		restoredConfig, _, err := h.Restore(backups[0].ID, &azbi.Config{}, &azbi.State{})
+		r.NoError(err)
+		a.Equal("restored", *restoredConfig.(*azbi.Config).Params.Name)
+		a.Equal("v0.2.1", *restoredConfig.(*azbi.Config).Meta.Version)
+
+		b, err := ioutil.ReadFile(filepath.Join(h.ModuleDirectoryPath, "config.json"))
+		r.NoError(err)
+		a.Equal(oldConfig, string(b))
+
+		after, err := h.ListBackups()
+		r.NoError(err)
+		r.Len(after, 3)
+		a.Equal(ReasonPreRestore, after[2].Reason)
+		b, err = ioutil.ReadFile(filepath.Join(h.ModuleDirectoryPath, "backup", after[2].ID, "config.raw.json"))
+		r.NoError(err)
+		a.Contains(string(b), `"name": "unknown"`)
+
+		matches, err := filepath.Glob(filepath.Join(h.ModuleDirectoryPath, ".staging-*"))
+		r.NoError(err)
+		a.Empty(matches)
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		r.NoError(ioutil.WriteFile(filepath.Join(h.ModuleDirectoryPath, "backup", backups[0].ID, "config.raw.json"), []byte(`{}`), 0644))
+		_, _, err := h.Restore(backups[0].ID, &azbi.Config{}, &azbi.State{})
+		assert.EqualError(t, err, "checksum of config.raw.json in backup "+backups[0].ID+" does not match")
+	})
+}
+
+func TestInfrastructureModuleHelper_RestoreLegacy(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	h := InfrastructureModuleHelper{
+		ModuleDirectoryPath: t.TempDir(),
+		ModuleVersion:       "v0.0.1",
+	}
+	// backup directory written by helper before backups got manifests
+	legacyConfig := `{
+	"meta": {
+		"kind": "azbiConfig",
+		"version": "v0.2.1",
+		"module_version": "v0.0.1"
+	},
+	"params": {
+		"name": "legacy",
+		"location": "northeurope",
+		"address_space": [
+			"10.0.0.0/16"
+		],
+		"subnets": [
+			{
+				"name": "main",
+				"address_prefixes": [
+					"10.0.1.0/24"
+				]
+			}
+		],
+		"vm_groups": [
+			{
+				"name": "vm-group-0",
+				"vm_count": 1,
+				"vm_size": "Standard_DS2_v2",
+				"use_public_ip": true,
+				"subnet_names": [
+					"main"
+				],
+				"vm_image": {
+					"publisher": "Canonical",
+					"offer": "UbuntuServer",
+					"sku": "18.04-LTS",
+					"version": "18.04.202006101"
+				},
+				"data_disks": [
+					{
+						"disk_size_gb": 10,
+						"storage_type": "Premium_LRS"
+					}
+				]
+			}
+		],
+		"admin_username": "operations",
+		"rsa_pub_path": "/shared/vms_rsa.pub"
+	}
+}`
+	legacyState := `{
+	"meta": {
+		"kind": "azbiState",
+		"version": "v0.0.2",
+		"module_version": "v0.0.1"
+	},
+	"status": "applied",
+	"config": null,
+	"output": null
+}`
+	backupDirectory := filepath.Join(h.ModuleDirectoryPath, "backup")
+	r.NoError(os.MkdirAll(backupDirectory, os.ModePerm))
+	r.NoError(ioutil.WriteFile(filepath.Join(backupDirectory, "config-20210105-101112.0123.json"), []byte(legacyConfig), 0644))
+	r.NoError(ioutil.WriteFile(filepath.Join(backupDirectory, "state-20210105-101112.0123.json"), []byte(legacyState), 0644))
+	r.NoError(ioutil.WriteFile(filepath.Join(backupDirectory, "notes.txt"), []byte("not a backup"), 0644))
+
+	s, err := h.Open()
+	r.NoError(err)
+	defer s.Close()
+	_, _, err = s.Initialize(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+
+	backups, err := h.ListBackups()
+	r.NoError(err)
+	r.Len(backups, 2)
+	legacy := backups[0]
+	a.Equal("20210105-101112.0123", legacy.ID)
+	a.True(legacy.Legacy)
+	a.Equal(time.Date(2021, 1, 5, 10, 11, 12, 12300000, time.Local), legacy.CreatedAt)
+	a.Equal([]BackupFile{
+		{Name: "config-20210105-101112.0123.json", Document: "config", Version: "v0.2.1"},
+		{Name: "state-20210105-101112.0123.json", Document: "state", Version: "v0.0.2"},
+	}, legacy.Files)
+
+	config, state, err := s.Restore(legacy.ID, &azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+	a.Equal("legacy", *config.(*azbi.Config).Params.Name)
+	a.Equal(shared.Status("applied"), state.(*azbi.State).Status)
+	b, err := ioutil.ReadFile(filepath.Join(h.ModuleDirectoryPath, "config.json"))
+	r.NoError(err)
+	a.Equal(legacyConfig, string(b))
+	b, err = ioutil.ReadFile(filepath.Join(h.ModuleDirectoryPath, "state.json"))
+	r.NoError(err)
+	a.Equal(legacyState, string(b))
+
+	// legacy backups are subject to retention policy as well
+	h.Retention = RetentionPolicy{KeepLast: 1}
+	removed, err := h.PruneBackups()
+	r.NoError(err)
+	a.Contains(removed, legacy.ID)
+	_, err = os.Stat(filepath.Join(backupDirectory, "config-20210105-101112.0123.json"))
+	a.True(os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(backupDirectory, "notes.txt"))
+	a.NoError(err)
+}
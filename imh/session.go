@@ -0,0 +1,94 @@
+package imh
+
+import (
+	"errors"
+	"github.com/epiphany-platform/e-structures/storage"
+)
+
+const lockName = ".lock"
+
+// ErrSessionClosed is returned by Session methods called after Session.Close.
+var ErrSessionClosed = errors.New("session is closed")
+
+// LockOwner describes process holding module directory lock.
+type LockOwner = storage.LockOwner
+
+// LockedError is returned when module directory lock could not be taken before timeout.
+type LockedError = storage.LockedError
+
+// Session is exclusive access to module directory held between Load and Save of single module run. It MUST be
+// closed to release module directory lock.
+type Session struct {
+	helper InfrastructureModuleHelper
+	lock   storage.Lock
+	closed bool
+}
+
+// Open takes exclusive lock of module directory waiting for it at most LockTimeout and returns Session
+// operating on that directory. LockedError is returned if lock is held by other process after timeout.
+func (h InfrastructureModuleHelper) Open() (*Session, error) {
+	st, err := h.storage()
+	if err != nil {
+		return nil, err
+	}
+	l, err := st.Lock(lockName, h.LockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{helper: h, lock: l}, nil
+}
+
+// StaleOwner returns owner of previous lock of module directory if it wasn't released properly (i.e. previous
+// run crashed), nil otherwise.
+func (s *Session) StaleOwner() *LockOwner {
+	return s.lock.StaleOwner()
+}
+
+// Initialize works like InfrastructureModuleHelper.Initialize within locked module directory.
+func (s *Session) Initialize(config Modulator, state Modulator) (Modulator, Modulator, error) {
+	if s.closed {
+		return nil, nil, ErrSessionClosed
+	}
+	return s.helper.Initialize(config, state)
+}
+
+// Load works like InfrastructureModuleHelper.Load within locked module directory.
+func (s *Session) Load(config Modulator, state Modulator) (Modulator, Modulator, error) {
+	if s.closed {
+		return nil, nil, ErrSessionClosed
+	}
+	return s.helper.Load(config, state)
+}
+
+// Save works like InfrastructureModuleHelper.Save within locked module directory.
+func (s *Session) Save(config Modulator, state Modulator) error {
+	if s.closed {
+		return ErrSessionClosed
+	}
+	return s.helper.Save(config, state)
+}
+
+// Restore works like InfrastructureModuleHelper.Restore within locked module directory.
+func (s *Session) Restore(id string, config Modulator, state Modulator) (Modulator, Modulator, error) {
+	if s.closed {
+		return nil, nil, ErrSessionClosed
+	}
+	return s.helper.Restore(id, config, state)
+}
+
+// Downgrade works like InfrastructureModuleHelper.Downgrade within locked module directory.
+func (s *Session) Downgrade(config Modulator, state Modulator, configVersion, stateVersion string, force bool) error {
+	if s.closed {
+		return ErrSessionClosed
+	}
+	return s.helper.Downgrade(config, state, configVersion, stateVersion, force)
+}
+
+// Close releases module directory lock. It is safe to call it more than once.
+func (s *Session) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.lock.Release()
+}
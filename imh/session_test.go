@@ -0,0 +1,78 @@
+package imh
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	azbi "github.com/epiphany-platform/e-structures/azbi/v0"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInfrastructureModuleHelper_Open(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	h := InfrastructureModuleHelper{
+		ModuleDirectoryPath: t.TempDir(),
+		ModuleVersion:       "v0.0.1",
+		LockTimeout:         100 * time.Millisecond,
+	}
+
+	s, err := h.Open()
+	r.NoError(err)
+	a.Nil(s.StaleOwner())
+	config, state, err := s.Initialize(&azbi.Config{}, &azbi.State{})
+	r.NoError(err)
+
+	// other run cannot start
+	_, err = h.Open()
+	var lerr LockedError
+	r.True(errors.As(err, &lerr))
+	r.NotNil(lerr.Owner)
+	a.Equal(os.Getpid(), lerr.Owner.PID)
+
+	r.NoError(s.Save(config, state))
+	r.NoError(s.Close())
+	r.NoError(s.Close())
+	_, _, err = s.Load(&azbi.Config{}, &azbi.State{})
+	a.Equal(ErrSessionClosed, err)
+
+	// other run waits for lock
+	s, err = h.Open()
+	r.NoError(err)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = s.Close()
+	}()
+	h.LockTimeout = 5 * time.Second
+	s2, err := h.Open()
+	r.NoError(err)
+	a.Nil(s2.StaleOwner())
+	_, _, err = s2.Load(&azbi.Config{}, &azbi.State{})
+	a.NoError(err)
+	r.NoError(s2.Close())
+}
+
+func TestInfrastructureModuleHelper_OpenStale(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	h := InfrastructureModuleHelper{
+		ModuleDirectoryPath: t.TempDir(),
+		ModuleVersion:       "v0.0.1",
+	}
+	// lock left by process which crashed
+	host, err := os.Hostname()
+	r.NoError(err)
+	r.NoError(ioutil.WriteFile(filepath.Join(h.ModuleDirectoryPath, ".lock"), []byte(`{"pid": 999999999, "host": "`+host+`", "created_at": "2021-01-01T00:00:00Z"}`), 0644))
+
+	s, err := h.Open()
+	r.NoError(err)
+	r.NotNil(s.StaleOwner())
+	a.Equal(999999999, s.StaleOwner().PID)
+	a.Equal(host, s.StaleOwner().Host)
+	r.NoError(s.Close())
+}
@@ -0,0 +1,85 @@
+package schema
+
+import (
+	"fmt"
+	awsbi "github.com/epiphany-platform/e-structures/awsbi/v0"
+	azbi "github.com/epiphany-platform/e-structures/azbi/v0"
+	azks "github.com/epiphany-platform/e-structures/azks/v0"
+	hi "github.com/epiphany-platform/e-structures/hi/v0"
+	st "github.com/epiphany-platform/e-structures/state/v0"
+	"reflect"
+)
+
+//go:generate go test -run TestDocuments -update
+
+// BaseID is prefix of $id of generated schemas. It points to directory schemas are committed to.
+const BaseID = "https://raw.githubusercontent.com/epiphany-platform/e-structures/develop/schema/"
+
+// Document is single generated JSON Schema document.
+type Document struct {
+	Kind    string
+	Version string
+	Schema  []byte
+}
+
+// Name returns name of file schema is stored in, i.e. azbiConfig-v0.2.1.schema.json.
+func (d Document) Name() string {
+	return fmt.Sprintf("%s-%s.schema.json", d.Kind, d.Version)
+}
+
+// initializer is implemented by configs and states of all modules.
+type initializer interface {
+	Init(moduleVersion string)
+}
+
+// Documents generates schemas of current versions of all configs and states.
+func Documents() ([]Document, error) {
+	structures := []interface{}{
+		initialized(&azbi.Config{}),
+		initialized(&azbi.State{}),
+		initialized(&awsbi.Config{}),
+		initialized(&awsbi.State{}),
+		initialized(&azks.Config{}),
+		initialized(&azks.State{}),
+		initialized(&hi.Config{}),
+		initialized(&hi.State{}),
+		st.NewState(),
+	}
+	result := make([]Document, 0, len(structures))
+	for _, s := range structures {
+		kind, version, err := kindAndVersion(s)
+		if err != nil {
+			return nil, err
+		}
+		d := Document{Kind: kind, Version: version}
+		d.Schema, err = Generate(BaseID+d.Name(), kind+" "+version, s)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %v", kind, version, err)
+		}
+		result = append(result, d)
+	}
+	return result, nil
+}
+
+func initialized(i initializer) interface{} {
+	i.Init("")
+	return i
+}
+
+// kindAndVersion reads kind and version of structure either from its Meta (modules) or from top level fields
+// (state).
+func kindAndVersion(s interface{}) (string, string, error) {
+	v := reflect.Indirect(reflect.ValueOf(s))
+	if m := v.FieldByName("Meta"); m.IsValid() {
+		v = reflect.Indirect(m)
+	}
+	kind, ok := v.FieldByName("Kind").Interface().(*string)
+	if !ok || kind == nil {
+		return "", "", fmt.Errorf("%T has no kind", s)
+	}
+	version, ok := v.FieldByName("Version").Interface().(*string)
+	if !ok || version == nil {
+		return "", "", fmt.Errorf("%T has no version", s)
+	}
+	return *kind, *version, nil
+}
@@ -0,0 +1,122 @@
+package schema
+
+import (
+	"flag"
+	"io/ioutil"
+	"regexp"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update committed schemas")
+
+// TestDocuments checks that committed schemas are in sync with structures. Run `go generate ./schema` after
+// changing them.
+func TestDocuments(t *testing.T) {
+	r := require.New(t)
+	documents, err := Documents()
+	r.NoError(err)
+	r.Len(documents, 9)
+	for _, d := range documents {
+		t.Run(d.Name(), func(t *testing.T) {
+			path := d.Name()
+			if *update {
+				require.NoError(t, ioutil.WriteFile(path, d.Schema, 0644))
+			}
+			b, err := ioutil.ReadFile(path)
+			require.NoError(t, err, "run `go generate ./schema`")
+			assert.Equal(t, string(d.Schema), string(b), "run `go generate ./schema`")
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	type nested struct {
+		Value *string `json:"value" validate:"required,eq=a|eq=b"`
+	}
+	type valid struct {
+		Public  *string  `json:"public" validate:"required_without=Private"`
+		Private *string  `json:"private" validate:"required_without=Public"`
+		Count   *int     `json:"count,omitempty" validate:"omitempty,min=1"`
+		Names   []string `json:"names" validate:"omitempty,dive,min=1"`
+		Tags    []string `json:"tags" validate:"omitempty,min=1"`
+		Version *string  `json:"version" validate:"required,version=~0"`
+		Nested  *nested  `json:"nested" validate:"required"`
+		Unused  []string `json:"-"`
+	}
+	type invalid struct {
+		Email *string `json:"email" validate:"required,email"`
+	}
+	type zeroSkipped struct {
+		Count int `json:"count" validate:"omitempty,min=1"`
+	}
+
+	a := assert.New(t)
+	r := require.New(t)
+	b, err := Generate("valid.json", "valid", &valid{})
+	r.NoError(err)
+	a.JSONEq(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id": "valid.json",
+		"title": "valid",
+		"type": "object",
+		"properties": {
+			"public": {"type": ["string", "null"]},
+			"private": {"type": ["string", "null"]},
+			"count": {"type": ["integer", "null"], "minimum": 1},
+			"names": {"type": ["array", "null"], "items": {"type": "string", "minLength": 1}},
+			"tags": {"type": ["array", "null"], "minItems": 1, "items": {"type": "string"}},
+			"version": {"type": "string", "pattern": "^v?0(\\.[0-9]+){0,2}(\\+[0-9A-Za-z-]+(\\.[0-9A-Za-z-]+)*)?$"},
+			"nested": {
+				"type": "object",
+				"properties": {"value": {"type": "string", "enum": ["a", "b"]}},
+				"required": ["value"]
+			}
+		},
+		"required": ["version", "nested"],
+		"allOf": [
+			{
+				"if": {"not": {"properties": {"private": {"not": {"type": "null"}}}, "required": ["private"]}},
+				"then": {"properties": {"public": {"not": {"type": "null"}}}, "required": ["public"]}
+			},
+			{
+				"if": {"not": {"properties": {"public": {"not": {"type": "null"}}}, "required": ["public"]}},
+				"then": {"properties": {"private": {"not": {"type": "null"}}}, "required": ["private"]}
+			}
+		]
+	}`, string(b))
+
+	_, err = Generate("invalid.json", "invalid", &invalid{})
+	a.EqualError(err, "invalid.Email: validation tag email is not supported")
+
+	_, err = Generate("zero.json", "zero", &zeroSkipped{})
+	a.EqualError(err, "zeroSkipped.Count: omitempty: only nullable fields are supported")
+}
+
+// TestGenerate_OmitEmpty checks that validator skips rules of nil slices only, so generated schema allows null
+// but keeps minItems for empty array.
+func TestGenerate_OmitEmpty(t *testing.T) {
+	type tagged struct {
+		Tags []string `json:"tags" validate:"omitempty,min=1"`
+	}
+	a := assert.New(t)
+	validate := validator.New()
+	a.NoError(validate.Struct(tagged{}))
+	a.Error(validate.Struct(tagged{Tags: []string{}}))
+	a.NoError(validate.Struct(tagged{Tags: []string{"a"}}))
+}
+
+func TestGenerate_Version(t *testing.T) {
+	c, err := semver.NewConstraint("~0")
+	require.NoError(t, err)
+	pattern := regexp.MustCompile(`^v?0(\.[0-9]+){0,2}(\+[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?$`)
+	for _, v := range []string{"v0.1.0", "0.1.0", "v0.1", "v0", "v0.1.0+build.1", "v0.1.0-rc1", "v0.1.0x", "v1.0.0", "v0.1.0.1"} {
+		sv, err := semver.NewVersion(v)
+		valid := err == nil && c.Check(sv)
+		assert.Equal(t, valid, pattern.MatchString(v), v)
+	}
+}
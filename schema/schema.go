@@ -0,0 +1,374 @@
+// Package schema generates JSON Schema (draft 2020-12) documents of structures from their json and validate struct
+// tags, so files can be validated by editors and tools written in other languages.
+//
+// Only rules expressed with struct tags are translated. Custom struct level validations (like
+// AzBISubnetsValidation) and cross-field comparisons (like gtefield) can't be expressed in JSON Schema and are
+// at most described with $comment keyword.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const draft = "https://json-schema.org/draft/2020-12/schema"
+
+// cidrPattern matches IPv4 or IPv6 address followed by prefix length.
+const cidrPattern = `^(((25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])\.){3}(25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])/(3[0-2]|[12]?[0-9])|[0-9A-Fa-f:.]*:[0-9A-Fa-f:.]*/(12[0-8]|1[01][0-9]|[1-9]?[0-9]))$`
+
+// Schema is JSON Schema document or subschema. Only keywords used by generator are supported.
+type Schema struct {
+	Schema     string        `json:"$schema,omitempty"`
+	ID         string        `json:"$id,omitempty"`
+	Title      string        `json:"title,omitempty"`
+	Comment    string        `json:"$comment,omitempty"`
+	Type       interface{}   `json:"type,omitempty"`
+	Enum       []interface{} `json:"enum,omitempty"`
+	Pattern    string        `json:"pattern,omitempty"`
+	MinLength  *int          `json:"minLength,omitempty"`
+	MaxLength  *int          `json:"maxLength,omitempty"`
+	Minimum    *int          `json:"minimum,omitempty"`
+	Maximum    *int          `json:"maximum,omitempty"`
+	MinItems   *int          `json:"minItems,omitempty"`
+	MaxItems   *int          `json:"maxItems,omitempty"`
+	Items      *Schema       `json:"items,omitempty"`
+	Properties *Properties   `json:"properties,omitempty"`
+	Required   []string      `json:"required,omitempty"`
+	Additional *Schema       `json:"additionalProperties,omitempty"`
+	AllOf      []*Schema     `json:"allOf,omitempty"`
+	If         *Schema       `json:"if,omitempty"`
+	Then       *Schema       `json:"then,omitempty"`
+	Not        *Schema       `json:"not,omitempty"`
+}
+
+// Properties are properties of object schema kept in order of structure fields.
+type Properties struct {
+	names   []string
+	schemas map[string]*Schema
+}
+
+func (p *Properties) add(name string, s *Schema) {
+	if p.schemas == nil {
+		p.schemas = make(map[string]*Schema)
+	}
+	p.names = append(p.names, name)
+	p.schemas[name] = s
+}
+
+func (p *Properties) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("{")
+	for i, name := range p.names {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		k, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(p.schemas[name])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteString(":")
+		b.Write(v)
+	}
+	b.WriteString("}")
+	return b.Bytes(), nil
+}
+
+// Generate returns indented JSON Schema document with provided id and title describing structure pointed by v.
+func Generate(id string, title string, v interface{}) ([]byte, error) {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	s, err := typeSchema(t)
+	if err != nil {
+		return nil, err
+	}
+	s.Schema = draft
+	s.ID = id
+	s.Title = title
+	b, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// typeSchema returns schema of non-null value of type t.
+func typeSchema(t reflect.Type) (*Schema, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}, nil
+	case reflect.Interface:
+		return &Schema{}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map %s: only string keys are supported", t)
+		}
+		values, err := typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "object", Additional: values}, nil
+	case reflect.Struct:
+		return structSchema(t)
+	}
+	return nil, fmt.Errorf("type %s is not supported", t)
+}
+
+func structSchema(t reflect.Type) (*Schema, error) {
+	s := &Schema{Type: "object", Properties: &Properties{}}
+	jsonNames := make(map[string]string)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if name := jsonName(f); name != "" {
+			jsonNames[f.Name] = name
+		}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := jsonNames[f.Name]
+		if f.PkgPath != "" || name == "" {
+			continue
+		}
+		fs, err := typeSchema(f.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", t.Name(), f.Name, err)
+		}
+		r := &rules{field: name, names: jsonNames}
+		err = r.apply(fs, f.Type, f.Tag.Get("validate"))
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", t.Name(), f.Name, err)
+		}
+		if r.required {
+			s.Required = append(s.Required, name)
+		} else if nullable(f.Type) {
+			fs.Type = []string{fs.Type.(string), "null"}
+		}
+		s.AllOf = append(s.AllOf, r.conditions...)
+		s.Properties.add(name, fs)
+	}
+	return s, nil
+}
+
+// jsonName returns name of field in JSON document or empty string if field is skipped.
+func jsonName(f reflect.StructField) string {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	name := strings.Split(tag, ",")[0]
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// nullable checks if values of type t are encoded as JSON null when not set.
+func nullable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return true
+	}
+	return false
+}
+
+// rules translates validate tag of single field.
+type rules struct {
+	field      string
+	names      map[string]string
+	required   bool
+	conditions []*Schema
+}
+
+// apply translates validate tag into keywords of s which is schema of type t. Rules following dive are applied to
+// items of s.
+func (r *rules) apply(s *Schema, t reflect.Type, tag string) error {
+	if tag == "" {
+		return nil
+	}
+	field := t
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	parts := strings.Split(tag, ",")
+	for i, part := range parts {
+		name, param := part, ""
+		if j := strings.Index(part, "="); j >= 0 {
+			name, param = part[:j], part[j+1:]
+		}
+		switch {
+		case part == "dive":
+			if s.Items == nil {
+				// validator ignores dive on nested structures as it validates them anyway
+				return nil
+			}
+			items := &rules{field: r.field, names: r.names}
+			err := items.applyItems(s.Items, t.Elem(), strings.Join(parts[i+1:], ","))
+			return err
+		case part == "required":
+			r.required = true
+		case part == "omitempty":
+			// validator skips rules of nil values only (null is allowed by type of nullable fields), empty slices
+			// and pointers to zero values are validated. Zero values of other types are skipped, which can't be
+			// expressed with keywords of single type.
+			if !nullable(field) {
+				return fmt.Errorf("%s: only nullable fields are supported", part)
+			}
+		case strings.HasPrefix(part, "eq="):
+			enum, err := enumOf(t, part)
+			if err != nil {
+				return err
+			}
+			s.Enum = enum
+		case name == "min" || name == "max":
+			n, err := strconv.Atoi(param)
+			if err != nil {
+				return fmt.Errorf("%s: %v", part, err)
+			}
+			err = limit(s, t, name, n)
+			if err != nil {
+				return err
+			}
+		case name == "cidr":
+			s.Pattern = cidrPattern
+		case name == "version":
+			if !strings.HasPrefix(param, "~") {
+				return fmt.Errorf("%s: only ~MAJOR constraints are supported", part)
+			}
+			// versions matching ~MAJOR may lack minor or patch and may carry build metadata, pre-releases never match
+			s.Pattern = fmt.Sprintf(`^v?%s(\.[0-9]+){0,2}(\+[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?$`, regexpQuote(strings.TrimPrefix(param, "~")))
+		case name == "required_with" || name == "required_without" || name == "excluded_without":
+			other, ok := r.names[param]
+			if !ok {
+				return fmt.Errorf("%s: unknown field %s", part, param)
+			}
+			r.conditions = append(r.conditions, condition(name, r.field, other))
+		case name == "gtefield" || name == "ltefield":
+			other, ok := r.names[param]
+			if !ok {
+				return fmt.Errorf("%s: unknown field %s", part, param)
+			}
+			relation := "greater than or equal to"
+			if name == "ltefield" {
+				relation = "less than or equal to"
+			}
+			s.Comment = appendComment(s.Comment, fmt.Sprintf("must be %s %s", relation, other))
+		default:
+			return fmt.Errorf("validation tag %s is not supported", part)
+		}
+	}
+	return nil
+}
+
+// applyItems translates tags following dive. Items are nullable unless they are required.
+func (r *rules) applyItems(s *Schema, t reflect.Type, tag string) error {
+	err := r.apply(s, t, tag)
+	if err != nil {
+		return err
+	}
+	if !r.required && nullable(t) {
+		s.Type = []string{s.Type.(string), "null"}
+	}
+	return nil
+}
+
+func enumOf(t reflect.Type, tag string) ([]interface{}, error) {
+	result := make([]interface{}, 0)
+	for _, alternative := range strings.Split(tag, "|") {
+		if !strings.HasPrefix(alternative, "eq=") {
+			return nil, fmt.Errorf("%s: only alternatives of eq are supported", tag)
+		}
+		value := strings.TrimPrefix(alternative, "eq=")
+		switch t.Kind() {
+		case reflect.String:
+			result = append(result, value)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", tag, err)
+			}
+			result = append(result, n)
+		default:
+			return nil, fmt.Errorf("%s: eq is supported for strings and integers only", tag)
+		}
+	}
+	return result, nil
+}
+
+// limit translates min and max tags which meaning depends on type of field.
+func limit(s *Schema, t reflect.Type, name string, n int) error {
+	var min, max **int
+	switch t.Kind() {
+	case reflect.String:
+		min, max = &s.MinLength, &s.MaxLength
+	case reflect.Slice, reflect.Array:
+		min, max = &s.MinItems, &s.MaxItems
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		min, max = &s.Minimum, &s.Maximum
+	default:
+		return fmt.Errorf("%s is not supported for %s", name, t)
+	}
+	if name == "min" {
+		*min = &n
+	} else {
+		*max = &n
+	}
+	return nil
+}
+
+// condition builds schema of object requiring (or excluding) field depending on presence of other field. Fields
+// set to null are considered missing the same way validator considers nil fields empty.
+func condition(name, field, other string) *Schema {
+	switch name {
+	case "required_with":
+		return &Schema{If: present(other), Then: present(field)}
+	case "required_without":
+		return &Schema{If: &Schema{Not: present(other)}, Then: present(field)}
+	default: // excluded_without
+		return &Schema{If: &Schema{Not: present(other)}, Then: &Schema{Not: present(field)}}
+	}
+}
+
+// present builds schema of object having field set to other value than null.
+func present(field string) *Schema {
+	p := &Properties{}
+	p.add(field, &Schema{Not: &Schema{Type: "null"}})
+	return &Schema{Properties: p, Required: []string{field}}
+}
+
+func appendComment(comment, s string) string {
+	if comment == "" {
+		return s
+	}
+	return comment + "; " + s
+}
+
+func regexpQuote(s string) string {
+	return strings.ReplaceAll(s, ".", `\.`)
+}
@@ -1,127 +1,370 @@
 package shared
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"github.com/epiphany-platform/e-structures/storage"
 	maps "github.com/mitchellh/mapstructure"
-	"io/ioutil"
-	"os"
+	"path"
+	"reflect"
+	"strconv"
 )
 
-func Backup(i interface{}, new string) error {
-	if _, err := os.Stat(new); err == nil {
-		// file does exist
-		return os.ErrExist
-	} else if os.IsNotExist(err) {
-		// ok, file does not exist
-	} else {
-		// file may or may not exist. See err for details.
+// ChecksumFileSuffix is appended to path of raw backup to build path of file holding its checksum.
+const ChecksumFileSuffix = ".sha256"
+
+func Backup(i interface{}, new string, options ...EncodeOption) error {
+	st, name := storage.Split(new)
+	return BackupTo(i, st, name, options...)
+}
+
+// BackupTo works like Backup but stores structure as document with provided name in storage st.
+func BackupTo(i interface{}, st storage.Storage, name string, options ...EncodeOption) error {
+	c, err := EncryptedCopy(i, options...)
+	if err != nil {
+		return err
+	}
+	bytes, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
 		return err
 	}
-	bytes, err := json.MarshalIndent(i, "", "\t")
+	if u, ok := i.(WithUnknown); ok {
+		bytes, err = withUnknown(bytes, u.GetUnknown())
+		if err != nil {
+			return err
+		}
+	}
+	bytes, err = toFormat(name, bytes, options)
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(new, bytes, 0644)
+	return st.Create(name, bytes)
+}
+
+// BackupRaw copies untouched content of file pointed by path into new file and stores its SHA-256 checksum next
+// to it in file with ChecksumFileSuffix, in format understood by sha256sum. It fails with os.ErrExist if new
+// file is already in place. It returns hex encoded checksum of copied content.
+func BackupRaw(path, new string) (string, error) {
+	from, name := storage.Split(path)
+	to, newName := storage.Split(new)
+	return BackupRawTo(from, name, to, newName)
 }
 
-func Save(p Printer, path string) error {
-	bytes, err := p.Print()
+// BackupRawTo works like BackupRaw but copies document name from storage from into document new in storage to.
+func BackupRawTo(from storage.Storage, name string, to storage.Storage, new string) (string, error) {
+	b, err := from.Read(name)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	checksum := hex.EncodeToString(sum[:])
+	err = to.Create(new, b)
+	if err != nil {
+		return "", err
+	}
+	line := fmt.Sprintf("%s  %s\n", checksum, path.Base(new))
+	return checksum, to.Write(new+ChecksumFileSuffix, []byte(line))
+}
+
+// Save stores structure in file pointed by path. YAML is written if path has .yaml or .yml extension, JSON
+// otherwise, unless InFormat option is provided.
+func Save(p Printer, path string, options ...EncodeOption) error {
+	st, name := storage.Split(path)
+	return SaveTo(p, st, name, options...)
+}
+
+// SaveTo works like Save but stores structure as document with provided name in storage st.
+func SaveTo(p Printer, st storage.Storage, name string, options ...EncodeOption) error {
+	bytes, err := p.Print(options...)
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(path, bytes, 0644)
+	bytes, err = toFormat(name, bytes, options)
+	if err != nil {
+		return err
+	}
+	return st.Write(name, bytes)
 }
 
-func Print(v Validator) ([]byte, error) {
+func Print(v Validator, options ...EncodeOption) ([]byte, error) {
 	if err := v.Validate(); err != nil {
 		return nil, err
 	}
-	return json.MarshalIndent(v, "", "\t")
+	c, err := EncryptedCopy(v, options...)
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	if u, ok := v.(WithUnknown); ok {
+		// fields unknown to this version of structure are written back, so they are not lost
+		return withUnknown(bytes, u.GetUnknown())
+	}
+	return bytes, nil
 }
 
-func Load(i interface{}, path, version string) (interface{}, error) {
-	_, err := os.Stat(path)
-	if os.IsNotExist(err) {
+// PrintYAML works like Print but produces YAML form of structure.
+func PrintYAML(v Validator, options ...EncodeOption) ([]byte, error) {
+	bytes, err := Print(v, options...)
+	if err != nil {
 		return nil, err
 	}
+	return ToYAML(bytes)
+}
 
-	// TODO backup raw here
+// Load reads structure of type T from file pointed by path (JSON or YAML, see DetectFormat), checks that it is in expected version, validates it
+// and sets list of unused fields (or fails on them if Strict option is provided). Loaded structure is stored in s only if all of those steps succeeded.
+func Load[T any, PT Structure[T]](s PT, path, version string, options ...DecodeOption) error {
+	st, name := storage.Split(path)
+	return LoadFrom[T, PT](s, st, name, version, options...)
+}
 
-	b, err := ioutil.ReadFile(path)
+// LoadFrom works like Load but reads document with provided name from storage st.
+func LoadFrom[T any, PT Structure[T]](s PT, st storage.Storage, name, version string, options ...DecodeOption) error {
+	input, _, err := read(st, name)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var input map[string]interface{}
-	err = json.Unmarshal(b, &input)
+	if err := checkVersion(input, version); err != nil {
+		return err
+	}
+
+	return decode[T, PT](s, input, options)
+}
+
+// Upgrade reads structure of type T from file pointed by path, upgrades it to current version with
+// Upgrader.UpgradeFunc method, validates it and sets list of unused fields. Upgraded structure is stored in s only
+// if all of those steps succeeded.
+func Upgrade[T any, PT UpgradableStructure[T]](s PT, path string, options ...DecodeOption) error {
+	st, name := storage.Split(path)
+	return UpgradeFrom[T, PT](s, st, name, options...)
+}
+
+// UpgradeFrom works like Upgrade but reads document with provided name from storage st.
+func UpgradeFrom[T any, PT UpgradableStructure[T]](s PT, st storage.Storage, name string, options ...DecodeOption) error {
+	input, _, err := read(st, name)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if err := checkVersion(input, version); err != nil {
-		return nil, err
+	err = s.UpgradeFunc(input)
+	if err != nil {
+		return err
 	}
 
-	var md maps.Metadata
-	d, err := maps.NewDecoder(&maps.DecoderConfig{Metadata: &md, TagName: "json", Result: &i})
+	return decode[T, PT](s, input, options)
+}
+
+// Downgrade reads raw structure from file pointed by path, rolls it back to target version using reverse steps
+// registered in m and writes it back to the same file. Untouched content of file is copied into file pointed by
+// backup (see BackupRaw) before it is rewritten. File is not modified if any of steps fails.
+func Downgrade(m *Migrations, path, backup, target string, force bool) ([]AppliedMigration, error) {
+	st, name := storage.Split(path)
+	backupStorage, backupName := storage.Split(backup)
+	return downgrade(m, st, name, backupStorage, backupName, target, force)
+}
+
+// DowngradeFrom works like Downgrade but rewrites document with provided name in storage st and copies its
+// untouched content into document backup in the same storage.
+func DowngradeFrom(m *Migrations, st storage.Storage, name, backup, target string, force bool) ([]AppliedMigration, error) {
+	return downgrade(m, st, name, st, backup, target, force)
+}
+
+func downgrade(m *Migrations, st storage.Storage, name string, backupStorage storage.Storage, backup, target string, force bool) ([]AppliedMigration, error) {
+	input, format, err := read(st, name)
 	if err != nil {
 		return nil, err
 	}
-	err = d.Decode(input)
+	applied, err := m.Downgrade(input, target, force)
 	if err != nil {
 		return nil, err
 	}
-	if u, ok := i.(WithUnused); ok {
-		u.SetUnused(md.Unused)
+	err = refreshHash(input)
+	if err != nil {
+		return nil, err
 	}
-
-	return i, nil
-}
-
-func Upgrade(u Upgrader, path string) (interface{}, error) {
-	_, err := os.Stat(path)
-	if os.IsNotExist(err) {
+	bytes, err := json.MarshalIndent(input, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	// document is written back in format it was found in
+	bytes, err = convert(format, bytes)
+	if err != nil {
 		return nil, err
 	}
+	_, err = BackupRawTo(st, name, backupStorage, backup)
+	if err != nil {
+		return nil, err
+	}
+	return applied, st.Write(name, bytes)
+}
 
-	// TODO backup raw here
+// read returns raw structure stored as document with provided name together with format it was found in (see
+// DetectFormat).
+func read(st storage.Storage, name string) (map[string]interface{}, Format, error) {
+	b, err := st.Read(name)
+	if err != nil {
+		return nil, "", err
+	}
+	return parse(name, b)
+}
 
-	b, err := ioutil.ReadFile(path)
+// parse returns raw structure of document with provided name together with format it is written in.
+func parse(name string, b []byte) (map[string]interface{}, Format, error) {
+	format := DetectFormat(name, b)
+	b, err := ToJSON(name, b)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	var input map[string]interface{}
 	err = json.Unmarshal(b, &input)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
+	return input, format, nil
+}
 
-	err = u.UpgradeFunc(input)
+func decode[T any, PT Structure[T]](s PT, input map[string]interface{}, options []DecodeOption) error {
+	o := newDecodeOptions(options)
+	t, unused, decodeErr := decodeAll[T](input)
+	merr, ok := decodeErr.(*maps.Error)
+	if decodeErr != nil && !ok {
+		return decodeErr
+	}
+	err := DecryptSensitive(&t, options...)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	PT(&t).SetUnused(unused)
+	if u, ok := any(PT(&t)).(WithUnknown); ok {
+		u.SetUnknown(unknownValues(&t, input, unused))
 	}
+	err = PT(&t).Validate()
 
-	var md maps.Metadata
-	d, err := maps.NewDecoder(&maps.DecoderConfig{Metadata: &md, TagName: "json", Result: &u})
-	if err != nil {
-		return nil, err
+	// structure is validated even if some fields couldn't be decoded so all problems are reported at once
+	var problems FieldErrors
+	if merr != nil {
+		problems = append(problems, decodeProblems(merr)...)
+	}
+	if o.strict {
+		problems = append(problems, unknownFields(reflect.TypeOf(t), unused)...)
+	}
+	if len(problems) > 0 {
+		return withProblems(problems, err)
 	}
-	err = d.Decode(input)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if u, ok := u.(WithUnused); ok {
-		u.SetUnused(md.Unused)
+	*s = t
+	return nil
+}
+
+// decodeAll decodes input into structure of type T and returns it with unused fields. mapstructure drops whole
+// nested structure when one of its fields can't be decoded, so such fields are removed from copy of input and
+// decoding is repeated until the rest of document is decoded. Errors of all attempts are returned together.
+func decodeAll[T any](input map[string]interface{}) (T, []string, error) {
+	input = deepCopy(input).(map[string]interface{})
+	var all *maps.Error
+	for {
+		var t T
+		var md maps.Metadata
+		d, err := maps.NewDecoder(&maps.DecoderConfig{Metadata: &md, TagName: "json", Result: &t})
+		if err != nil {
+			return t, nil, err
+		}
+		err = d.Decode(input)
+		merr, ok := err.(*maps.Error)
+		if err != nil && !ok {
+			return t, nil, err
+		}
+		removed := false
+		if ok {
+			if all == nil {
+				all = &maps.Error{}
+			}
+			all.Errors = append(all.Errors, merr.Errors...)
+			for _, e := range merr.Errors {
+				if m := quotedName.FindStringSubmatch(e); m != nil && removePath(input, m[1]) {
+					removed = true
+				}
+			}
+		}
+		if !removed {
+			if all != nil {
+				return t, md.Unused, all
+			}
+			return t, md.Unused, nil
+		}
 	}
+}
 
-	return u, nil
+// deepCopy returns copy of raw value sharing no maps nor lists with it.
+func deepCopy(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for k, e := range value {
+			result[k] = deepCopy(e)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, e := range value {
+			result[i] = deepCopy(e)
+		}
+		return result
+	}
+	return v
+}
+
+// removePath removes value pointed by path (i.e. params.vm_groups[0].vm_count) from document. It reports if
+// anything was removed.
+func removePath(document map[string]interface{}, path string) bool {
+	var current interface{} = document
+	keys := pathKeys(path)
+	for i, key := range keys {
+		last := i == len(keys)-1
+		switch c := current.(type) {
+		case map[string]interface{}:
+			if _, ok := c[key]; !ok {
+				return false
+			}
+			if last {
+				delete(c, key)
+				return true
+			}
+			current = c[key]
+		case []interface{}:
+			n, err := strconv.Atoi(key)
+			if err != nil || n < 0 || n >= len(c) {
+				return false
+			}
+			if last {
+				// removing item would shift indexes of others, so it is nulled instead
+				c[n] = nil
+				return true
+			}
+			current = c[n]
+		default:
+			return false
+		}
+	}
+	return false
 }
 
 func GetVersion(input map[string]interface{}) (string, error) {
 	meta, ok := input["meta"].(map[string]interface{})
 	if !ok {
+		// structures created before meta object was introduced kept version field on top level
+		if v, ok := input["version"].(string); ok {
+			return v, nil
+		}
 		return "", fmt.Errorf("structure doesn't look like one we can understand - does not have meta object")
 	}
 	v, ok := meta["version"].(string)
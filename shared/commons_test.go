@@ -0,0 +1,162 @@
+package shared
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/epiphany-platform/e-structures/storage"
+	"github.com/epiphany-platform/e-structures/utils/to"
+	maps "github.com/mitchellh/mapstructure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testMeta struct {
+	Kind    *string `json:"kind"`
+	Version *string `json:"version"`
+}
+
+type testStructure struct {
+	Meta   *testMeta `json:"meta"`
+	Name   *string   `json:"name"`
+	Unused []string  `json:"-"`
+}
+
+func (s *testStructure) Validate() error {
+	if s.Name == nil {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func (s *testStructure) SetUnused(unused []string) {
+	s.Unused = unused
+}
+
+func (s *testStructure) Upgrade(path string, options ...DecodeOption) error {
+	return Upgrade(s, path, options...)
+}
+
+func (s *testStructure) UpgradeFrom(st storage.Storage, name string, options ...DecodeOption) error {
+	return UpgradeFrom(s, st, name, options...)
+}
+
+func (s *testStructure) UpgradeFunc(input map[string]interface{}) error {
+	meta := input["meta"].(map[string]interface{})
+	if meta["version"] == "v0.0.1" {
+		meta["version"] = "v0.0.2"
+		input["name"] = "upgraded"
+	}
+	return nil
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		initial *testStructure
+		want    *testStructure
+		wantErr error
+	}{
+		{
+			name:    "happy path",
+			json:    `{"meta": {"kind": "test", "version": "v0.0.2"}, "name": "n", "extra": 1}`,
+			initial: &testStructure{},
+			want: &testStructure{
+				Meta:   &testMeta{Kind: to.StrPtr("test"), Version: to.StrPtr("v0.0.2")},
+				Name:   to.StrPtr("n"),
+				Unused: []string{"extra"},
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "not current version",
+			json:    `{"meta": {"kind": "test", "version": "v0.0.1"}, "name": "n"}`,
+			initial: &testStructure{Name: to.StrPtr("initial")},
+			want:    &testStructure{Name: to.StrPtr("initial")},
+			wantErr: NotCurrentVersionError{Version: "v0.0.1"},
+		},
+		{
+			name:    "validation failure does not modify structure",
+			json:    `{"meta": {"kind": "test", "version": "v0.0.2"}}`,
+			initial: &testStructure{Name: to.StrPtr("initial")},
+			want:    &testStructure{Name: to.StrPtr("initial")},
+			wantErr: errors.New("name is required"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			p := createTempDocumentFile(t, tt.json)
+			err := Load(tt.initial, p, "v0.0.2")
+			if tt.wantErr != nil {
+				a.Equal(tt.wantErr, err)
+			} else {
+				a.NoError(err)
+			}
+			a.Equal(tt.want, tt.initial)
+		})
+	}
+}
+
+func TestDecodeAll(t *testing.T) {
+	a := assert.New(t)
+	input := map[string]interface{}{
+		"meta":  map[string]interface{}{"kind": "test", "version": 2},
+		"name":  "name",
+		"extra": "value",
+	}
+	got, unused, err := decodeAll[testStructure](input)
+	var merr *maps.Error
+	a.True(errors.As(err, &merr))
+	a.Len(merr.Errors, 1)
+	a.Equal("name", *got.Name)
+	a.Equal("test", *got.Meta.Kind)
+	a.Nil(got.Meta.Version)
+	a.Equal([]string{"extra"}, unused)
+	// field which couldn't be decoded is removed from copy of input only
+	a.Equal(map[string]interface{}{"kind": "test", "version": 2}, input["meta"])
+}
+
+func TestUpgrade(t *testing.T) {
+	a := assert.New(t)
+	p := createTempDocumentFile(t, `{"meta": {"kind": "test", "version": "v0.0.1"}}`)
+	got := &testStructure{}
+	err := got.Upgrade(p)
+	a.NoError(err)
+	a.Equal(&testStructure{
+		Meta:   &testMeta{Kind: to.StrPtr("test"), Version: to.StrPtr("v0.0.2")},
+		Name:   to.StrPtr("upgraded"),
+		Unused: []string{},
+	}, got)
+}
+
+func TestBackupRaw(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	document := `{"meta": {"kind": "test", "version": "v0.0.1"},   "name": "n"}`
+	p := createTempDocumentFile(t, document)
+	n := filepath.Join(t.TempDir(), "raw.json")
+
+	checksum, err := BackupRaw(p, n)
+	r.NoError(err)
+	a.Equal("8b437b785aaf301f6b2d9a8c78de531a23c4f79828fadcae3a9cb557faca7c50", checksum)
+	b, err := ioutil.ReadFile(n)
+	r.NoError(err)
+	a.Equal(document, string(b))
+	b, err = ioutil.ReadFile(n + ChecksumFileSuffix)
+	r.NoError(err)
+	a.Equal(checksum+"  raw.json\n", string(b))
+
+	_, err = BackupRaw(p, n)
+	a.Equal(os.ErrExist, err)
+}
+
+func createTempDocumentFile(t *testing.T, document string) string {
+	p := filepath.Join(t.TempDir(), "file.json")
+	require.NoError(t, ioutil.WriteFile(p, []byte(document), 0644))
+	return p
+}
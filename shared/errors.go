@@ -9,3 +9,30 @@ type NotCurrentVersionError struct {
 func (e NotCurrentVersionError) Error() string {
 	return fmt.Sprintf("Structure is of not currect version: %s", e.Version)
 }
+
+type LossyMigrationError struct {
+	Subtree string
+	From    string
+	To      string
+}
+
+func (e LossyMigrationError) Error() string {
+	if e.Subtree != "" {
+		return fmt.Sprintf("Downgrade of %s from %s to %s loses data, it has to be forced", e.Subtree, e.From, e.To)
+	}
+	return fmt.Sprintf("Downgrade from %s to %s loses data, it has to be forced", e.From, e.To)
+}
+
+// ConflictError is returned when file was saved by someone else after structure was loaded from it.
+type ConflictError struct {
+	Path     string
+	Expected int
+	Found    int
+}
+
+func (e ConflictError) Error() string {
+	if e.Expected == e.Found {
+		return fmt.Sprintf("File %s was modified after it was loaded: content hash of serial %d differs", e.Path, e.Found)
+	}
+	return fmt.Sprintf("File %s was modified after it was loaded: expected serial %d, found %d", e.Path, e.Expected, e.Found)
+}
@@ -1,5 +1,7 @@
 package shared
 
+import "github.com/epiphany-platform/e-structures/storage"
+
 type Initializer interface {
 
 	// Init is responsible for building default version of structure to start from.
@@ -9,9 +11,20 @@ type Initializer interface {
 type Backupper interface {
 
 	// Backup is responsible for storing current version of structure in new file. It MUST fail if there is
-	// file already in place pointed by path.
-	Backup(path string) error // TODO this should not argument, but backup location should be unified
-	// TODO add BackupRaw() method
+	// file already in place pointed by path. Location of backups is decided by imh.InfrastructureModuleHelper.
+	// Options (i.e. EncryptWith) change how structure is encoded.
+	Backup(path string, options ...EncodeOption) error
+
+	// BackupRaw is responsible for copying untouched content of file pointed by path into new file together with
+	// its checksum. It is designed to be used before Loader.Load or Upgrader.Upgrade decodes or migrates file, so
+	// original bytes are not lost after upgrade. It MUST fail if there is file already in place pointed by new.
+	BackupRaw(path, new string) error
+
+	// BackupTo works like Backup but stores structure as document with provided name in storage st.
+	BackupTo(st storage.Storage, name string, options ...EncodeOption) error
+
+	// BackupRawTo works like BackupRaw but copies document name into document new within storage st.
+	BackupRawTo(st storage.Storage, name, new string) error
 }
 
 type Loader interface {
@@ -24,21 +37,37 @@ type Loader interface {
 	// In case of incorrect version fallback to Upgrader.Upgrade method should be applied by module.
 	// In case of failed validation (provided by Validator.Validate method) it should be considered
 	// panic situation and usually user is forced to fix file.
-	Load(path string) error
+	//
+	// Options (i.e. Strict or DecryptWith) change how document is decoded.
+	Load(path string, options ...DecodeOption) error
+
+	// LoadFrom works like Load but reads document with provided name from storage st.
+	LoadFrom(st storage.Storage, name string, options ...DecodeOption) error
 }
 
 type Saver interface {
 
 	// Save is responsible for storing structure into file. It must always use Validator.Validate method
 	// to ensure that saved file is not corrupted. It should (but not must) use Printer.Print method
-	// to produce structure JSON.
-	Save(path string) error
+	// to produce structure JSON. Options (i.e. EncryptWith) change how structure is encoded.
+	Save(path string, options ...EncodeOption) error
+
+	// SaveTo works like Save but stores structure as document with provided name in storage st.
+	SaveTo(st storage.Storage, name string, options ...EncodeOption) error
 }
 
 type Printer interface {
 
-	// Print is responsible for producing JSON form of structure.
-	Print() ([]byte, error)
+	// Print is responsible for producing JSON form of structure. Options (i.e. EncryptWith) change how structure is
+	// encoded.
+	Print(options ...EncodeOption) ([]byte, error)
+
+	// PrintYAML works like Print but produces YAML form of structure.
+	PrintYAML(options ...EncodeOption) ([]byte, error)
+
+	// PrintRedacted works like Print but masks secrets (and optionally identifiers) so result can be shared in
+	// logs or support tickets.
+	PrintRedacted(options RedactOptions) ([]byte, error)
 }
 
 type Validator interface {
@@ -47,19 +76,68 @@ type Validator interface {
 	Validate() error
 }
 
+type Linter interface {
+
+	// Lint is responsible for returning advisory findings (of SeverityWarning) about structure which is valid but
+	// probably not what user wants. It must not fail, so Load and Save never depend on it. Findings which codes
+	// are listed in meta.suppress_warnings are not returned.
+	Lint() FieldErrors
+}
+
 type Upgrader interface {
 
 	// Upgrade is responsible for upgrading structure to current version. It is designed to be a fallback
 	// method after Loader.Load wasn't able to load structure from file and returned with NotCurrentVersionError.
-	Upgrade(string) error
+	Upgrade(path string, options ...DecodeOption) error
+
+	// UpgradeFrom works like Upgrade but reads document with provided name from storage st.
+	UpgradeFrom(st storage.Storage, name string, options ...DecodeOption) error
 
 	// UpgradeFunc method is responsible for delivery of structure upgrading function.
 	UpgradeFunc(map[string]interface{}) error
 }
 
+type Downgrader interface {
+
+	// Downgrade is responsible for rewriting file pointed by path into older version of structure. It is designed to
+	// be used before module is rolled back to release which doesn't understand current version of structure. It
+	// should fail if downgrade loses data and force is not set. Untouched content of file is copied into file pointed
+	// by backup (see Backupper.BackupRaw) before it gets rewritten.
+	Downgrade(path, backup, targetVersion string, force bool) error
+
+	// DowngradeFrom works like Downgrade but rewrites document with provided name in storage st and copies its
+	// untouched content into document backup in the same storage.
+	DowngradeFrom(st storage.Storage, name, backup, targetVersion string, force bool) error
+}
+
 type WithUnused interface {
 
 	// SetUnused is responsible for setting list of strings indicating that some found fields are unknown to
 	// structure.
 	SetUnused([]string)
 }
+
+type WithUnknown interface {
+
+	// SetUnknown is responsible for keeping raw values of fields unknown to structure, keyed by paths which
+	// identify list items by names (i.e. params.vm_groups[name=vm-group0].extra). They are written back by Print
+	// (and so by Save and Backup), so documents written by newer tools survive Load and Save done by older ones.
+	SetUnknown(map[string]interface{})
+
+	// GetUnknown returns values set with SetUnknown.
+	GetUnknown() map[string]interface{}
+}
+
+// Structure is a constraint satisfied by pointer to structure which can be loaded with generic Load function.
+type Structure[T any] interface {
+	*T
+	Validator
+	WithUnused
+}
+
+// UpgradableStructure is a constraint satisfied by pointer to structure which can be upgraded with generic
+// Upgrade function.
+type UpgradableStructure[T any] interface {
+	Structure[T]
+	Upgrader
+}
@@ -0,0 +1,44 @@
+package shared
+
+import "fmt"
+
+// WarningUnusedField is code of finding reported for every field of document unknown to structure.
+const WarningUnusedField = "unused-field"
+
+// Warning builds lint finding with provided code about field pointed by JSON path.
+func Warning(code, path string, value interface{}, format string, args ...interface{}) FieldError {
+	return FieldError{
+		Path:     path,
+		Severity: SeverityWarning,
+		Tag:      code,
+		Value:    value,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// Lint returns findings common for all structures (unused fields of structure pointed by v) followed by structure
+// specific ones. Findings with codes listed in suppressed are dropped.
+func Lint(v interface{}, unused []string, suppressed []string, findings ...FieldError) FieldErrors {
+	_, keeps := v.(WithUnknown)
+	all := make(FieldErrors, 0, len(unused)+len(findings))
+	for _, u := range unused {
+		message := "is not known field and is ignored"
+		if _, ok := stablePath(v, u); keeps && !ok {
+			message += ", it is dropped on save as list item holding it has no unique name"
+		}
+		all = append(all, Warning(WarningUnusedField, u, nil, message))
+	}
+	all = append(all, findings...)
+
+	skip := make(map[string]bool, len(suppressed))
+	for _, code := range suppressed {
+		skip[code] = true
+	}
+	result := make(FieldErrors, 0, len(all))
+	for _, f := range all {
+		if !skip[f.Tag] {
+			result = append(result, f)
+		}
+	}
+	return result
+}
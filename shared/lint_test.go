@@ -0,0 +1,37 @@
+package shared
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLint(t *testing.T) {
+	a := assert.New(t)
+	finding := Warning("public-ip", "params.vm_groups[0]", true, "uses %s", "public IP")
+	a.Equal(FieldError{
+		Path:     "params.vm_groups[0]",
+		Severity: SeverityWarning,
+		Tag:      "public-ip",
+		Value:    true,
+		Message:  "uses public IP",
+	}, finding)
+	a.Equal("params.vm_groups[0]: warning: uses public IP (got true)", finding.Error())
+
+	got := Lint(nil, []string{"params.extra"}, nil, finding)
+	a.Equal(FieldErrors{
+		Warning(WarningUnusedField, "params.extra", nil, "is not known field and is ignored"),
+		finding,
+	}, got)
+	a.False(got.HasErrors())
+
+	a.Equal(FieldErrors{finding}, Lint(nil, []string{"params.extra"}, []string{WarningUnusedField}, finding))
+	a.Empty(Lint(nil, nil, []string{"public-ip"}, finding))
+
+	// unknown fields of list items without name are not kept by structures which keep others
+	v := &testUnknown{Params: &testUnknownParams{Disks: []testUnknownDisk{{}}}}
+	a.Equal(FieldErrors{
+		Warning(WarningUnusedField, "params.disks[0].extra", nil,
+			"is not known field and is ignored, it is dropped on save as list item holding it has no unique name"),
+	}, Lint(v, []string{"params.disks[0].extra"}, nil))
+}
@@ -0,0 +1,347 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnknownVersion is returned when there is no registered migration path from version found in structure.
+var ErrUnknownVersion = errors.New("unknown version to upgrade")
+
+// MigrationFunc transforms raw structure from one version into next one. It should not modify meta.version field
+// as it is set by Migrations after function succeeds.
+type MigrationFunc func(input map[string]interface{}) error
+
+// Migration is single registered step upgrading structure From one version To another.
+//
+// Reverse is optional function transforming structure back from To version to From version. Steps without Func
+// (only changing version) are always reversible. Lossy marks steps which reverse function drops information, those
+// are applied only when downgrade is forced. Subtrees maps registered subtree key to version of that subtree used
+// together with From version of this structure and is used to downgrade subtrees.
+type Migration struct {
+	From     string
+	To       string
+	Func     MigrationFunc
+	Reverse  MigrationFunc
+	Lossy    bool
+	Subtrees map[string]string
+}
+
+// MetaMigration returns step moving kind and version, which structures created before meta object was introduced
+// kept at top level, into meta object of provided kind. Module version wasn't recorded back then, so it is set to
+// "unknown" and reverse step (restoring legacyKind) is lossy.
+func MetaMigration(from, to, kind, legacyKind string) Migration {
+	return Migration{
+		From: from,
+		To:   to,
+		Func: func(input map[string]interface{}) error {
+			input["meta"] = map[string]interface{}{
+				"kind":           kind,
+				"module_version": "unknown",
+			}
+			delete(input, "kind")
+			delete(input, "version")
+			return nil
+		},
+		Reverse: func(input map[string]interface{}) error {
+			input["kind"] = legacyKind
+			input["version"] = from
+			delete(input, "meta")
+			return nil
+		},
+		Lossy: true,
+	}
+}
+
+// AppliedMigration describes single migration step applied to structure or to one of its subtrees.
+type AppliedMigration struct {
+	Subtree string
+	From    string
+	To      string
+}
+
+func (a AppliedMigration) String() string {
+	if a.Subtree == "" {
+		return fmt.Sprintf("%s -> %s", a.From, a.To)
+	}
+	return fmt.Sprintf("%s: %s -> %s", a.Subtree, a.From, a.To)
+}
+
+// Migrations is ordered registry of migration steps leading structure to its current version.
+type Migrations struct {
+	current  string
+	steps    []Migration
+	subtrees []subtree
+}
+
+type subtree struct {
+	key        string
+	migrations *Migrations
+}
+
+// NewMigrations creates registry of steps upgrading structure to current version.
+func NewMigrations(current string, steps ...Migration) *Migrations {
+	return &Migrations{
+		current: current,
+		steps:   steps,
+	}
+}
+
+// WithSubtree registers migrations to be used for embedded structure stored under key (i.e. config embedded in
+// state). Key may be dot separated path to structure embedded deeper (i.e. azks.config). Subtree is migrated every
+// time at least one step was applied to parent structure.
+func (m *Migrations) WithSubtree(key string, migrations *Migrations) *Migrations {
+	m.subtrees = append(m.subtrees, subtree{key: key, migrations: migrations})
+	return m
+}
+
+// Current returns version all registered paths lead to.
+func (m *Migrations) Current() string {
+	return m.current
+}
+
+// Validate checks that registry is consistent: there are no duplicated steps, every step leads to current
+// version and there are no cycles.
+func (m *Migrations) Validate() error {
+	seen := make(map[string]bool)
+	for _, s := range m.steps {
+		if s.From == "" || s.To == "" {
+			return fmt.Errorf("migration step has empty version: %q -> %q", s.From, s.To)
+		}
+		if s.From == m.current {
+			return fmt.Errorf("migration step registered from current version %s", s.From)
+		}
+		if seen[s.From] {
+			return fmt.Errorf("more than one migration step registered from version %s", s.From)
+		}
+		seen[s.From] = true
+	}
+	for _, s := range m.steps {
+		if _, err := m.path(s.From); err != nil {
+			return err
+		}
+	}
+	for _, st := range m.subtrees {
+		if err := st.migrations.Validate(); err != nil {
+			return fmt.Errorf("%s: %v", st.key, err)
+		}
+	}
+	return nil
+}
+
+// Path returns ordered list of steps required to upgrade structure from provided version to current one.
+func (m *Migrations) Path(from string) ([]Migration, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m.path(from)
+}
+
+func (m *Migrations) path(from string) ([]Migration, error) {
+	result := make([]Migration, 0)
+	visited := map[string]bool{from: true}
+	v := from
+	for v != m.current {
+		s, ok := m.step(v)
+		if !ok {
+			if v == from {
+				return nil, ErrUnknownVersion
+			}
+			return nil, fmt.Errorf("migration gap: no step registered from version %s (reached from %s)", v, from)
+		}
+		if visited[s.To] {
+			return nil, fmt.Errorf("migration cycle detected: step %s -> %s leads back to already visited version", s.From, s.To)
+		}
+		visited[s.To] = true
+		result = append(result, s)
+		v = s.To
+	}
+	return result, nil
+}
+
+func (m *Migrations) step(from string) (Migration, bool) {
+	for _, s := range m.steps {
+		if s.From == from {
+			return s, true
+		}
+	}
+	return Migration{}, false
+}
+
+// Migrate upgrades raw structure to current version applying registered steps in order. It returns list of
+// applied steps including steps applied to registered subtrees.
+func (m *Migrations) Migrate(input map[string]interface{}) ([]AppliedMigration, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m.migrate(input, "")
+}
+
+func (m *Migrations) migrate(input map[string]interface{}, prefix string) ([]AppliedMigration, error) {
+	v, err := GetVersion(input)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := m.path(v)
+	if err != nil {
+		return nil, err
+	}
+	applied := make([]AppliedMigration, 0)
+	for _, s := range steps {
+		if s.Func != nil {
+			if err := s.Func(input); err != nil {
+				return applied, fmt.Errorf("migration %s -> %s failed: %v", s.From, s.To, err)
+			}
+		}
+		if err := setVersion(input, s.To); err != nil {
+			return applied, err
+		}
+		applied = append(applied, AppliedMigration{Subtree: prefix, From: s.From, To: s.To})
+	}
+	if len(applied) == 0 {
+		return applied, nil
+	}
+	for _, st := range m.subtrees {
+		sub, ok := subtreeAt(input, st.key)
+		if !ok {
+			continue
+		}
+		a, err := st.migrations.migrate(sub, strings.TrimPrefix(prefix+"."+st.key, "."))
+		applied = append(applied, a...)
+		if err != nil {
+			return applied, err
+		}
+	}
+	return applied, nil
+}
+
+// Downgrade rolls raw structure back to target version applying reverse steps in order. It fails if any of
+// required steps (including steps of subtrees) is not reversible or is lossy and force is not set. Steps are applied
+// to copy of input, so input is changed only if the whole downgrade succeeds. It returns list of applied steps
+// including steps applied to registered subtrees (nothing is applied if error is returned).
+func (m *Migrations) Downgrade(input map[string]interface{}, target string, force bool) ([]AppliedMigration, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	result := deepCopy(input).(map[string]interface{})
+	applied, err := m.downgrade(result, target, force, "")
+	if err != nil {
+		return nil, err
+	}
+	for k := range input {
+		delete(input, k)
+	}
+	for k, v := range result {
+		input[k] = v
+	}
+	return applied, nil
+}
+
+func (m *Migrations) downgrade(input map[string]interface{}, target string, force bool, prefix string) ([]AppliedMigration, error) {
+	v, err := GetVersion(input)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := m.reversePath(v, target)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range steps {
+		if s.Func != nil && s.Reverse == nil {
+			return nil, fmt.Errorf("migration %s -> %s cannot be reversed", s.From, s.To)
+		}
+		if s.Lossy && !force {
+			return nil, LossyMigrationError{Subtree: prefix, From: s.To, To: s.From}
+		}
+	}
+	applied := make([]AppliedMigration, 0)
+	for _, s := range steps {
+		if s.Reverse != nil {
+			if err := s.Reverse(input); err != nil {
+				return applied, fmt.Errorf("migration %s -> %s failed: %v", s.To, s.From, err)
+			}
+		}
+		if err := setVersion(input, s.From); err != nil {
+			return applied, err
+		}
+		applied = append(applied, AppliedMigration{Subtree: prefix, From: s.To, To: s.From})
+	}
+	if len(steps) == 0 {
+		return applied, nil
+	}
+	last := steps[len(steps)-1]
+	for _, st := range m.subtrees {
+		subTarget, ok := last.Subtrees[st.key]
+		if !ok {
+			continue
+		}
+		sub, ok := subtreeAt(input, st.key)
+		if !ok {
+			continue
+		}
+		a, err := st.migrations.downgrade(sub, subTarget, force, strings.TrimPrefix(prefix+"."+st.key, "."))
+		applied = append(applied, a...)
+		if err != nil {
+			return applied, err
+		}
+	}
+	return applied, nil
+}
+
+// reversePath returns steps leading from version back to target version in order they should be reversed.
+func (m *Migrations) reversePath(from, target string) ([]Migration, error) {
+	if from == target {
+		return []Migration{}, nil
+	}
+	forward, err := m.path(target)
+	if err != nil {
+		return nil, fmt.Errorf("cannot downgrade to version %s: %v", target, err)
+	}
+	end := -1
+	if from == m.current {
+		end = len(forward)
+	} else {
+		for i, s := range forward {
+			if s.From == from {
+				end = i
+				break
+			}
+		}
+	}
+	if end < 0 {
+		return nil, fmt.Errorf("cannot downgrade from version %s to version %s", from, target)
+	}
+	result := make([]Migration, 0, end)
+	for i := end - 1; i >= 0; i-- {
+		result = append(result, forward[i])
+	}
+	return result, nil
+}
+
+// subtreeAt returns structure found under dot separated key in input.
+func subtreeAt(input map[string]interface{}, key string) (map[string]interface{}, bool) {
+	current := input
+	for _, k := range strings.Split(key, ".") {
+		next, ok := current[k].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current = next
+	}
+	return current, true
+}
+
+func setVersion(input map[string]interface{}, version string) error {
+	meta, ok := input["meta"].(map[string]interface{})
+	if !ok {
+		// structures created before meta object was introduced kept version field on top level
+		if _, ok := input["version"]; ok {
+			input["version"] = version
+			return nil
+		}
+		return fmt.Errorf("structure doesn't look like one we can understand - does not have meta object")
+	}
+	meta["version"] = version
+	return nil
+}
@@ -0,0 +1,384 @@
+package shared
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrations_Migrate(t *testing.T) {
+	config := NewMigrations("v0.0.3",
+		Migration{From: "v0.0.1", To: "v0.0.2", Func: func(input map[string]interface{}) error {
+			input["added"] = "value"
+			return nil
+		}},
+		Migration{From: "v0.0.2", To: "v0.0.3"},
+	)
+	tests := []struct {
+		name        string
+		migrations  *Migrations
+		input       map[string]interface{}
+		want        map[string]interface{}
+		wantApplied []AppliedMigration
+		wantErr     error
+	}{
+		{
+			name:        "nothing to migrate",
+			migrations:  config,
+			input:       map[string]interface{}{"meta": map[string]interface{}{"version": "v0.0.3"}},
+			want:        map[string]interface{}{"meta": map[string]interface{}{"version": "v0.0.3"}},
+			wantApplied: []AppliedMigration{},
+			wantErr:     nil,
+		},
+		{
+			name:       "all steps applied in order",
+			migrations: config,
+			input:      map[string]interface{}{"meta": map[string]interface{}{"version": "v0.0.1"}},
+			want: map[string]interface{}{
+				"meta":  map[string]interface{}{"version": "v0.0.3"},
+				"added": "value",
+			},
+			wantApplied: []AppliedMigration{
+				{From: "v0.0.1", To: "v0.0.2"},
+				{From: "v0.0.2", To: "v0.0.3"},
+			},
+			wantErr: nil,
+		},
+		{
+			name:        "unknown version",
+			migrations:  config,
+			input:       map[string]interface{}{"meta": map[string]interface{}{"version": "v0.0.0"}},
+			want:        map[string]interface{}{"meta": map[string]interface{}{"version": "v0.0.0"}},
+			wantApplied: nil,
+			wantErr:     ErrUnknownVersion,
+		},
+		{
+			name: "subtree migrated with its own chain",
+			migrations: NewMigrations("v1.0.1",
+				Migration{From: "v1.0.0", To: "v1.0.1"},
+			).WithSubtree("config", config),
+			input: map[string]interface{}{
+				"meta": map[string]interface{}{"version": "v1.0.0"},
+				"config": map[string]interface{}{
+					"meta": map[string]interface{}{"version": "v0.0.2"},
+				},
+			},
+			want: map[string]interface{}{
+				"meta": map[string]interface{}{"version": "v1.0.1"},
+				"config": map[string]interface{}{
+					"meta": map[string]interface{}{"version": "v0.0.3"},
+				},
+			},
+			wantApplied: []AppliedMigration{
+				{From: "v1.0.0", To: "v1.0.1"},
+				{Subtree: "config", From: "v0.0.2", To: "v0.0.3"},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "nested subtree migrated with its own chain",
+			migrations: NewMigrations("v1.0.1",
+				Migration{From: "v1.0.0", To: "v1.0.1"},
+			).WithSubtree("module.config", config),
+			input: map[string]interface{}{
+				"version": "v1.0.0",
+				"module": map[string]interface{}{
+					"config": map[string]interface{}{
+						"meta": map[string]interface{}{"version": "v0.0.2"},
+					},
+				},
+			},
+			want: map[string]interface{}{
+				"version": "v1.0.1",
+				"module": map[string]interface{}{
+					"config": map[string]interface{}{
+						"meta": map[string]interface{}{"version": "v0.0.3"},
+					},
+				},
+			},
+			wantApplied: []AppliedMigration{
+				{From: "v1.0.0", To: "v1.0.1"},
+				{Subtree: "module.config", From: "v0.0.2", To: "v0.0.3"},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "missing subtree is skipped",
+			migrations: NewMigrations("v1.0.1",
+				Migration{From: "v1.0.0", To: "v1.0.1"},
+			).WithSubtree("config", config),
+			input: map[string]interface{}{
+				"meta":   map[string]interface{}{"version": "v1.0.0"},
+				"config": nil,
+			},
+			want: map[string]interface{}{
+				"meta":   map[string]interface{}{"version": "v1.0.1"},
+				"config": nil,
+			},
+			wantApplied: []AppliedMigration{
+				{From: "v1.0.0", To: "v1.0.1"},
+			},
+			wantErr: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			got, err := tt.migrations.Migrate(tt.input)
+			if tt.wantErr != nil {
+				a.True(errors.Is(err, tt.wantErr), "got error: %v", err)
+			} else {
+				a.NoError(err)
+			}
+			a.Equal(tt.wantApplied, got)
+			a.Equal(tt.want, tt.input)
+		})
+	}
+}
+
+func TestMigrations_Validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		migrations *Migrations
+		wantErr    bool
+	}{
+		{
+			name: "happy path",
+			migrations: NewMigrations("v0.0.3",
+				Migration{From: "v0.0.2", To: "v0.0.3"},
+				Migration{From: "v0.0.1", To: "v0.0.2"},
+			),
+			wantErr: false,
+		},
+		{
+			name: "gap",
+			migrations: NewMigrations("v0.0.3",
+				Migration{From: "v0.0.1", To: "v0.0.2"},
+			),
+			wantErr: true,
+		},
+		{
+			name: "cycle",
+			migrations: NewMigrations("v0.0.3",
+				Migration{From: "v0.0.1", To: "v0.0.2"},
+				Migration{From: "v0.0.2", To: "v0.0.1"},
+			),
+			wantErr: true,
+		},
+		{
+			name: "duplicated step",
+			migrations: NewMigrations("v0.0.3",
+				Migration{From: "v0.0.2", To: "v0.0.3"},
+				Migration{From: "v0.0.2", To: "v0.0.3"},
+			),
+			wantErr: true,
+		},
+		{
+			name: "step from current version",
+			migrations: NewMigrations("v0.0.3",
+				Migration{From: "v0.0.3", To: "v0.0.4"},
+			),
+			wantErr: true,
+		},
+		{
+			name: "broken subtree",
+			migrations: NewMigrations("v0.0.3").WithSubtree("config", NewMigrations("v0.0.3",
+				Migration{From: "v0.0.1", To: "v0.0.2"},
+			)),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			err := tt.migrations.Validate()
+			if tt.wantErr {
+				a.Error(err)
+			} else {
+				a.NoError(err)
+			}
+		})
+	}
+}
+
+func TestMigrations_Downgrade(t *testing.T) {
+	config := NewMigrations("v0.0.3",
+		Migration{
+			From: "v0.0.1",
+			To:   "v0.0.2",
+			Func: func(input map[string]interface{}) error {
+				input["added"] = "value"
+				return nil
+			},
+			Reverse: func(input map[string]interface{}) error {
+				delete(input, "added")
+				return nil
+			},
+			Lossy: true,
+		},
+		Migration{From: "v0.0.2", To: "v0.0.3"},
+	)
+	tests := []struct {
+		name        string
+		migrations  *Migrations
+		input       map[string]interface{}
+		target      string
+		force       bool
+		want        map[string]interface{}
+		wantApplied []AppliedMigration
+		wantErr     error
+	}{
+		{
+			name:       "lossless downgrade",
+			migrations: config,
+			input: map[string]interface{}{
+				"meta":  map[string]interface{}{"version": "v0.0.3"},
+				"added": "value",
+			},
+			target: "v0.0.2",
+			force:  false,
+			want: map[string]interface{}{
+				"meta":  map[string]interface{}{"version": "v0.0.2"},
+				"added": "value",
+			},
+			wantApplied: []AppliedMigration{
+				{From: "v0.0.3", To: "v0.0.2"},
+			},
+			wantErr: nil,
+		},
+		{
+			name:       "lossy downgrade not forced",
+			migrations: config,
+			input: map[string]interface{}{
+				"meta":  map[string]interface{}{"version": "v0.0.3"},
+				"added": "value",
+			},
+			target: "v0.0.1",
+			force:  false,
+			want: map[string]interface{}{
+				"meta":  map[string]interface{}{"version": "v0.0.3"},
+				"added": "value",
+			},
+			wantApplied: nil,
+			wantErr:     LossyMigrationError{From: "v0.0.2", To: "v0.0.1"},
+		},
+		{
+			name:       "lossy downgrade forced",
+			migrations: config,
+			input: map[string]interface{}{
+				"meta":  map[string]interface{}{"version": "v0.0.3"},
+				"added": "value",
+			},
+			target: "v0.0.1",
+			force:  true,
+			want: map[string]interface{}{
+				"meta": map[string]interface{}{"version": "v0.0.1"},
+			},
+			wantApplied: []AppliedMigration{
+				{From: "v0.0.3", To: "v0.0.2"},
+				{From: "v0.0.2", To: "v0.0.1"},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "subtree downgraded to version matching parent",
+			migrations: NewMigrations("v1.0.1",
+				Migration{From: "v1.0.0", To: "v1.0.1", Subtrees: map[string]string{"config": "v0.0.2"}},
+			).WithSubtree("config", config),
+			input: map[string]interface{}{
+				"meta": map[string]interface{}{"version": "v1.0.1"},
+				"config": map[string]interface{}{
+					"meta": map[string]interface{}{"version": "v0.0.3"},
+				},
+			},
+			target: "v1.0.0",
+			force:  false,
+			want: map[string]interface{}{
+				"meta": map[string]interface{}{"version": "v1.0.0"},
+				"config": map[string]interface{}{
+					"meta": map[string]interface{}{"version": "v0.0.2"},
+				},
+			},
+			wantApplied: []AppliedMigration{
+				{From: "v1.0.1", To: "v1.0.0"},
+				{Subtree: "config", From: "v0.0.3", To: "v0.0.2"},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "lossy subtree step not forced after parent step",
+			migrations: NewMigrations("v1.0.1",
+				Migration{From: "v1.0.0", To: "v1.0.1", Subtrees: map[string]string{"config": "v0.0.1"}},
+			).WithSubtree("config", config),
+			input: map[string]interface{}{
+				"meta": map[string]interface{}{"version": "v1.0.1"},
+				"config": map[string]interface{}{
+					"meta":  map[string]interface{}{"version": "v0.0.3"},
+					"added": "value",
+				},
+			},
+			target: "v1.0.0",
+			force:  false,
+			want: map[string]interface{}{
+				"meta": map[string]interface{}{"version": "v1.0.1"},
+				"config": map[string]interface{}{
+					"meta":  map[string]interface{}{"version": "v0.0.3"},
+					"added": "value",
+				},
+			},
+			wantApplied: nil,
+			wantErr:     LossyMigrationError{Subtree: "config", From: "v0.0.2", To: "v0.0.1"},
+		},
+		{
+			name: "irreversible step",
+			migrations: NewMigrations("v0.0.2",
+				Migration{From: "v0.0.1", To: "v0.0.2", Func: func(input map[string]interface{}) error {
+					return nil
+				}},
+			),
+			input:       map[string]interface{}{"meta": map[string]interface{}{"version": "v0.0.2"}},
+			target:      "v0.0.1",
+			force:       true,
+			want:        map[string]interface{}{"meta": map[string]interface{}{"version": "v0.0.2"}},
+			wantApplied: nil,
+			wantErr:     errors.New("migration v0.0.1 -> v0.0.2 cannot be reversed"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			got, err := tt.migrations.Downgrade(tt.input, tt.target, tt.force)
+			if tt.wantErr != nil {
+				a.Equal(tt.wantErr, err)
+			} else {
+				a.NoError(err)
+			}
+			a.Equal(tt.wantApplied, got)
+			a.Equal(tt.want, tt.input)
+		})
+	}
+}
+
+func TestMetaMigration(t *testing.T) {
+	a := assert.New(t)
+	m := NewMigrations("v0.1.0", MetaMigration("v0.0.1", "v0.1.0", "hiConfig", "hi"))
+	input := map[string]interface{}{"kind": "hi", "version": "v0.0.1", "params": map[string]interface{}{}}
+
+	_, err := m.Migrate(input)
+	a.NoError(err)
+	a.Equal(map[string]interface{}{
+		"meta": map[string]interface{}{
+			"kind":           "hiConfig",
+			"version":        "v0.1.0",
+			"module_version": "unknown",
+		},
+		"params": map[string]interface{}{},
+	}, input)
+
+	_, err = m.Downgrade(input, "v0.0.1", false)
+	a.Equal(LossyMigrationError{From: "v0.1.0", To: "v0.0.1"}, err)
+	_, err = m.Downgrade(input, "v0.0.1", true)
+	a.NoError(err)
+	a.Equal(map[string]interface{}{"kind": "hi", "version": "v0.0.1", "params": map[string]interface{}{}}, input)
+}
@@ -0,0 +1,77 @@
+package shared
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// RedactTag is struct tag marking string fields holding identifiers of user's environment (i.e. tenant ids or
+// public IP addresses), which are masked by PrintRedacted if RedactOptions.Identifiers is set, i.e.
+// `json:"tenant_id" redact:"identifier"`. Fields tagged with SensitiveTag are always masked.
+const RedactTag = "redact"
+
+// RedactedValue replaces masked values.
+const RedactedValue = "REDACTED"
+
+// RedactOptions controls which fields are masked by PrintRedacted.
+type RedactOptions struct {
+	// Identifiers enables masking of fields tagged with `redact:"identifier"`.
+	Identifiers bool
+}
+
+// PrintRedacted works like Print but masks values of sensitive fields (and identifiers if requested) with
+// RedactedValue. Masked document is still valid JSON of the same structure: null values stay null and every
+// element of masked list is masked separately. Fields unknown to structure (see WithUnknown) are written back like
+// Print does, but as nothing is known about them every value they hold is masked.
+func PrintRedacted(v Validator, options RedactOptions) ([]byte, error) {
+	if err := v.Validate(); err != nil {
+		return nil, err
+	}
+	c, err := copyOf(v)
+	if err != nil {
+		return nil, err
+	}
+	err = walkTagged(c, func(f reflect.StructField) bool {
+		return isSensitive(f) || options.Identifiers && f.Tag.Get(RedactTag) == "identifier"
+	}, func(string) (string, error) {
+		return RedactedValue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := json.MarshalIndent(c.Interface(), "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	if u, ok := v.(WithUnknown); ok {
+		unknown := make(map[string]interface{}, len(u.GetUnknown()))
+		for path, value := range u.GetUnknown() {
+			unknown[path] = redacted(value)
+		}
+		return withUnknown(bytes, unknown)
+	}
+	return bytes, nil
+}
+
+// redacted returns copy of raw value with every value other than null masked with RedactedValue. Objects and lists
+// keep their shape.
+func redacted(v interface{}) interface{} {
+	switch value := v.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for k, e := range value {
+			result[k] = redacted(e)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, e := range value {
+			result[i] = redacted(e)
+		}
+		return result
+	default:
+		return RedactedValue
+	}
+}
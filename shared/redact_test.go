@@ -0,0 +1,140 @@
+package shared
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/epiphany-platform/e-structures/utils/to"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testRedacted struct {
+	Token     *string  `json:"token" sensitive:"true"`
+	TenantId  *string  `json:"tenant_id" redact:"identifier"`
+	GroupIds  []string `json:"group_ids" redact:"identifier"`
+	PublicIp  *string  `json:"public_ip" redact:"identifier"`
+	Name      string   `json:"name"`
+	Unused    []string `json:"-"`
+	Validated bool     `json:"-"`
+}
+
+func (s *testRedacted) Validate() error {
+	s.Validated = true
+	return nil
+}
+
+func TestPrintRedacted(t *testing.T) {
+	v := &testRedacted{
+		Token:    to.StrPtr("token"),
+		TenantId: to.StrPtr("tenant"),
+		GroupIds: []string{"group1", "group2"},
+		PublicIp: nil,
+		Name:     "name",
+	}
+	tests := []struct {
+		name    string
+		options RedactOptions
+		want    string
+	}{
+		{
+			name:    "secrets only",
+			options: RedactOptions{},
+			want: `{
+	"token": "REDACTED",
+	"tenant_id": "tenant",
+	"group_ids": [
+		"group1",
+		"group2"
+	],
+	"public_ip": null,
+	"name": "name"
+}`,
+		},
+		{
+			name:    "secrets and identifiers",
+			options: RedactOptions{Identifiers: true},
+			want: `{
+	"token": "REDACTED",
+	"tenant_id": "REDACTED",
+	"group_ids": [
+		"REDACTED",
+		"REDACTED"
+	],
+	"public_ip": null,
+	"name": "name"
+}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			r := require.New(t)
+			got, err := PrintRedacted(v, tt.options)
+			r.NoError(err)
+			a.Equal(tt.want, string(got))
+			a.True(json.Valid(got))
+			a.True(v.Validated)
+			// original is untouched
+			a.Equal("token", *v.Token)
+			a.Equal([]string{"group1", "group2"}, v.GroupIds)
+		})
+	}
+}
+
+type testRedactedUnknown struct {
+	Token   *string                `json:"token" sensitive:"true"`
+	Name    string                 `json:"name"`
+	Unknown map[string]interface{} `json:"-"`
+}
+
+func (s *testRedactedUnknown) Validate() error {
+	return nil
+}
+
+func (s *testRedactedUnknown) SetUnused([]string) {}
+
+func (s *testRedactedUnknown) SetUnknown(unknown map[string]interface{}) {
+	s.Unknown = unknown
+}
+
+func (s *testRedactedUnknown) GetUnknown() map[string]interface{} {
+	return s.Unknown
+}
+
+func TestPrintRedacted_Unknown(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	v := &testRedactedUnknown{
+		Token: to.StrPtr("token"),
+		Name:  "name",
+		Unknown: map[string]interface{}{
+			"password": "secret",
+			"extra": map[string]interface{}{
+				"port":    json.Number("22"),
+				"enabled": true,
+				"hosts":   []interface{}{"10.0.0.1", nil},
+			},
+			"nothing": nil,
+		},
+	}
+	got, err := PrintRedacted(v, RedactOptions{})
+	r.NoError(err)
+	a.Equal(`{
+	"token": "REDACTED",
+	"name": "name",
+	"extra": {
+		"enabled": "REDACTED",
+		"hosts": [
+			"REDACTED",
+			null
+		],
+		"port": "REDACTED"
+	},
+	"nothing": null,
+	"password": "REDACTED"
+}`, string(got))
+	// original is untouched
+	a.Equal("secret", v.Unknown["password"])
+	a.Equal("10.0.0.1", v.Unknown["extra"].(map[string]interface{})["hosts"].([]interface{})[0])
+}
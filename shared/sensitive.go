@@ -0,0 +1,308 @@
+package shared
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/epiphany-platform/e-structures/storage"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+)
+
+// SensitiveTag is struct tag marking string fields which are encrypted in documents written with EncryptWith
+// option, i.e. `json:"kubeconfig" sensitive:"true"`.
+const SensitiveTag = "sensitive"
+
+// encryptedPrefix starts every encrypted value. It is followed by id of key and base64 encoded nonce and
+// AES-256-GCM sealed value, all separated with colons.
+const encryptedPrefix = "enc:v1:"
+
+// KeyProvider delivers AES-256 keys used to encrypt sensitive fields.
+type KeyProvider interface {
+
+	// KeyID returns identifier of key new values are encrypted with. It is stored next to every encrypted value.
+	KeyID() string
+
+	// Key returns 32 bytes long key identified by id.
+	Key(id string) ([]byte, error)
+}
+
+// EncodeOption changes how structures are encoded by Print, Save and Backup functions.
+type EncodeOption func(*encodeOptions)
+
+type encodeOptions struct {
+	keyProvider KeyProvider
+	format      Format
+}
+
+func newEncodeOptions(options []EncodeOption) encodeOptions {
+	var o encodeOptions
+	for _, option := range options {
+		option(&o)
+	}
+	return o
+}
+
+// EncryptWith makes sensitive fields encrypted with current key of p. Sensitive fields are written in plain text
+// if p is nil or option is not provided.
+func EncryptWith(p KeyProvider) EncodeOption {
+	return func(o *encodeOptions) {
+		o.keyProvider = p
+	}
+}
+
+// DecryptWith makes encrypted sensitive fields decrypted with keys of p. Decoding of document with encrypted values
+// fails if p is nil or option is not provided.
+func DecryptWith(p KeyProvider) DecodeOption {
+	return func(o *decodeOptions) {
+		o.keyProvider = p
+	}
+}
+
+// IsEncrypted checks if value was produced by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// Encrypt encrypts value with current key of p.
+func Encrypt(p KeyProvider, value string) (string, error) {
+	id := p.KeyID()
+	aead, err := newAEAD(p, id)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(id))
+	return encryptedPrefix + id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts value produced by Encrypt with key of p it was encrypted with.
+func Decrypt(p KeyProvider, value string) (string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(value, encryptedPrefix), ":", 2)
+	if !IsEncrypted(value) || len(parts) != 2 {
+		return "", errors.New("value is not encrypted")
+	}
+	id := parts[0]
+	sealed, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(p, id)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("encrypted value is too short")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return "", fmt.Errorf("decryption with key %s failed: %v", id, err)
+	}
+	return string(plain), nil
+}
+
+func newAEAD(p KeyProvider, id string) (cipher.AEAD, error) {
+	key, err := p.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptedCopy returns copy of structure pointed by v with sensitive fields encrypted with key provider passed with
+// EncryptWith option. v itself is returned if there is no key provider.
+func EncryptedCopy(v interface{}, options ...EncodeOption) (interface{}, error) {
+	p := newEncodeOptions(options).keyProvider
+	if rv := reflect.ValueOf(v); p == nil || rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return v, nil
+	}
+	c, err := copyOf(v)
+	if err != nil {
+		return nil, err
+	}
+	err = walkTagged(c, isSensitive, func(value string) (string, error) {
+		if IsEncrypted(value) {
+			return value, nil
+		}
+		return Encrypt(p, value)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.Interface(), nil
+}
+
+// DecryptSensitive decrypts in place sensitive fields of structure pointed by v with key provider passed with
+// DecryptWith option. Fields which are not encrypted are left untouched. Other options are ignored.
+func DecryptSensitive(v interface{}, options ...DecodeOption) error {
+	p := newDecodeOptions(options).keyProvider
+	return walkTagged(reflect.ValueOf(v), isSensitive, func(value string) (string, error) {
+		if !IsEncrypted(value) {
+			return value, nil
+		}
+		if p == nil {
+			return "", errors.New("value is encrypted but key provider is not set")
+		}
+		return Decrypt(p, value)
+	})
+}
+
+func isSensitive(f reflect.StructField) bool {
+	return f.Tag.Get(SensitiveTag) == "true"
+}
+
+// copyOf returns pointer to deep copy of structure pointed by v. Fields skipped by encoding/json are not copied.
+func copyOf(v interface{}) (reflect.Value, error) {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	c := reflect.New(reflect.TypeOf(v).Elem())
+	err = json.Unmarshal(bytes, c.Interface())
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return c, nil
+}
+
+// walkTagged replaces value of every string (or list of strings) field matched by match found in v with result
+// of fn.
+func walkTagged(v reflect.Value, match func(reflect.StructField) bool, fn func(string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			return walkTagged(v.Elem(), match, fn)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				// unexported
+				continue
+			}
+			var err error
+			if match(f) {
+				err = replaceStrings(v.Field(i), fn)
+			} else {
+				err = walkTagged(v.Field(i), match, fn)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %v", f.Name, err)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			err := walkTagged(v.Index(i), match, fn)
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			// map values are not addressable, so they are changed on copy
+			e := reflect.New(v.Type().Elem()).Elem()
+			e.Set(v.MapIndex(k))
+			err := walkTagged(e, match, fn)
+			if err != nil {
+				return err
+			}
+			v.SetMapIndex(k, e)
+		}
+	}
+	return nil
+}
+
+// replaceStrings replaces value of string field, pointer to string field or every element of list of strings.
+func replaceStrings(v reflect.Value, fn func(string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return replaceStrings(v.Elem(), fn)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			err := replaceStrings(v.Index(i), fn)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.String:
+		s, err := fn(v.String())
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+		return nil
+	}
+	return fmt.Errorf("only string fields can be tagged as sensitive or redacted")
+}
+
+// KeyFile is KeyProvider holding single AES-256 key read from local file. File contains base64 encoded 32 random
+// bytes, i.e. generated with GenerateKeyFile or `openssl rand -base64 32`.
+type KeyFile struct {
+	id  string
+	key []byte
+}
+
+// NewKeyFile reads key from file pointed by path.
+func NewKeyFile(path string) (*KeyFile, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("key file %s is not base64 encoded: %v", path, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key file %s holds %d bytes long key, expected 32", path, len(key))
+	}
+	sum := sha256.Sum256(key)
+	return &KeyFile{id: hex.EncodeToString(sum[:])[:16], key: key}, nil
+}
+
+// GenerateKeyFile writes new random key into file pointed by path readable only by its owner. It fails with
+// os.ErrExist if there is file already in place.
+func GenerateKeyFile(path string) (*KeyFile, error) {
+	key := make([]byte, 32)
+	_, err := io.ReadFull(rand.Reader, key)
+	if err != nil {
+		return nil, err
+	}
+	err = storage.WriteNewFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyFile(path)
+}
+
+// KeyID returns first 16 hex characters of SHA-256 checksum of key.
+func (k *KeyFile) KeyID() string {
+	return k.id
+}
+
+func (k *KeyFile) Key(id string) ([]byte, error) {
+	if id != k.id {
+		return nil, fmt.Errorf("unknown key %s", id)
+	}
+	return k.key, nil
+}
@@ -0,0 +1,119 @@
+package shared
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/epiphany-platform/e-structures/utils/to"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSecrets struct {
+	Token    *string            `json:"token" sensitive:"true"`
+	Password string             `json:"password" sensitive:"true"`
+	Name     string             `json:"name"`
+	Nested   []testSecrets      `json:"nested"`
+	ByName   map[string]*string `json:"by_name"`
+}
+
+type testSecretsMap struct {
+	Items map[string]testSecrets `json:"items"`
+}
+
+func TestKeyFile(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	p := filepath.Join(t.TempDir(), "key")
+	k, err := GenerateKeyFile(p)
+	r.NoError(err)
+	fi, err := os.Stat(p)
+	r.NoError(err)
+	a.Equal(os.FileMode(0600), fi.Mode().Perm())
+	_, err = GenerateKeyFile(p)
+	a.Equal(os.ErrExist, err)
+
+	loaded, err := NewKeyFile(p)
+	r.NoError(err)
+	a.Equal(k.KeyID(), loaded.KeyID())
+	a.Len(k.KeyID(), 16)
+	_, err = loaded.Key("other")
+	a.Error(err)
+
+	r.NoError(os.WriteFile(p, []byte("c2hvcnQ="), 0600))
+	_, err = NewKeyFile(p)
+	a.EqualError(err, "key file "+p+" holds 5 bytes long key, expected 32")
+}
+
+func TestEncrypt(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	k, err := GenerateKeyFile(filepath.Join(t.TempDir(), "key"))
+	r.NoError(err)
+	other, err := GenerateKeyFile(filepath.Join(t.TempDir(), "key"))
+	r.NoError(err)
+
+	e1, err := Encrypt(k, "secret")
+	r.NoError(err)
+	e2, err := Encrypt(k, "secret")
+	r.NoError(err)
+	a.True(IsEncrypted(e1))
+	a.True(strings.HasPrefix(e1, "enc:v1:"+k.KeyID()+":"))
+	a.NotEqual(e1, e2)
+	d, err := Decrypt(k, e1)
+	r.NoError(err)
+	a.Equal("secret", d)
+
+	_, err = Decrypt(other, e1)
+	a.EqualError(err, "unknown key "+k.KeyID())
+	_, err = Decrypt(k, e1[:len(e1)-4]+"AAA=")
+	a.Error(err)
+	_, err = Decrypt(k, "secret")
+	a.EqualError(err, "value is not encrypted")
+}
+
+func TestEncryptedCopy(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	k, err := GenerateKeyFile(filepath.Join(t.TempDir(), "key"))
+	r.NoError(err)
+	v := &testSecrets{
+		Token:    to.StrPtr("token"),
+		Password: "password",
+		Name:     "name",
+		Nested:   []testSecrets{{Password: "nested"}},
+		ByName:   map[string]*string{"a": to.StrPtr("not sensitive")},
+	}
+
+	// nothing happens without key provider
+	c, err := EncryptedCopy(v)
+	r.NoError(err)
+	a.Same(v, c)
+
+	c, err = EncryptedCopy(v, EncryptWith(k))
+	r.NoError(err)
+	encrypted := c.(*testSecrets)
+	a.True(IsEncrypted(*encrypted.Token))
+	a.True(IsEncrypted(encrypted.Password))
+	a.True(IsEncrypted(encrypted.Nested[0].Password))
+	a.Nil(encrypted.Nested[0].Token)
+	a.Equal("name", encrypted.Name)
+	a.Equal("not sensitive", *encrypted.ByName["a"])
+	// original is untouched
+	a.Equal("token", *v.Token)
+	a.Equal("nested", v.Nested[0].Password)
+
+	r.NoError(DecryptSensitive(encrypted, DecryptWith(k)))
+	a.Equal(v, encrypted)
+
+	m := &testSecretsMap{Items: map[string]testSecrets{"a": {Password: "password"}}}
+	c, err = EncryptedCopy(m, EncryptWith(k))
+	r.NoError(err)
+	a.True(IsEncrypted(c.(*testSecretsMap).Items["a"].Password))
+
+	// decryption without key provider fails
+	a.Error(DecryptSensitive(c))
+	a.Error(DecryptSensitive(c, Strict()))
+}
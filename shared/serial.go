@@ -0,0 +1,220 @@
+package shared
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/epiphany-platform/e-structures/storage"
+	"os"
+)
+
+// Serialized is implemented by structures carrying serial number and content hash of their last saved version.
+// Serial is increased with every save and is used to detect that file was saved by someone else after structure
+// was loaded from it.
+type Serialized interface {
+	GetSerial() (serial int, hash string)
+	SetSerial(serial int, hash string)
+}
+
+// CheckSerial returns ConflictError if serial or hash found in file pointed by path differ from ones held by s, or
+// if content of file doesn't match hash found in it (i.e. file was edited by hand or saved by tool which doesn't
+// maintain hash). Missing file is not a conflict.
+func CheckSerial(s Serialized, path string) error {
+	st, name := storage.Split(path)
+	return withPath(CheckSerialIn(s, st, name), path)
+}
+
+// CheckSerialIn works like CheckSerial but checks document with provided name in storage st.
+func CheckSerialIn(s Serialized, st storage.Storage, name string) error {
+	_, err := CheckSerialVersion(s, st, name)
+	return err
+}
+
+// CheckSerialVersion works like CheckSerialIn but also returns version of checked document if st is
+// storage.Versioned (empty version if document doesn't exist). Passing it to storage.WriteVersion makes sure
+// document is replaced only if nobody saved it after the check.
+func CheckSerialVersion(s Serialized, st storage.Storage, name string) (string, error) {
+	b, version, err := storage.ReadVersion(st, name)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	input, _, err := parse(name, b)
+	if err != nil {
+		return "", err
+	}
+	return version, checkSerial(s, input, name)
+}
+
+// checkSerial compares serial and hash of s with ones found in raw structure and verifies content hash of it.
+func checkSerial(s Serialized, input map[string]interface{}, name string) error {
+	serial, hash := s.GetSerial()
+	foundSerial, foundHash := getSerial(input)
+	if serial != foundSerial || hash != foundHash {
+		return ConflictError{Path: name, Expected: serial, Found: foundSerial}
+	}
+	if foundHash == "" {
+		// file was never saved with hash so its content cannot be verified
+		return nil
+	}
+	h, err := contentHash(input)
+	if err != nil {
+		return err
+	}
+	if h != foundHash {
+		return ConflictError{Path: name, Expected: serial, Found: foundSerial}
+	}
+	return nil
+}
+
+// SaveSerialized checks that file pointed by path wasn't saved by someone else, increases serial of s, computes
+// hash of content produced by marshal (see contentHash) and writes the result. Serial and hash of s are left
+// untouched if any of those steps fails.
+func SaveSerialized(s Serialized, path string, marshal func() ([]byte, error), options ...EncodeOption) error {
+	st, name := storage.Split(path)
+	return withPath(SaveSerializedTo(s, st, name, marshal, options...), path)
+}
+
+// SaveSerializedTo works like SaveSerialized but stores document with provided name in storage st.
+func SaveSerializedTo(s Serialized, st storage.Storage, name string, marshal func() ([]byte, error), options ...EncodeOption) error {
+	version, err := CheckSerialVersion(s, st, name)
+	if err != nil {
+		return err
+	}
+	serial, hash := s.GetSerial()
+	s.SetSerial(serial+1, "")
+	var newHash string
+	bytes, err := marshal()
+	if err == nil {
+		// hash is added to produced document instead of marshalling it again, as encrypted values would differ
+		bytes, newHash, err = withHash(bytes)
+	}
+	if err == nil {
+		bytes, err = toFormat(name, bytes, options)
+	}
+	if err == nil {
+		err = storage.WriteVersion(st, name, bytes, version)
+		if errors.Is(err, storage.ErrConflict) {
+			// saved by someone else after the check
+			err = ConflictIn(st, name, serial)
+		}
+	}
+	if err != nil {
+		s.SetSerial(serial, hash)
+		return err
+	}
+	s.SetSerial(serial+1, newHash)
+	return nil
+}
+
+// contentHash returns hex encoded SHA-256 checksum of raw structure with hash field left out. Structure is
+// marshalled with sorted keys, so checksum doesn't depend on format of document (JSON or YAML) nor order of
+// fields in it.
+func contentHash(input map[string]interface{}) (string, error) {
+	holder, ok := input["meta"].(map[string]interface{})
+	if !ok {
+		// structures created before meta object was introduced kept those fields on top level
+		holder = input
+	}
+	if hash, ok := holder["hash"]; ok {
+		delete(holder, "hash")
+		defer func() { holder["hash"] = hash }()
+	}
+	bytes, err := json.Marshal(input)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(bytes)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// refreshHash replaces hash stored in raw structure with contentHash of its current content, so structure changed
+// by tool (i.e. downgraded) isn't reported as edited by hand on next save. Structures without hash are left as they
+// are.
+func refreshHash(input map[string]interface{}) error {
+	if _, hash := getSerial(input); hash == "" {
+		return nil
+	}
+	hash, err := contentHash(input)
+	if err != nil {
+		return err
+	}
+	holder, ok := input["meta"].(map[string]interface{})
+	if !ok {
+		holder = input
+	}
+	holder["hash"] = hash
+	return nil
+}
+
+// withHash computes contentHash of JSON document and puts it into document right after serial field. It returns
+// changed document and hash.
+func withHash(document []byte) ([]byte, string, error) {
+	var input map[string]interface{}
+	err := json.Unmarshal(document, &input)
+	if err != nil {
+		return nil, "", err
+	}
+	hash, err := contentHash(input)
+	if err != nil {
+		return nil, "", err
+	}
+	d := json.NewDecoder(bytes.NewReader(document))
+	d.UseNumber()
+	root, err := decodeOrdered(d)
+	if err != nil {
+		return nil, "", err
+	}
+	holder, ok := root.(*object)
+	if !ok {
+		return nil, "", errors.New("document is not an object")
+	}
+	if meta, ok := holder.values["meta"].(*object); ok {
+		holder = meta
+	}
+	holder.insertAfter("serial", "hash", hash)
+	result, err := json.MarshalIndent(root, "", "\t")
+	if err != nil {
+		return nil, "", err
+	}
+	return result, hash, nil
+}
+
+// getSerial returns serial and hash stored in raw structure. Zero values are returned if they are not present.
+func getSerial(input map[string]interface{}) (int, string) {
+	meta, ok := input["meta"].(map[string]interface{})
+	if !ok {
+		// structures created before meta object was introduced kept those fields on top level
+		meta = input
+	}
+	serial := 0
+	if v, ok := meta["serial"].(float64); ok {
+		serial = int(v)
+	}
+	hash, _ := meta["hash"].(string)
+	return serial, hash
+}
+
+// ConflictIn builds ConflictError for document with provided name which was replaced in storage st by someone else
+// while structure of expected serial was being saved. It is meant to be returned when storage.WriteVersion fails
+// with storage.ErrConflict.
+func ConflictIn(st storage.Storage, name string, expected int) error {
+	found := expected
+	input, _, err := read(st, name)
+	if err == nil {
+		found, _ = getSerial(input)
+	}
+	return ConflictError{Path: name, Expected: expected, Found: found}
+}
+
+// withPath replaces document name in ConflictError with full path of file.
+func withPath(err error, path string) error {
+	if cerr, ok := err.(ConflictError); ok {
+		cerr.Path = path
+		return cerr
+	}
+	return err
+}
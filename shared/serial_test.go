@@ -0,0 +1,130 @@
+package shared
+
+import (
+	"testing"
+
+	"github.com/epiphany-platform/e-structures/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSerialized struct {
+	serial int
+	hash   string
+}
+
+func (s *testSerialized) GetSerial() (int, string) {
+	return s.serial, s.hash
+}
+
+func (s *testSerialized) SetSerial(serial int, hash string) {
+	s.serial, s.hash = serial, hash
+}
+
+func TestCheckSerial(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		s       *testSerialized
+		wantErr error
+	}{
+		{
+			name:    "same serial and hash",
+			json:    `{"meta": {"version": "v0.0.1", "serial": 3, "hash": "1189dcbf863333d76d7e0c448e05a9b76335e80adc2341a2bc32f4626141985b"}}`,
+			s:       &testSerialized{serial: 3, hash: "1189dcbf863333d76d7e0c448e05a9b76335e80adc2341a2bc32f4626141985b"},
+			wantErr: nil,
+		},
+		{
+			name:    "same serial and hash in YAML",
+			json:    "meta:\n  serial: 3\n  version: v0.0.1\n  hash: 1189dcbf863333d76d7e0c448e05a9b76335e80adc2341a2bc32f4626141985b\n",
+			s:       &testSerialized{serial: 3, hash: "1189dcbf863333d76d7e0c448e05a9b76335e80adc2341a2bc32f4626141985b"},
+			wantErr: nil,
+		},
+		{
+			name:    "content edited without changing serial and hash",
+			json:    `{"meta": {"version": "v0.0.1", "serial": 3, "hash": "1189dcbf863333d76d7e0c448e05a9b76335e80adc2341a2bc32f4626141985b"}, "status": "applied"}`,
+			s:       &testSerialized{serial: 3, hash: "1189dcbf863333d76d7e0c448e05a9b76335e80adc2341a2bc32f4626141985b"},
+			wantErr: ConflictError{Expected: 3, Found: 3},
+		},
+		{
+			name:    "file never saved with serial",
+			json:    `{"meta": {"version": "v0.0.1"}}`,
+			s:       &testSerialized{},
+			wantErr: nil,
+		},
+		{
+			name:    "serial on top level of old structure",
+			json:    `{"version": "v0.0.1", "serial": 3}`,
+			s:       &testSerialized{serial: 2},
+			wantErr: ConflictError{Expected: 2, Found: 3},
+		},
+		{
+			name:    "same serial different hash",
+			json:    `{"meta": {"version": "v0.0.1", "serial": 3, "hash": "def"}}`,
+			s:       &testSerialized{serial: 3, hash: "abc"},
+			wantErr: ConflictError{Expected: 3, Found: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := createTempDocumentFile(t, tt.json)
+			err := CheckSerial(tt.s, p)
+			if tt.wantErr != nil {
+				want := tt.wantErr.(ConflictError)
+				want.Path = p
+				assert.Equal(t, want, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSaveSerializedTo_Downgraded(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	st := storage.NewMemory()
+	s := &testSerialized{}
+	err := SaveSerializedTo(s, st, "state.json", func() ([]byte, error) {
+		return []byte(`{"meta": {"version": "v0.0.2", "serial": 1}, "added": "value"}`), nil
+	})
+	r.NoError(err)
+	m := NewMigrations("v0.0.2", Migration{
+		From: "v0.0.1",
+		To:   "v0.0.2",
+		Func: func(input map[string]interface{}) error {
+			input["added"] = "value"
+			return nil
+		},
+		Reverse: func(input map[string]interface{}) error {
+			delete(input, "added")
+			return nil
+		},
+	})
+	_, err = DowngradeFrom(m, st, "state.json", "state.json.backup", "v0.0.1", false)
+	r.NoError(err)
+
+	input, _, err := read(st, "state.json")
+	r.NoError(err)
+	serial, hash := getSerial(input)
+	a.Equal(1, serial)
+	a.NotEqual(s.hash, hash)
+	a.NoError(CheckSerialIn(&testSerialized{serial: serial, hash: hash}, st, "state.json"))
+}
+
+func TestSaveSerializedTo_ConcurrentSave(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	st := storage.NewMemory()
+	s := &testSerialized{}
+	err := SaveSerializedTo(s, st, "state.json", func() ([]byte, error) {
+		// someone else saves state after it was checked but before it is written
+		r.NoError(st.Write("state.json", []byte(`{"meta": {"serial": 1}, "by": "other"}`)))
+		return []byte(`{"meta": {"serial": 1}, "by": "this"}`), nil
+	})
+	a.Equal(ConflictError{Path: "state.json", Expected: 0, Found: 1}, err)
+	a.Equal(&testSerialized{}, s)
+	b, err := st.Read("state.json")
+	r.NoError(err)
+	a.Equal(`{"meta": {"serial": 1}, "by": "other"}`, string(b))
+}
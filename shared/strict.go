@@ -0,0 +1,159 @@
+package shared
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// DecodeOption changes how documents are decoded by Load and Upgrade functions.
+type DecodeOption func(*decodeOptions)
+
+type decodeOptions struct {
+	strict      bool
+	keyProvider KeyProvider
+}
+
+func newDecodeOptions(options []DecodeOption) decodeOptions {
+	var o decodeOptions
+	for _, option := range options {
+		option(&o)
+	}
+	return o
+}
+
+// Strict makes decoding fail on fields unknown to structure instead of only collecting them with
+// WithUnused.SetUnused. Every unknown field is reported with the most similar known field name, so typos like
+// vm_cuont are easy to spot.
+func Strict() DecodeOption {
+	return func(o *decodeOptions) {
+		o.strict = true
+	}
+}
+
+// CheckUnknown is meant for structures which are not decoded by Load (i.e. state/v0.State). It returns validateErr
+// (result of validation of structure v) unchanged unless Strict is one of options. Then unused fields are reported
+// the same way Load reports them, together with problems found by validation.
+func CheckUnknown(v interface{}, unused []string, validateErr error, options ...DecodeOption) error {
+	o := newDecodeOptions(options)
+	if !o.strict || len(unused) == 0 {
+		return validateErr
+	}
+	return withProblems(unknownFields(reflect.TypeOf(v), unused), validateErr)
+}
+
+// unknownFields reports unused fields (paths collected by mapstructure) of structure of type t as problems.
+func unknownFields(t reflect.Type, unused []string) FieldErrors {
+	result := make(FieldErrors, 0, len(unused))
+	for _, u := range unused {
+		parent, name := "", u
+		if i := strings.LastIndex(u, "."); i >= 0 {
+			parent, name = u[:i], u[i+1:]
+		}
+		message := "is not known field"
+		if s := closest(name, knownFields(t, parent)); s != "" {
+			message = fmt.Sprintf("is not known field, did you mean %s?", s)
+		}
+		result = append(result, FieldError{
+			Path:     u,
+			Severity: SeverityError,
+			Tag:      "unknown",
+			Message:  message,
+		})
+	}
+	return result
+}
+
+// knownFields returns JSON names of fields of structure found under path in structure of type root.
+func knownFields(root reflect.Type, path string) []string {
+	t := indirect(root)
+	keys := strings.FieldsFunc(path, func(r rune) bool { return r == '.' || r == '[' || r == ']' })
+	for _, key := range keys {
+		switch t.Kind() {
+		case reflect.Struct:
+			f, ok := fieldByJSONName(t, key)
+			if !ok {
+				return nil
+			}
+			t = indirect(f.Type)
+		case reflect.Slice, reflect.Array, reflect.Map:
+			t = indirect(t.Elem())
+		default:
+			return nil
+		}
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	result := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath == "" && f.Tag.Get("json") != "-" {
+			result = append(result, jsonName(f))
+		}
+	}
+	return result
+}
+
+func fieldByJSONName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath == "" && f.Tag.Get("json") != "-" && jsonName(f) == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// closest returns candidate most similar to name or empty string if none of them is similar enough to be a typo.
+func closest(name string, candidates []string) string {
+	best, bestDistance := "", 0
+	for _, c := range candidates {
+		d := distance(strings.ToLower(name), strings.ToLower(c))
+		if best == "" || d < bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+	limit := len(name) / 3
+	if limit < 2 {
+		limit = 2
+	}
+	if best == "" || bestDistance > limit {
+		return ""
+	}
+	return best
+}
+
+// distance returns number of insertions, deletions, substitutions and transpositions of adjacent characters
+// needed to change a into b (optimal string alignment distance).
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, minInt(d[i][j-1]+1, d[i-1][j-1]+cost))
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,49 @@
+package shared
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClosest(t *testing.T) {
+	candidates := []string{"name", "vm_count", "vm_size", "use_public_ip", "subnet_names"}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "vm_cuont", want: "vm_count"},
+		{name: "VM_COUNT", want: "vm_count"},
+		{name: "vmsize", want: "vm_size"},
+		{name: "use_public_ips", want: "use_public_ip"},
+		{name: "nmae", want: "name"},
+		{name: "colour", want: ""},
+		{name: "x", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, closest(tt.name, candidates))
+		})
+	}
+}
+
+func TestKnownFields(t *testing.T) {
+	a := assert.New(t)
+	type group struct {
+		Name   *string  `json:"name"`
+		Count  *int     `json:"vm_count"`
+		Unused []string `json:"-"`
+	}
+	type params struct {
+		Groups []group `json:"vm_groups"`
+	}
+	type config struct {
+		Params *params `json:"params"`
+	}
+	root := reflect.TypeOf(config{})
+	a.Equal([]string{"params"}, knownFields(root, ""))
+	a.Equal([]string{"vm_groups"}, knownFields(root, "params"))
+	a.Equal([]string{"name", "vm_count"}, knownFields(root, "params.vm_groups[1]"))
+	a.Nil(knownFields(root, "params.other"))
+}
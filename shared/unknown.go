@@ -0,0 +1,380 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Values of unknown fields are keyed by paths which identify list items by their names instead of positions (i.e.
+// params.vm_groups[name=vm-group0].extra), so they are written back into the same items even if items were added,
+// removed or reordered in the meantime. '.', '[', ']', '=' and '\' in field names and item names are escaped with
+// '\'. Fields held by list items without unique name can't be identified that way, so they are not kept (Lint
+// warns about them).
+
+// unknownValues returns raw values of fields pointed by unused paths (as reported by mapstructure, i.e.
+// params.vm_groups[0].extra) found in document, keyed by stablePath of them in structure pointed by v.
+func unknownValues(v interface{}, document map[string]interface{}, unused []string) map[string]interface{} {
+	if len(unused) == 0 {
+		return nil
+	}
+	result := make(map[string]interface{}, len(unused))
+	for _, path := range unused {
+		key, ok := stablePath(v, path)
+		if !ok {
+			continue
+		}
+		if value, ok := valueAt(document, path); ok {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// valueAt returns value pointed by path reported by mapstructure. Field names in such paths are not escaped, so
+// the longest field name matching path is taken.
+func valueAt(document map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = document
+	rest := path
+	for rest != "" {
+		switch c := current.(type) {
+		case map[string]interface{}:
+			key := ""
+			for k := range c {
+				if len(k) > len(key) && (rest == k || strings.HasPrefix(rest, k+".") || strings.HasPrefix(rest, k+"[")) {
+					key = k
+				}
+			}
+			if key == "" {
+				return nil, false
+			}
+			current = c[key]
+			rest = strings.TrimPrefix(rest[len(key):], ".")
+		case []interface{}:
+			n, next, ok := index(rest)
+			if !ok || n >= len(c) {
+				return nil, false
+			}
+			current = c[n]
+			rest = next
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// stablePath translates path reported by mapstructure into path identifying list items by names (see
+// unknownValues) using decoded structure pointed by v. It reports false if any list item on the way has no
+// unique name.
+func stablePath(v interface{}, path string) (string, bool) {
+	var b strings.Builder
+	current := reflect.ValueOf(v)
+	rest := path
+	for rest != "" {
+		for current.Kind() == reflect.Ptr && !current.IsNil() {
+			current = current.Elem()
+		}
+		switch current.Kind() {
+		case reflect.Struct:
+			name := rest
+			if i := strings.IndexAny(rest, ".["); i >= 0 {
+				name = rest[:i]
+			}
+			f, ok := fieldByJSONName(current.Type(), name)
+			if !ok {
+				// field unknown to structure, the rest of path is its name
+				writeKey(&b, rest)
+				return b.String(), true
+			}
+			writeKey(&b, name)
+			current = current.FieldByIndex(f.Index)
+			rest = strings.TrimPrefix(rest[len(name):], ".")
+		case reflect.Slice, reflect.Array:
+			n, next, ok := index(rest)
+			if !ok || n >= current.Len() {
+				return "", false
+			}
+			key, name, ok := itemName(current, n)
+			if !ok {
+				return "", false
+			}
+			b.WriteString("[" + escapeKey(key) + "=" + escapeKey(name) + "]")
+			current = current.Index(n)
+			rest = next
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+
+// index parses list index at the beginning of path (i.e. [0].extra) and returns it with the rest of path.
+func index(path string) (int, string, bool) {
+	j := strings.Index(path, "]")
+	if !strings.HasPrefix(path, "[") || j < 0 {
+		return 0, "", false
+	}
+	n, err := strconv.Atoi(path[1:j])
+	if err != nil || n < 0 {
+		return 0, "", false
+	}
+	return n, strings.TrimPrefix(path[j+1:], "."), true
+}
+
+// itemName returns JSON name and value of Name field of n-th item of list. It reports false if item has no such
+// field, it is empty or other item has the same name.
+func itemName(list reflect.Value, n int) (string, string, bool) {
+	name := func(item reflect.Value) (reflect.StructField, string) {
+		for item.Kind() == reflect.Ptr && !item.IsNil() {
+			item = item.Elem()
+		}
+		if item.Kind() != reflect.Struct {
+			return reflect.StructField{}, ""
+		}
+		f, ok := item.Type().FieldByName("Name")
+		if !ok {
+			return f, ""
+		}
+		v := item.FieldByIndex(f.Index)
+		if v.Kind() == reflect.Ptr && !v.IsNil() {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.String {
+			return f, ""
+		}
+		return f, v.String()
+	}
+	f, result := name(list.Index(n))
+	if result == "" {
+		return "", "", false
+	}
+	for i := 0; i < list.Len(); i++ {
+		if _, other := name(list.Index(i)); i != n && other == result {
+			return "", "", false
+		}
+	}
+	return jsonName(f), result, true
+}
+
+var keyEscaper = strings.NewReplacer(`\`, `\\`, `.`, `\.`, `[`, `\[`, `]`, `\]`, `=`, `\=`)
+
+func escapeKey(key string) string {
+	return keyEscaper.Replace(key)
+}
+
+func writeKey(b *strings.Builder, key string) {
+	if b.Len() > 0 {
+		b.WriteString(".")
+	}
+	b.WriteString(escapeKey(key))
+}
+
+// pathSegment is field name or list item selector of path built by stablePath.
+type pathSegment struct {
+	key   string
+	value string
+	item  bool
+}
+
+// parsePath splits path built by stablePath into segments.
+func parsePath(path string) []pathSegment {
+	var result []pathSegment
+	var current strings.Builder
+	segment := pathSegment{}
+	inItem := false
+	flush := func() {
+		if inItem {
+			segment.value = current.String()
+		} else {
+			segment.key = current.String()
+		}
+		if segment.key != "" {
+			result = append(result, segment)
+		}
+		segment = pathSegment{}
+		current.Reset()
+	}
+	runes := []rune(path)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes):
+			i++
+			current.WriteRune(runes[i])
+		case r == '.' && !inItem:
+			flush()
+		case r == '[' && !inItem:
+			flush()
+			inItem = true
+			segment.item = true
+		case r == '=' && inItem && segment.key == "":
+			segment.key = current.String()
+			current.Reset()
+		case r == ']' && inItem:
+			flush()
+			inItem = false
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return result
+}
+
+func pathKeys(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool { return r == '.' || r == '[' || r == ']' })
+}
+
+// withUnknown adds unknown values (see WithUnknown) into JSON document keeping order of its fields. Values are
+// appended to objects they were found in. Values which parent object is no longer part of document are dropped.
+func withUnknown(document []byte, unknown map[string]interface{}) ([]byte, error) {
+	if len(unknown) == 0 {
+		return document, nil
+	}
+	d := json.NewDecoder(bytes.NewReader(document))
+	d.UseNumber()
+	root, err := decodeOrdered(d)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(unknown))
+	for path := range unknown {
+		paths = append(paths, path)
+	}
+	// the same order of fields every time
+	sort.Slice(paths, func(i, j int) bool { return comparePaths(paths[i], paths[j]) < 0 })
+	for _, path := range paths {
+		insert(root, path, unknown[path])
+	}
+	return json.MarshalIndent(root, "", "\t")
+}
+
+// insert sets value under path built by stablePath in tree built by decodeOrdered unless field is already there.
+func insert(root interface{}, path string, value interface{}) {
+	segments := parsePath(path)
+	if len(segments) == 0 || segments[len(segments)-1].item {
+		return
+	}
+	current := root
+	for _, segment := range segments[:len(segments)-1] {
+		switch c := current.(type) {
+		case *object:
+			if segment.item {
+				return
+			}
+			current = c.values[segment.key]
+		case []interface{}:
+			if !segment.item {
+				return
+			}
+			current = nil
+			for _, item := range c {
+				if o, ok := item.(*object); ok && o.values[segment.key] == segment.value {
+					current = o
+					break
+				}
+			}
+		default:
+			return
+		}
+	}
+	o, ok := current.(*object)
+	if !ok {
+		return
+	}
+	key := segments[len(segments)-1].key
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+		o.values[key] = value
+	}
+}
+
+// object is JSON object which keeps order of its fields.
+type object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// insertAfter sets value of key placing it right after field previous (or at the end if there is no such field).
+// Position of already existing key is kept.
+func (o *object) insertAfter(previous string, key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		i := len(o.keys)
+		for j, k := range o.keys {
+			if k == previous {
+				i = j + 1
+				break
+			}
+		}
+		o.keys = append(o.keys[:i], append([]string{key}, o.keys[i:]...)...)
+	}
+	o.values[key] = value
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("{")
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteString(":")
+		b.Write(v)
+	}
+	b.WriteString("}")
+	return b.Bytes(), nil
+}
+
+// decodeOrdered decodes next JSON value from d using object for JSON objects.
+func decodeOrdered(d *json.Decoder) (interface{}, error) {
+	t, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case json.Delim('{'):
+		o := &object{values: make(map[string]interface{})}
+		for d.More() {
+			k, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			key := k.(string)
+			v, err := decodeOrdered(d)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := o.values[key]; !ok {
+				o.keys = append(o.keys, key)
+			}
+			o.values[key] = v
+		}
+		_, err = d.Token()
+		return o, err
+	case json.Delim('['):
+		a := make([]interface{}, 0)
+		for d.More() {
+			v, err := decodeOrdered(d)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		_, err = d.Token()
+		return a, err
+	}
+	return t, nil
+}
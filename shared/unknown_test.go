@@ -0,0 +1,198 @@
+package shared
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testUnknown struct {
+	Params  *testUnknownParams     `json:"params"`
+	Unknown map[string]interface{} `json:"-"`
+}
+
+func (s *testUnknown) SetUnknown(unknown map[string]interface{}) {
+	s.Unknown = unknown
+}
+
+func (s *testUnknown) GetUnknown() map[string]interface{} {
+	return s.Unknown
+}
+
+type testUnknownParams struct {
+	VmGroups []testUnknownVmGroup `json:"vm_groups"`
+	Disks    []testUnknownDisk    `json:"disks"`
+}
+
+type testUnknownVmGroup struct {
+	Name *string `json:"vm_group_name"`
+}
+
+type testUnknownDisk struct {
+	Size *int `json:"size"`
+}
+
+func TestUnknownValues(t *testing.T) {
+	a := assert.New(t)
+	document := map[string]interface{}{
+		"extra":   "outer",
+		"dots.in": "key",
+		"params": map[string]interface{}{
+			"vm_groups": []interface{}{
+				map[string]interface{}{
+					"vm_group_name": "vm-group0",
+					"extra":         map[string]interface{}{"zone": 1},
+				},
+			},
+			"disks": []interface{}{
+				map[string]interface{}{"extra": 1},
+			},
+		},
+	}
+	name := "vm-group0"
+	v := &testUnknown{Params: &testUnknownParams{
+		VmGroups: []testUnknownVmGroup{{Name: &name}},
+		Disks:    []testUnknownDisk{{}},
+	}}
+	got := unknownValues(v, document, []string{
+		"extra",
+		"dots.in",
+		"params.vm_groups[0].extra",
+		"params.vm_groups[1].extra",
+		"params.disks[0].extra",
+	})
+	a.Equal(map[string]interface{}{
+		"extra":    "outer",
+		`dots\.in`: "key",
+		"params.vm_groups[vm_group_name=vm-group0].extra": map[string]interface{}{"zone": 1},
+	}, got)
+	a.Nil(unknownValues(v, document, nil))
+}
+
+func TestStablePath(t *testing.T) {
+	first, second := "vm-group0", "vm.group[1]"
+	v := &testUnknown{Params: &testUnknownParams{
+		VmGroups: []testUnknownVmGroup{{Name: &first}, {Name: &second}, {Name: &first}, {}},
+	}}
+	tests := []struct {
+		path   string
+		want   string
+		wantOk bool
+	}{
+		{path: "extra", want: "extra", wantOk: true},
+		{path: "params.extra", want: "params.extra", wantOk: true},
+		{path: "params.a.b[0]=c", want: `params.a\.b\[0\]\=c`, wantOk: true},
+		{path: "params.vm_groups[1].extra", want: `params.vm_groups[vm_group_name=vm\.group\[1\]].extra`, wantOk: true},
+		{path: "params.vm_groups[0].extra", wantOk: false},
+		{path: "params.vm_groups[3].extra", wantOk: false},
+		{path: "params.vm_groups[4].extra", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, ok := stablePath(v, tt.path)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	a := assert.New(t)
+	a.Equal([]pathSegment{
+		{key: "params"},
+		{key: "vm_groups"},
+		{key: "vm_group_name", value: "vm.group[1]", item: true},
+		{key: "a.b[0]=c"},
+	}, parsePath(`params.vm_groups[vm_group_name=vm\.group\[1\]].a\.b\[0\]\=c`))
+}
+
+func TestWithUnknown(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		unknown  map[string]interface{}
+		want     string
+	}{
+		{
+			name:     "nothing unknown",
+			document: `{"b": 1, "a": 2}`,
+			want:     `{"b": 1, "a": 2}`,
+		},
+		{
+			name:     "appended to objects in document order",
+			document: `{"meta": {"kind": "k"}, "params": {"groups": [{"name": "g0"}, {"name": "g1"}]}}`,
+			unknown: map[string]interface{}{
+				"params.groups[name=g1].zone": "2",
+				"params.groups[name=g0].zone": "1",
+				"extra":                       []interface{}{"x"},
+				"meta.colour":                 "blue",
+			},
+			want: `{
+	"meta": {
+		"kind": "k",
+		"colour": "blue"
+	},
+	"params": {
+		"groups": [
+			{
+				"name": "g0",
+				"zone": "1"
+			},
+			{
+				"name": "g1",
+				"zone": "2"
+			}
+		]
+	},
+	"extra": [
+		"x"
+	]
+}`,
+		},
+		{
+			name:     "list items found by name after they were reordered or removed",
+			document: `{"groups": [{"name": "g2"}, {"name": "g1"}]}`,
+			unknown: map[string]interface{}{
+				"groups[name=g0].zone": "0",
+				"groups[name=g1].zone": "1",
+				`a\.b`:                 "escaped",
+			},
+			want: `{
+	"groups": [
+		{
+			"name": "g2"
+		},
+		{
+			"name": "g1",
+			"zone": "1"
+		}
+	],
+	"a.b": "escaped"
+}`,
+		},
+		{
+			name:     "known fields and missing parents are left untouched",
+			document: `{"meta": {"kind": "k"}, "params": null, "big": 12345678901234567890}`,
+			unknown: map[string]interface{}{
+				"meta.kind":    "other",
+				"params.extra": 1,
+				"output.extra": 2,
+			},
+			want: `{
+	"meta": {
+		"kind": "k"
+	},
+	"params": null,
+	"big": 12345678901234567890
+}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := withUnknown([]byte(tt.document), tt.unknown)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
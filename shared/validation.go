@@ -0,0 +1,406 @@
+package shared
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	maps "github.com/mitchellh/mapstructure"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Severity tells if problem makes structure unusable or is only worth attention.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// FieldError is single validation failure described in terms of document rather than Go structures.
+type FieldError struct {
+	// Document is name of document problem was found in. It is set only when more documents are checked at once
+	// (see imh.InfrastructureModuleHelper.Check).
+	Document string
+	// Path is JSON path of failing field, i.e. params.vm_groups[0].subnet_names[0].
+	Path string
+	// Severity is SeverityError for every failure reported by Validate.
+	Severity Severity
+	// Tag is name of failed validation (i.e. required or insubnets) or code of lint finding.
+	Tag string
+	// Param is parameter of failed validation, i.e. 1 for min=1.
+	Param string
+	// Value is offending value. It is nil for missing fields.
+	Value interface{}
+	// Message is plain English description of failure.
+	Message string
+}
+
+func (e FieldError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "(document)"
+	}
+	if e.Document != "" {
+		path = e.Document + ": " + path
+	}
+	if e.Severity == SeverityWarning {
+		path = path + ": warning"
+	}
+	if v := formatValue(e.Value); v != "" {
+		return fmt.Sprintf("%s: %s (got %s)", path, e.Message, v)
+	}
+	return fmt.Sprintf("%s: %s", path, e.Message)
+}
+
+// FieldErrors is list of problems which sorts by document, path (with list indexes compared as numbers), severity
+// and tag.
+type FieldErrors []FieldError
+
+func (l FieldErrors) Len() int      { return len(l) }
+func (l FieldErrors) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+
+func (l FieldErrors) Less(i, j int) bool {
+	a, b := l[i], l[j]
+	if a.Document != b.Document {
+		return a.Document < b.Document
+	}
+	if c := comparePaths(a.Path, b.Path); c != 0 {
+		return c < 0
+	}
+	if a.Severity != b.Severity {
+		return a.Severity == SeverityError
+	}
+	return a.Tag < b.Tag
+}
+
+// HasErrors checks if there is at least one problem of SeverityError on the list.
+func (l FieldErrors) HasErrors() bool {
+	for _, e := range l {
+		if e.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+var pathToken = regexp.MustCompile(`[0-9]+|[^0-9]+`)
+
+// comparePaths compares JSON paths so params.vm_groups[2] goes before params.vm_groups[10].
+func comparePaths(a, b string) int {
+	at, bt := pathToken.FindAllString(a, -1), pathToken.FindAllString(b, -1)
+	for i := 0; i < len(at) && i < len(bt); i++ {
+		if at[i] == bt[i] {
+			continue
+		}
+		an, aerr := strconv.Atoi(at[i])
+		bn, berr := strconv.Atoi(bt[i])
+		if aerr == nil && berr == nil {
+			if an < bn {
+				return -1
+			}
+			return 1
+		}
+		if at[i] < bt[i] {
+			return -1
+		}
+		return 1
+	}
+	return len(at) - len(bt)
+}
+
+// ValidationError is returned by Validate methods of structures. It lists every failure found by validator (in
+// order of fields in structure, use sort.Sort to order them by path) and wraps original validator.ValidationErrors, so they are still reachable with errors.As.
+type ValidationError struct {
+	Fields FieldErrors
+	raw    validator.ValidationErrors
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		lines = append(lines, f.Error())
+	}
+	if len(lines) == 1 {
+		return "validation failed: " + lines[0]
+	}
+	return "validation failed:\n  " + strings.Join(lines, "\n  ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	if len(e.raw) == 0 {
+		return nil
+	}
+	return e.raw
+}
+
+// Problems returns every problem described by err: list of ValidationError or single problem with empty path
+// for other errors. Nil is returned for nil error.
+func Problems(err error) FieldErrors {
+	if err == nil {
+		return nil
+	}
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		return verr.Fields
+	}
+	return FieldErrors{{Severity: SeverityError, Tag: "fatal", Message: err.Error()}}
+}
+
+// NewValidationError translates validator.ValidationErrors returned by validation of structure pointed by v into
+// ValidationError. Other errors (including nil) are returned untouched.
+func NewValidationError(v interface{}, err error) error {
+	errs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return err
+	}
+	root := reflect.TypeOf(v)
+	result := &ValidationError{raw: errs}
+	seen := make(map[string]bool)
+	for _, e := range errs {
+		path, parent := jsonPath(root, e.Namespace())
+		if seen[path+" "+e.Tag()] {
+			// the same failure reported both by struct tag and by struct level validation
+			continue
+		}
+		seen[path+" "+e.Tag()] = true
+		param := e.Param()
+		if strings.Contains(e.Tag(), "|") {
+			// validator reports parameter of the last alternative only, all of them are part of tag anyway
+			param = ""
+		}
+		result.Fields = append(result.Fields, FieldError{
+			Path:     path,
+			Severity: SeverityError,
+			Tag:      e.Tag(),
+			Param:    param,
+			Value:    value(e),
+			Message:  message(e, parent),
+		})
+	}
+	return result
+}
+
+// quotedName matches field name quoted in mapstructure errors, i.e. 'params.vm_count' expected type 'int'.
+var quotedName = regexp.MustCompile(`'([^']*)'`)
+
+// decodeProblems translates failures of decoding document reported by mapstructure.
+func decodeProblems(merr *maps.Error) FieldErrors {
+	result := make(FieldErrors, 0, len(merr.Errors))
+	for _, e := range merr.Errors {
+		path := ""
+		if m := quotedName.FindStringSubmatch(e); m != nil {
+			path = m[1]
+			e = strings.TrimSpace(strings.Replace(e, m[0], "", 1))
+		}
+		result = append(result, FieldError{
+			Path:     path,
+			Severity: SeverityError,
+			Tag:      "type",
+			Message:  e,
+		})
+	}
+	return result
+}
+
+// withProblems builds ValidationError of problems found while decoding document followed by result of validation
+// of decoded structure. Validation failures of fields which already have problem reported are dropped as that
+// problem describes them better.
+func withProblems(problems FieldErrors, validateErr error) error {
+	result := &ValidationError{Fields: problems}
+	failed := make(map[string]bool)
+	for _, p := range problems {
+		failed[p.Path] = true
+	}
+	var verr *ValidationError
+	if errors.As(validateErr, &verr) {
+		for _, f := range verr.Fields {
+			if !failed[f.Path] {
+				result.Fields = append(result.Fields, f)
+			}
+		}
+		result.raw = verr.raw
+	} else if validateErr != nil {
+		result.Fields = append(result.Fields, Problems(validateErr)...)
+	}
+	return result
+}
+
+// jsonPath translates namespace of Go fields (i.e. Config.Params.VmGroups[0].SubnetNames[0]) into path of JSON
+// fields. It returns type of structure holding the last field as well.
+func jsonPath(root reflect.Type, namespace string) (string, reflect.Type) {
+	t := root
+	var parent reflect.Type
+	segments := strings.Split(namespace, ".")
+	parts := make([]string, 0, len(segments))
+	for _, segment := range segments[1:] {
+		name, indexes := segment, ""
+		if i := strings.Index(segment, "["); i >= 0 {
+			name, indexes = segment[:i], segment[i:]
+		}
+		t = indirect(t)
+		if t == nil || t.Kind() != reflect.Struct {
+			parts = append(parts, segment)
+			t = nil
+			continue
+		}
+		f, ok := t.FieldByName(name)
+		if !ok {
+			// structures validated separately in struct level validations start their own namespace
+			if name != t.Name() || indexes != "" {
+				parts = append(parts, segment)
+				t = nil
+			}
+			continue
+		}
+		parent = t
+		parts = append(parts, jsonName(f)+indexes)
+		t = f.Type
+		for i := strings.Count(indexes, "["); i > 0 && t != nil; i-- {
+			if k := indirect(t).Kind(); k == reflect.Slice || k == reflect.Array || k == reflect.Map {
+				t = indirect(t).Elem()
+			} else {
+				t = nil
+			}
+		}
+	}
+	return strings.Join(parts, "."), parent
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// jsonName returns name of field used in documents.
+func jsonName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		return f.Name
+	}
+	return name
+}
+
+// siblingName returns JSON name of field of parent structure named in parameter of cross-field validation.
+func siblingName(parent reflect.Type, name string) string {
+	if parent != nil {
+		if f, ok := parent.FieldByName(name); ok {
+			return jsonName(f)
+		}
+	}
+	return name
+}
+
+func value(e validator.FieldError) interface{} {
+	v := reflect.ValueOf(e.Value())
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+	}
+	return e.Value()
+}
+
+func formatValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if reflect.Indirect(reflect.ValueOf(v)).Kind() == reflect.Struct {
+		// nested structures are too big to be printed in single line
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// message returns plain English description of failed validation. Tags without dedicated message are described
+// with their name and parameter.
+func message(e validator.FieldError, parent reflect.Type) string {
+	tag, param := e.Tag(), e.Param()
+	if strings.Contains(tag, "|") || strings.HasPrefix(tag, "eq=") {
+		values := make([]string, 0)
+		for _, alternative := range strings.Split(tag, "|") {
+			values = append(values, fmt.Sprintf("%q", strings.TrimPrefix(alternative, "eq=")))
+		}
+		if len(values) == 1 {
+			return "must be " + values[0]
+		}
+		return "must be one of " + strings.Join(values, ", ")
+	}
+	switch tag {
+	case "required":
+		return "is required"
+	case "min", "max", "len":
+		return length(e.Kind(), tag, param)
+	case "cidr":
+		return "must be a valid CIDR block, i.e. 10.0.0.0/16"
+	case "version":
+		return fmt.Sprintf("must be a semantic version matching %s", param)
+	case "gtefield":
+		return fmt.Sprintf("must be greater than or equal to %s", siblingName(parent, param))
+	case "ltefield":
+		return fmt.Sprintf("must be less than or equal to %s", siblingName(parent, param))
+	case "required_with":
+		return fmt.Sprintf("is required when %s is set", siblingName(parent, param))
+	case "required_without":
+		return fmt.Sprintf("is required when %s is not set", siblingName(parent, param))
+	case "excluded":
+		return "must not be set"
+	case "excluded_without":
+		return fmt.Sprintf("must not be set when %s is not set", siblingName(parent, param))
+	case "insubnets":
+		return "must be the name of a subnet defined in params.subnets"
+	case "insecuritygroups":
+		return "must be the name of a security group defined in params.security_groups"
+	case "private_or_public":
+		return "must define at least one private or public subnet"
+	case "inaddressspace":
+		return "must be contained in one of params.address_space blocks"
+	case "nooverlap":
+		return fmt.Sprintf("must not overlap %s", param)
+	case "fitsvms":
+		return fmt.Sprintf("must have room for %s VMs of attached VM groups (Azure reserves 5 addresses in every subnet)", param)
+	case "fatal":
+		return "could not be validated"
+	}
+	if param != "" {
+		return fmt.Sprintf("failed on %s=%s validation", tag, param)
+	}
+	return fmt.Sprintf("failed on %s validation", tag)
+}
+
+// length describes min, max and len validations which meaning depends on kind of field.
+func length(kind reflect.Kind, tag, param string) string {
+	var bound string
+	switch tag {
+	case "min":
+		bound = "at least "
+	case "max":
+		bound = "at most "
+	}
+	switch kind {
+	case reflect.String:
+		return fmt.Sprintf("must be %s%s characters long", bound, param)
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return fmt.Sprintf("must contain %s%s items", bound, param)
+	}
+	switch tag {
+	case "min":
+		return fmt.Sprintf("must be %s or greater", param)
+	case "max":
+		return fmt.Sprintf("must be %s or less", param)
+	}
+	return fmt.Sprintf("must be equal to %s", param)
+}
@@ -0,0 +1,100 @@
+package shared
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/epiphany-platform/e-structures/utils/to"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testValidatedSubnet struct {
+	Name *string `json:"name" validate:"required,min=1"`
+}
+
+type testValidatedSubnets struct {
+	Private []testValidatedSubnet `json:"private" validate:"required_without=Public,omitempty,dive"`
+	Public  []testValidatedSubnet `json:"public" validate:"required_without=Private,omitempty,dive"`
+}
+
+type testValidated struct {
+	Count   *int                  `json:"vm_count" validate:"required,min=1"`
+	Subnets *testValidatedSubnets `json:"subnets" validate:"required"`
+	Cidrs   []string              `json:"address_space" validate:"required,min=1,dive,cidr"`
+}
+
+func TestNewValidationError(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	v := &testValidated{
+		Count:   to.IntPtr(0),
+		Subnets: &testValidatedSubnets{},
+		Cidrs:   []string{"10.0.0.0/16", "10.1.0.0"},
+	}
+	validate := validator.New()
+	validate.RegisterStructValidation(func(sl validator.StructLevel) {
+		// mimics reporting of errors of structures validated separately, i.e. in AwsBIParamsValidation
+		errs := validator.New().Struct(testValidatedSubnet{Name: to.StrPtr("")}).(validator.ValidationErrors)
+		sl.ReportValidationErrors("Public[0].", "Public[0].", errs)
+	}, testValidatedSubnets{})
+
+	err := NewValidationError(v, validate.Struct(v))
+	var verr *ValidationError
+	r.True(errors.As(err, &verr))
+	var errs validator.ValidationErrors
+	a.True(errors.As(err, &errs))
+
+	paths := make([]string, 0)
+	messages := make([]string, 0)
+	for _, f := range verr.Fields {
+		paths = append(paths, f.Path)
+		messages = append(messages, f.Error())
+	}
+	a.Equal([]string{
+		"vm_count",
+		"subnets.private",
+		"subnets.public",
+		"subnets.public[0].name",
+		"address_space[1]",
+	}, paths)
+	a.Equal([]string{
+		"vm_count: must be 1 or greater (got 0)",
+		"subnets.private: is required when public is not set",
+		"subnets.public: is required when private is not set",
+		`subnets.public[0].name: must be at least 1 characters long (got "")`,
+		`address_space[1]: must be a valid CIDR block, i.e. 10.0.0.0/16 (got "10.1.0.0")`,
+	}, messages)
+
+	a.Nil(NewValidationError(v, nil))
+	other := errors.New("other")
+	a.Equal(other, NewValidationError(v, other))
+}
+
+func TestFieldErrors_Sort(t *testing.T) {
+	a := assert.New(t)
+	l := FieldErrors{
+		{Document: "state.json", Path: "status", Severity: SeverityError, Message: `must be "applied"`},
+		{Document: "config.json", Path: "params.vm_groups[10].name", Severity: SeverityError, Message: "is too short"},
+		{Document: "config.json", Path: "params.vm_groups[2].name", Severity: SeverityWarning, Message: "looks suspicious"},
+		{Document: "config.json", Path: "params.vm_groups[2].name", Severity: SeverityError, Message: "is too short"},
+		{Document: "config.json", Path: "params", Severity: SeverityError, Message: "is required"},
+	}
+	a.True(l.HasErrors())
+	a.False(l[2:3].HasErrors())
+
+	sort.Sort(l)
+	got := make([]string, 0)
+	for _, e := range l {
+		got = append(got, e.Error())
+	}
+	a.Equal([]string{
+		"config.json: params: is required",
+		"config.json: params.vm_groups[2].name: is too short",
+		"config.json: params.vm_groups[2].name: warning: looks suspicious",
+		"config.json: params.vm_groups[10].name: is too short",
+		"state.json: status: must be \"applied\"",
+	}, got)
+}
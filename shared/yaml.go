@@ -0,0 +1,159 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"path"
+	"strings"
+)
+
+// Format is serialization format of document.
+type Format string
+
+const (
+	JSON Format = "json"
+	YAML Format = "yaml"
+)
+
+// FormatOf returns format of document with provided name: YAML for names with .yaml or .yml extension, JSON
+// otherwise.
+func FormatOf(name string) Format {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".yaml", ".yml":
+		return YAML
+	}
+	return JSON
+}
+
+// DetectFormat returns format of document with provided name and content. Document is considered YAML if its
+// name has YAML extension or if its content doesn't start with JSON object.
+func DetectFormat(name string, document []byte) Format {
+	if FormatOf(name) == YAML {
+		return YAML
+	}
+	trimmed := bytes.TrimSpace(document)
+	if len(trimmed) > 0 && trimmed[0] != '{' {
+		return YAML
+	}
+	return JSON
+}
+
+// ToJSON returns JSON form of document with provided name. JSON documents are returned untouched, YAML ones are
+// converted so they are decoded and validated exactly the same way as JSON ones.
+func ToJSON(name string, document []byte) ([]byte, error) {
+	if DetectFormat(name, document) == JSON {
+		return document, nil
+	}
+	var v interface{}
+	err := yaml.Unmarshal(document, &v)
+	if err != nil {
+		return nil, err
+	}
+	v, err = jsonCompatible(v)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := v.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("document %s is not an object", name)
+	}
+	return json.Marshal(v)
+}
+
+// InFormat makes Save and Backup functions write document in format f whatever name it is stored under. Format
+// is chosen by name of document (see FormatOf) if option is not provided.
+func InFormat(f Format) EncodeOption {
+	return func(o *encodeOptions) {
+		o.format = f
+	}
+}
+
+// ToFormat converts JSON document into format expected for document with provided name (see FormatOf).
+func ToFormat(name string, document []byte) ([]byte, error) {
+	return convert(FormatOf(name), document)
+}
+
+// toFormat converts JSON document into format set with InFormat option or expected for document with provided
+// name if option is not provided.
+func toFormat(name string, document []byte, options []EncodeOption) ([]byte, error) {
+	f := newEncodeOptions(options).format
+	if f == "" {
+		f = FormatOf(name)
+	}
+	return convert(f, document)
+}
+
+// convert converts JSON document into format f.
+func convert(f Format, document []byte) ([]byte, error) {
+	if f == YAML {
+		return ToYAML(document)
+	}
+	return document, nil
+}
+
+// ToYAML converts JSON document into YAML keeping order of fields. Strings which would be read back as other
+// types (i.e. "true" or "1") are quoted and multi-line strings are emitted as literal blocks.
+func ToYAML(document []byte) ([]byte, error) {
+	var n yaml.Node
+	err := yaml.Unmarshal(document, &n)
+	if err != nil {
+		return nil, err
+	}
+	blockStyle(&n)
+	var b bytes.Buffer
+	e := yaml.NewEncoder(&b)
+	e.SetIndent(2)
+	err = e.Encode(&n)
+	if err != nil {
+		return nil, err
+	}
+	err = e.Close()
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// blockStyle drops JSON (flow) styles from nodes so encoder picks the most natural YAML style for them.
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// jsonCompatible replaces maps with non-string keys (which YAML allows) with maps of strings.
+func jsonCompatible(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			c, err := jsonCompatible(e)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = c
+		}
+		return t, nil
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			c, err := jsonCompatible(e)
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(k)] = c
+		}
+		return m, nil
+	case []interface{}:
+		for i, e := range t {
+			c, err := jsonCompatible(e)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = c
+		}
+		return t, nil
+	}
+	return v, nil
+}
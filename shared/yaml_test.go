@@ -0,0 +1,218 @@
+package shared
+
+import (
+	"testing"
+
+	"github.com/epiphany-platform/e-structures/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     Format
+	}{
+		{
+			name:     "config.json",
+			document: "{\"a\": 1}",
+			want:     JSON,
+		},
+		{
+			name:     "config.json",
+			document: "\n\t {\"a\": 1}",
+			want:     JSON,
+		},
+		{
+			name:     "config.json",
+			document: "a: 1",
+			want:     YAML,
+		},
+		{
+			name:     "config.yaml",
+			document: "{\"a\": 1}",
+			want:     YAML,
+		},
+		{
+			name:     "CONFIG.YML",
+			document: "a: 1",
+			want:     YAML,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, DetectFormat(tt.name, []byte(tt.document)))
+		})
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "json is untouched",
+			document: "{\"b\": 1, \"a\": 2}",
+			want:     "{\"b\": 1, \"a\": 2}",
+		},
+		{
+			name: "yaml with comments",
+			document: `# comment
+meta:
+  kind: test # other comment
+  version: v0.0.1
+count: 3
+enabled: true
+list:
+  - "1"
+  - 2
+multi: |
+  line 1
+  line 2
+nothing: null
+`,
+			want: `{"count":3,"enabled":true,"list":["1",2],"meta":{"kind":"test","version":"v0.0.1"},"multi":"line 1\nline 2\n","nothing":null}`,
+		},
+		{
+			name:     "non string keys",
+			document: "1: a\ntrue: b\n",
+			want:     `{"1":"a","true":"b"}`,
+		},
+		{
+			name:     "not an object",
+			document: "- a\n- b\n",
+			wantErr:  true,
+		},
+		{
+			name:     "invalid yaml",
+			document: "a: [",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToJSON("file", []byte(tt.document))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestToYAML(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	document := `{
+	"meta": {
+		"version": "v0.0.1",
+		"kind": "test"
+	},
+	"quoted": ["true", "1", "null", "~", ""],
+	"count": 3,
+	"nothing": null,
+	"empty": [],
+	"multi": "line 1\nline 2\n"
+}`
+	got, err := ToYAML([]byte(document))
+	r.NoError(err)
+	a.Equal(`meta:
+  version: v0.0.1
+  kind: test
+quoted:
+  - "true"
+  - "1"
+  - "null"
+  - "~"
+  - ""
+count: 3
+nothing: null
+empty: []
+multi: |
+  line 1
+  line 2
+`, string(got))
+
+	back, err := ToJSON("file.yaml", got)
+	r.NoError(err)
+	a.JSONEq(document, string(back))
+}
+
+type testPrinter string
+
+func (p testPrinter) Print(...EncodeOption) ([]byte, error) {
+	return []byte(p), nil
+}
+
+func (p testPrinter) PrintYAML(...EncodeOption) ([]byte, error) {
+	return ToYAML([]byte(p))
+}
+
+func (p testPrinter) PrintRedacted(RedactOptions) ([]byte, error) {
+	return []byte(p), nil
+}
+
+func TestSaveTo_InFormat(t *testing.T) {
+	p := testPrinter(`{"name": "n"}`)
+	tests := []struct {
+		name     string
+		document string
+		options  []EncodeOption
+		want     string
+	}{
+		{
+			name:     "format of json name",
+			document: "config.json",
+			options:  nil,
+			want:     `{"name": "n"}`,
+		},
+		{
+			name:     "format of yaml name",
+			document: "config.yaml",
+			options:  nil,
+			want:     "name: n\n",
+		},
+		{
+			name:     "yaml under json name",
+			document: "config.json",
+			options:  []EncodeOption{InFormat(YAML)},
+			want:     "name: n\n",
+		},
+		{
+			name:     "json under yaml name",
+			document: "config.yaml",
+			options:  []EncodeOption{InFormat(JSON)},
+			want:     `{"name": "n"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := require.New(t)
+			st := storage.NewMemory()
+			r.NoError(SaveTo(p, st, tt.document, tt.options...))
+			got, err := st.Read(tt.document)
+			r.NoError(err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestDowngradeFrom_KeepsFormat(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	m := NewMigrations("v0.0.2", Migration{From: "v0.0.1", To: "v0.0.2"})
+	st := storage.NewMemory()
+	r.NoError(st.Write("config.json", []byte("meta:\n  version: v0.0.2\nname: n\n")))
+
+	_, err := DowngradeFrom(m, st, "config.json", "backup.json", "v0.0.1", false)
+	r.NoError(err)
+	got, err := st.Read("config.json")
+	r.NoError(err)
+	a.Equal("meta:\n  version: v0.0.1\nname: n\n", string(got))
+}
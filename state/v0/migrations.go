@@ -0,0 +1,39 @@
+package v0
+
+import (
+	"errors"
+
+	awsbi "github.com/epiphany-platform/e-structures/awsbi/v0"
+	azks "github.com/epiphany-platform/e-structures/azks/v0"
+	hi "github.com/epiphany-platform/e-structures/hi/v0"
+	"github.com/epiphany-platform/e-structures/shared"
+)
+
+var migrations = shared.NewMigrations(version,
+	shared.Migration{
+		// embedded module configs got meta block instead of top level kind and version
+		From: "v0.0.5",
+		To:   "v0.0.6",
+		Subtrees: map[string]string{
+			"azks.config":  "v0.0.3",
+			"awsbi.config": "v0.0.1",
+			"hi.config":    "v0.0.1",
+		},
+	},
+).WithSubtree("azks.config", azks.ConfigMigrations()).
+	WithSubtree("awsbi.config", awsbi.ConfigMigrations()).
+	WithSubtree("hi.config", hi.ConfigMigrations())
+
+// upgrade migrates raw state to current version. Documents which version cannot be determined or is unknown to
+// migrations are left untouched, so they are reported by validation.
+func upgrade(input map[string]interface{}) error {
+	v, err := shared.GetVersion(input)
+	if err != nil || v == version {
+		return nil
+	}
+	_, err = migrations.Migrate(input)
+	if errors.Is(err, shared.ErrUnknownVersion) {
+		return nil
+	}
+	return err
+}
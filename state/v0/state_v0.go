@@ -7,6 +7,7 @@ import (
 	awsbi "github.com/epiphany-platform/e-structures/awsbi/v0"
 	azks "github.com/epiphany-platform/e-structures/azks/v0"
 	hi "github.com/epiphany-platform/e-structures/hi/v0"
+	"github.com/epiphany-platform/e-structures/shared"
 	"github.com/epiphany-platform/e-structures/utils/to"
 	"github.com/epiphany-platform/e-structures/utils/validators"
 	"github.com/go-playground/validator/v10"
@@ -17,7 +18,7 @@ type Status string
 
 const (
 	kind    = "state"
-	version = "v0.0.5"
+	version = "v0.0.6"
 
 	Initialized Status = "initialized"
 	Applied     Status = "applied"
@@ -67,6 +68,8 @@ func (s *AzKSState) GetOutput() *azks.Output {
 type State struct {
 	Kind    *string     `json:"kind" validate:"required,eq=state"`
 	Version *string     `json:"version" validate:"required,version=~0"`
+	Serial  *int        `json:"serial,omitempty" validate:"omitempty,min=0"`
+	Hash    *string     `json:"hash,omitempty"`
 	Unused  []string    `json:"-"`
 	AzKS    *AzKSState  `json:"azks" validate:"omitempty"`
 	Hi      *HiState    `json:"hi" validate:"omitempty"`
@@ -87,6 +90,28 @@ func (s *State) GetHiState() *HiState {
 	return s.Hi
 }
 
+func (s *State) GetSerial() (int, string) {
+	if s == nil {
+		return 0, ""
+	}
+	serial, hash := 0, ""
+	if s.Serial != nil {
+		serial = *s.Serial
+	}
+	if s.Hash != nil {
+		hash = *s.Hash
+	}
+	return serial, hash
+}
+
+func (s *State) SetSerial(serial int, hash string) {
+	s.Serial = to.IntPtr(serial)
+	s.Hash = nil
+	if hash != "" {
+		s.Hash = to.StrPtr(hash)
+	}
+}
+
 //TODO test
 func NewState() *State {
 	return &State{
@@ -96,19 +121,32 @@ func NewState() *State {
 	}
 }
 
-func (s *State) Marshal() ([]byte, error) {
+// Marshal encodes state as JSON. Options (i.e. shared.EncryptWith) change how state is encoded.
+func (s *State) Marshal(options ...shared.EncodeOption) ([]byte, error) {
 	err := s.isValid()
 	if err != nil {
 		return nil, err
 	}
-	return json.MarshalIndent(s, "", "\t")
+	c, err := shared.EncryptedCopy(s, options...)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(c, "", "\t")
 }
 
-func (s *State) Unmarshal(b []byte) (err error) {
+// Unmarshal decodes state from JSON or YAML document b. Documents in older versions are migrated first. Options
+// (i.e. shared.DecryptWith or shared.Strict) change how state is decoded.
+func (s *State) Unmarshal(b []byte, options ...shared.DecodeOption) (err error) {
+	if b, err = shared.ToJSON("", b); err != nil {
+		return
+	}
 	var input map[string]interface{}
 	if err = json.Unmarshal(b, &input); err != nil {
 		return
 	}
+	if err = upgrade(input); err != nil {
+		return
+	}
 	var md maps.Metadata
 	d, err := maps.NewDecoder(&maps.DecoderConfig{
 		Metadata: &md,
@@ -122,8 +160,12 @@ func (s *State) Unmarshal(b []byte) (err error) {
 	if err != nil {
 		return
 	}
+	err = shared.DecryptSensitive(s, options...)
+	if err != nil {
+		return
+	}
 	s.Unused = md.Unused
-	err = s.isValid()
+	err = shared.CheckUnknown(s, md.Unused, s.isValid(), options...)
 	return
 }
 
@@ -141,7 +183,7 @@ func (s *State) isValid() error {
 		if _, ok := err.(*validator.InvalidValidationError); ok {
 			return err
 		}
-		return err
+		return shared.NewValidationError(s, err)
 	}
 	return nil
 }
@@ -149,11 +191,18 @@ func (s *State) isValid() error {
 // DO NOT USE!!!
 // This is temporary function used to fix existing issue (https://github.com/epiphany-platform/e-structures/issues/10)
 // in some modules and will be removed shortly after issue is resolved in all modules
-func (s *State) UnmarshalDoNotUse(b []byte) error {
+func (s *State) UnmarshalDoNotUse(b []byte, options ...shared.DecodeOption) error {
+	b, err := shared.ToJSON("", b)
+	if err != nil {
+		return err
+	}
 	var input map[string]interface{}
 	if err := json.Unmarshal(b, &input); err != nil {
 		return err
 	}
+	if err := upgrade(input); err != nil {
+		return err
+	}
 	var md maps.Metadata
 	d, err := maps.NewDecoder(&maps.DecoderConfig{
 		Metadata: &md,
@@ -167,6 +216,10 @@ func (s *State) UnmarshalDoNotUse(b []byte) error {
 	if err != nil {
 		return err
 	}
+	err = shared.DecryptSensitive(s, options...)
+	if err != nil {
+		return err
+	}
 	s.Unused = md.Unused
 	return nil
 }
@@ -0,0 +1,251 @@
+package v0
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/epiphany-platform/e-structures/shared"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stateV005 is state document written by e-structures before module configs got meta block.
+const stateV005 = `{
+	"kind": "state",
+	"version": "v0.0.5",
+	"azks": {
+		"status": "applied",
+		"config": {
+			"kind": "azks",
+			"version": "v0.0.3",
+			"params": {
+				"name": "epiphany",
+				"location": "northeurope",
+				"rsa_pub_path": "/shared/vms_rsa.pub",
+				"rg_name": "epiphany-rg",
+				"vnet_name": "epiphany-vnet",
+				"subnet_name": "azks",
+				"kubernetes_version": "1.18.14",
+				"enable_node_public_ip": false,
+				"enable_rbac": false,
+				"default_node_pool": {
+					"size": 2,
+					"min": 2,
+					"max": 5,
+					"vm_size": "Standard_DS2_v2",
+					"disk_gb_size": 36,
+					"auto_scaling": true,
+					"type": "VirtualMachineScaleSets"
+				},
+				"auto_scaler_profile": {
+					"balance_similar_node_groups": false,
+					"max_graceful_termination_sec": "600",
+					"scale_down_delay_after_add": "10m",
+					"scale_down_delay_after_delete": "10s",
+					"scale_down_delay_after_failure": "10m",
+					"scan_interval": "10s",
+					"scale_down_unneeded": "10m",
+					"scale_down_unready": "10m",
+					"scale_down_utilization_threshold": "0.5"
+				},
+				"azure_ad": null,
+				"identity_type": "SystemAssigned",
+				"admin_username": "operations"
+			}
+		},
+		"output": {
+			"kubeconfig": "kubeconfig"
+		}
+	},
+	"hi": {
+		"status": "initialized",
+		"config": {
+			"kind": "hi",
+			"version": "v0.0.1",
+			"params": {
+				"vm_groups": [
+					{
+						"name": "vm-group0",
+						"admin_user": "operations",
+						"hosts": [
+							{
+								"name": "epiphany-vm-group0-1",
+								"ip": "10.0.1.4"
+							}
+						],
+						"mount_point": [
+							{
+								"lun": 10,
+								"path": "/data/test"
+							}
+						]
+					}
+				],
+				"rsa_private_path": "/shared/vms_rsa"
+			}
+		}
+	},
+	"awsbi": {
+		"status": "applied",
+		"config": {
+			"kind": "awsbi",
+			"version": "v0.0.1",
+			"params": {
+				"name": "epiphany",
+				"region": "eu-central-1",
+				"nat_gateway_count": 1,
+				"virtual_private_gateway": false,
+				"rsa_pub_path": "/shared/vms_rsa.pub",
+				"vpc_address_space": "10.1.0.0/20",
+				"subnets": {
+					"private": [
+						{
+							"name": "first_private_subnet",
+							"availability_zone": "any",
+							"address_prefixes": "10.1.1.0/24"
+						}
+					],
+					"public": [
+						{
+							"name": "first_public_subnet",
+							"availability_zone": "any",
+							"address_prefixes": "10.1.2.0/24"
+						}
+					]
+				},
+				"security_groups": [
+					{
+						"name": "default_sg",
+						"rules": {
+							"ingress": [
+								{
+									"protocol": "-1",
+									"from_port": 0,
+									"to_port": 0,
+									"cidr_blocks": [
+										"10.1.0.0/20"
+									]
+								},
+								{
+									"protocol": "tcp",
+									"from_port": 22,
+									"to_port": 22,
+									"cidr_blocks": [
+										"0.0.0.0/0"
+									]
+								}
+							],
+							"egress": [
+								{
+									"protocol": "-1",
+									"from_port": 0,
+									"to_port": 0,
+									"cidr_blocks": [
+										"0.0.0.0/0"
+									]
+								}
+							]
+						}
+					}
+				],
+				"vm_groups": [
+					{
+						"name": "vm-group0",
+						"vm_count": 1,
+						"vm_size": "t3.medium",
+						"use_public_ip": false,
+						"subnet_names": [
+							"first_private_subnet"
+						],
+						"sg_names": [
+							"default_sg"
+						],
+						"vm_image": {
+							"ami": "RHEL-7.8_HVM_GA-20200225-x86_64-1-Hourly2-GP2",
+							"owner": "309956199498"
+						},
+						"root_volume_size": 30,
+						"data_disks": [
+							{
+								"device_name": "/dev/sdf",
+								"disk_size_gb": 16,
+								"type": "gp2"
+							}
+						]
+					}
+				]
+			}
+		},
+		"output": null
+	}
+}`
+
+func TestState_UnmarshalV005(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	s := NewState()
+	r.NoError(s.Unmarshal([]byte(stateV005)))
+	a.Equal("v0.0.6", *s.Version)
+	a.Empty(s.Unused)
+
+	r.NotNil(s.GetAzKSState().GetConfig())
+	azks := s.GetAzKSState().GetConfig()
+	a.Equal("azksConfig", *azks.Meta.Kind)
+	a.Equal("v0.1.0", *azks.Meta.Version)
+	a.Equal("unknown", *azks.Meta.ModuleVersion)
+	a.Equal("epiphany", *azks.Params.Name)
+	a.Equal("kubeconfig", *s.GetAzKSState().GetOutput().KubeConfig)
+
+	r.NotNil(s.GetHiState().GetConfig())
+	hi := s.GetHiState().GetConfig()
+	a.Equal("hiConfig", *hi.Meta.Kind)
+	a.Equal("v0.1.0", *hi.Meta.Version)
+	a.Equal("/shared/vms_rsa", *hi.Params.RsaPrivateKeyPath)
+
+	r.NotNil(s.AwsBI)
+	r.NotNil(s.AwsBI.Config)
+	a.Equal("awsbiConfig", *s.AwsBI.Config.Meta.Kind)
+	a.Equal("v0.1.0", *s.AwsBI.Config.Meta.Version)
+	a.Equal("eu-central-1", *s.AwsBI.Config.Params.Region)
+
+	// migrated state is written and read back in current version
+	b, err := s.Marshal()
+	r.NoError(err)
+	loaded := NewState()
+	r.NoError(loaded.Unmarshal(b))
+	a.Equal(s, loaded)
+}
+
+func TestState_UnmarshalStrict(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	b := []byte(`{
+	"kind": "state",
+	"version": "v0.0.6",
+	"colour": "blue",
+	"hi": {
+		"stauts": "applied"
+	}
+}`)
+
+	// unknown fields are collected but not reported by default
+	s := NewState()
+	err := s.Unmarshal(b)
+	var verr *shared.ValidationError
+	r.True(errors.As(err, &verr))
+	a.ElementsMatch([]string{"colour", "hi.stauts"}, s.Unused)
+
+	s = NewState()
+	err = s.Unmarshal(b, shared.Strict())
+	r.True(errors.As(err, &verr))
+	messages := make([]string, 0)
+	for _, f := range verr.Fields {
+		messages = append(messages, f.Error())
+	}
+	a.ElementsMatch([]string{
+		"colour: is not known field",
+		"hi.stauts: is not known field, did you mean status?",
+		"hi.status: is required (got \"\")",
+	}, messages)
+}
@@ -0,0 +1,394 @@
+// Package kube provides storage.Storage keeping documents in Kubernetes Secrets or ConfigMaps.
+package kube
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/epiphany-platform/e-structures/storage"
+	"io/fs"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/rest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind is kind of Kubernetes object documents are kept in.
+type Kind string
+
+const (
+	Secret    Kind = "Secret"
+	ConfigMap Kind = "ConfigMap"
+)
+
+const (
+	// DocumentKey is key of Secret or ConfigMap data document content is kept under.
+	DocumentKey = "document"
+	// StorageLabel is label with Config.Name every object of storage is marked with.
+	StorageLabel = "e-structures.epiphany-platform.github.com/storage"
+	// DocumentAnnotation is annotation with name of document object keeps.
+	DocumentAnnotation = "e-structures.epiphany-platform.github.com/document"
+)
+
+// Config holds location of documents in Kubernetes cluster.
+type Config struct {
+	Client kubernetes.Interface
+	// Metadata is used by List to fetch only metadata of objects instead of whole objects with document content.
+	// List falls back to Client if not set. NewForConfig sets both clients.
+	Metadata  metadata.Interface
+	Namespace string
+	// Name identifies storage. It prefixes names of created objects and is value of StorageLabel, so it has to be
+	// valid both as part of object name and as label value, i.e. "azks-state".
+	Name string
+	// Kind of objects documents are kept in. Secret is used if not set.
+	Kind Kind
+	// LockTTL is age after which lock is considered stale and can be taken over. Locks never get stale if zero.
+	LockTTL time.Duration
+	// Context is parent of contexts API calls are made with, so cancelling it aborts calls in progress and makes
+	// all further calls fail. context.Background is used if not set.
+	Context context.Context
+	// Timeout limits duration of every single operation (i.e. Read, Write or one attempt to take lock). Operations
+	// are limited only by Context if zero.
+	Timeout time.Duration
+}
+
+// Storage keeps every document in separate Secret or ConfigMap. Object names are derived from hash of document
+// name as document names are not valid object names. Name of document is kept in DocumentAnnotation.
+//
+// resourceVersion of every document read or written is remembered and used in subsequent writes of that document
+// so Write returns error wrapping storage.ErrConflict if object was changed by someone else in the meantime.
+//
+// Every document, including every file of every backup, is a separate object counted against namespace quota and
+// kept in etcd, so Storage implements storage.Bounded to make sure backups kept in it get pruned.
+type Storage struct {
+	config  Config
+	objects objects
+
+	mu sync.Mutex
+	// versions are resourceVersions of documents seen by this Storage. Empty version means document didn't exist.
+	versions map[string]string
+}
+
+// New creates Storage keeping documents in objects described by config.
+func New(config Config) *Storage {
+	if config.Kind == "" {
+		config.Kind = Secret
+	}
+	if config.Context == nil {
+		config.Context = context.Background()
+	}
+	var o objects
+	switch config.Kind {
+	case ConfigMap:
+		o = configMaps{config.Client.CoreV1().ConfigMaps(config.Namespace)}
+	default:
+		o = secrets{config.Client.CoreV1().Secrets(config.Namespace)}
+	}
+	return &Storage{
+		config:   config,
+		objects:  o,
+		versions: make(map[string]string),
+	}
+}
+
+// NewForConfig creates Storage with clients created for restConfig, so List fetches only metadata of objects.
+// Client and Metadata set in config are replaced.
+func NewForConfig(restConfig *rest.Config, config Config) (*Storage, error) {
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	m, err := metadata.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	config.Client = client
+	config.Metadata = m
+	return New(config), nil
+}
+
+// RequiresRetention reports that backups kept in Storage have to be pruned (see storage.Bounded).
+func (s *Storage) RequiresRetention() bool {
+	return true
+}
+
+// ObjectName returns name of object keeping document with provided name.
+func (s *Storage) ObjectName(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return s.config.Name + "-" + hex.EncodeToString(sum[:])[:16]
+}
+
+func (s *Storage) Read(name string) ([]byte, error) {
+	b, _, err := s.ReadVersion(name)
+	return b, err
+}
+
+// ReadVersion returns document content together with resourceVersion of object keeping it.
+func (s *Storage) ReadVersion(name string) ([]byte, string, error) {
+	c, cancel := s.ctx()
+	defer cancel()
+	d, err := s.objects.get(c, s.ObjectName(name))
+	if apierrors.IsNotFound(err) {
+		s.remember(name, "")
+		return nil, "", notExist("read", name)
+	} else if err != nil {
+		return nil, "", err
+	}
+	s.remember(name, d.meta.ResourceVersion)
+	return d.data, d.meta.ResourceVersion, nil
+}
+
+func (s *Storage) Write(name string, data []byte) error {
+	version, known := s.version(name)
+	if !known {
+		c, cancel := s.ctx()
+		d, err := s.objects.get(c, s.ObjectName(name))
+		cancel()
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		if err == nil {
+			version = d.meta.ResourceVersion
+		}
+	}
+	return s.WriteVersion(name, data, version)
+}
+
+// WriteVersion replaces document only if object keeping it is still in resourceVersion version. Object is created
+// if version is empty.
+func (s *Storage) WriteVersion(name string, data []byte, version string) error {
+	c, cancel := s.ctx()
+	defer cancel()
+	var d *document
+	var err error
+	if version == "" {
+		d, err = s.objects.create(c, s.document(name, data))
+		if apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("%s: %w", name, storage.ErrConflict)
+		}
+	} else {
+		doc := s.document(name, data)
+		doc.meta.ResourceVersion = version
+		d, err = s.objects.update(c, doc)
+		if apierrors.IsConflict(err) || apierrors.IsNotFound(err) {
+			return fmt.Errorf("%s: %w", name, storage.ErrConflict)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	s.remember(name, d.meta.ResourceVersion)
+	return nil
+}
+
+func (s *Storage) Create(name string, data []byte) error {
+	c, cancel := s.ctx()
+	defer cancel()
+	d, err := s.objects.create(c, s.document(name, data))
+	if apierrors.IsAlreadyExists(err) {
+		return os.ErrExist
+	} else if err != nil {
+		return err
+	}
+	s.remember(name, d.meta.ResourceVersion)
+	return nil
+}
+
+func (s *Storage) Remove(name string) error {
+	c, cancel := s.ctx()
+	defer cancel()
+	err := s.objects.delete(c, s.ObjectName(name), "")
+	if apierrors.IsNotFound(err) {
+		return notExist("remove", name)
+	} else if err != nil {
+		return err
+	}
+	s.remember(name, "")
+	return nil
+}
+
+// List returns names of documents found in annotations of objects marked with StorageLabel of this storage.
+// Only metadata of objects is fetched if Config.Metadata is set.
+func (s *Storage) List(prefix string) ([]string, error) {
+	c, cancel := s.ctx()
+	defer cancel()
+	options := metav1.ListOptions{LabelSelector: StorageLabel + "=" + s.config.Name}
+	var metas []metav1.ObjectMeta
+	var err error
+	if s.config.Metadata != nil {
+		metas, err = s.listMetadata(c, options)
+	} else {
+		metas, err = s.objects.list(c, options)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0)
+	for _, m := range metas {
+		name, ok := m.Annotations[DocumentAnnotation]
+		if ok && strings.HasPrefix(name, prefix) {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// Lock creates lock object so only one holder can succeed. Lock object older than LockTTL is taken over (using
+// its resourceVersion) and its owner is reported as stale.
+func (s *Storage) Lock(name string, timeout time.Duration) (storage.Lock, error) {
+	return storage.WaitLock(timeout, func() (storage.Lock, error) {
+		c, cancel := s.ctx()
+		defer cancel()
+		owner, err := storage.CurrentOwner()
+		if err != nil {
+			return nil, err
+		}
+		b, err := json.Marshal(owner)
+		if err != nil {
+			return nil, err
+		}
+		d, err := s.objects.create(c, s.document(name, b))
+		if err == nil {
+			return &lock{storage: s, name: name, version: d.meta.ResourceVersion}, nil
+		}
+		if !apierrors.IsAlreadyExists(err) {
+			return nil, err
+		}
+
+		current, version, err := s.lockOwner(name)
+		if apierrors.IsNotFound(err) {
+			// released in the meantime
+			return nil, storage.ErrLockBusy
+		} else if err != nil {
+			return nil, err
+		}
+		if s.config.LockTTL <= 0 || time.Since(current.CreatedAt) < s.config.LockTTL {
+			return nil, storage.ErrLockBusy
+		}
+		doc := s.document(name, b)
+		doc.meta.ResourceVersion = version
+		d, err = s.objects.update(c, doc)
+		if apierrors.IsConflict(err) || apierrors.IsNotFound(err) {
+			// someone else took it over first
+			return nil, storage.ErrLockBusy
+		} else if err != nil {
+			return nil, err
+		}
+		return &lock{storage: s, name: name, version: d.meta.ResourceVersion, stale: current}, nil
+	}, func() *storage.LockOwner {
+		owner, _, _ := s.lockOwner(name)
+		return owner
+	})
+}
+
+func (s *Storage) lockOwner(name string) (*storage.LockOwner, string, error) {
+	c, cancel := s.ctx()
+	defer cancel()
+	d, err := s.objects.get(c, s.ObjectName(name))
+	if err != nil {
+		return nil, "", err
+	}
+	var o storage.LockOwner
+	err = json.Unmarshal(d.data, &o)
+	if err != nil {
+		return nil, "", err
+	}
+	return &o, d.meta.ResourceVersion, nil
+}
+
+type lock struct {
+	storage *Storage
+	name    string
+	version string
+	stale   *storage.LockOwner
+}
+
+func (l *lock) StaleOwner() *storage.LockOwner {
+	return l.stale
+}
+
+// Release deletes lock object unless it was taken over by someone else in the meantime.
+func (l *lock) Release() error {
+	if l.version == "" {
+		return nil
+	}
+	c, cancel := l.storage.ctx()
+	defer cancel()
+	err := l.storage.objects.delete(c, l.storage.ObjectName(l.name), l.version)
+	l.version = ""
+	if apierrors.IsConflict(err) {
+		return fmt.Errorf("lock %s was taken over by someone else", l.name)
+	} else if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *Storage) document(name string, data []byte) *document {
+	return &document{
+		meta: metav1.ObjectMeta{
+			Name:        s.ObjectName(name),
+			Namespace:   s.config.Namespace,
+			Labels:      map[string]string{StorageLabel: s.config.Name},
+			Annotations: map[string]string{DocumentAnnotation: name},
+		},
+		data: data,
+	}
+}
+
+func (s *Storage) remember(name string, version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.versions[name] = version
+}
+
+func (s *Storage) version(name string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.versions[name]
+	return v, ok
+}
+
+// listMetadata lists objects of configured Kind using metadata API, which leaves document content out of response.
+func (s *Storage) listMetadata(c context.Context, options metav1.ListOptions) ([]metav1.ObjectMeta, error) {
+	resource := corev1.SchemeGroupVersion.WithResource("secrets")
+	if s.config.Kind == ConfigMap {
+		resource = corev1.SchemeGroupVersion.WithResource("configmaps")
+	}
+	result := make([]metav1.ObjectMeta, 0)
+	for {
+		l, err := s.config.Metadata.Resource(resource).Namespace(s.config.Namespace).List(c, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range l.Items {
+			result = append(result, o.ObjectMeta)
+		}
+		if l.Continue == "" {
+			return result, nil
+		}
+		options.Continue = l.Continue
+	}
+}
+
+// ctx returns context of single operation.
+func (s *Storage) ctx() (context.Context, context.CancelFunc) {
+	if s.config.Timeout > 0 {
+		return context.WithTimeout(s.config.Context, s.config.Timeout)
+	}
+	return context.WithCancel(s.config.Context)
+}
+
+func notExist(op, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
@@ -0,0 +1,378 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	azks "github.com/epiphany-platform/e-structures/azks/v0"
+	"github.com/epiphany-platform/e-structures/storage"
+	"github.com/epiphany-platform/e-structures/utils/to"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newClientset returns fake clientset which (unlike plain one) assigns resourceVersions to objects and rejects
+// updates and deletions with outdated resourceVersion the way API server does.
+func newClientset() *fake.Clientset {
+	c := fake.NewSimpleClientset()
+	version := 0
+	next := func(obj runtime.Object) (runtime.Object, error) {
+		obj = obj.DeepCopyObject()
+		m, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+		version++
+		m.SetResourceVersion(strconv.Itoa(version))
+		return obj, nil
+	}
+	current := func(action k8stesting.Action, name string) (string, error) {
+		obj, err := c.Tracker().Get(action.GetResource(), action.GetNamespace(), name)
+		if err != nil {
+			return "", err
+		}
+		m, err := meta.Accessor(obj)
+		if err != nil {
+			return "", err
+		}
+		return m.GetResourceVersion(), nil
+	}
+	conflict := func(action k8stesting.Action, name string) error {
+		return apierrors.NewConflict(action.GetResource().GroupResource(), name, errors.New("the object has been modified"))
+	}
+	for _, resource := range []string{"secrets", "configmaps"} {
+		c.PrependReactor("create", resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+			obj, err := next(action.(k8stesting.CreateAction).GetObject())
+			if err != nil {
+				return true, nil, err
+			}
+			return true, obj, c.Tracker().Create(action.GetResource(), obj, action.GetNamespace())
+		})
+		c.PrependReactor("update", resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+			obj := action.(k8stesting.UpdateAction).GetObject()
+			m, err := meta.Accessor(obj)
+			if err != nil {
+				return true, nil, err
+			}
+			v, err := current(action, m.GetName())
+			if err != nil {
+				return true, nil, err
+			}
+			if m.GetResourceVersion() != "" && m.GetResourceVersion() != v {
+				return true, nil, conflict(action, m.GetName())
+			}
+			obj, err = next(obj)
+			if err != nil {
+				return true, nil, err
+			}
+			return true, obj, c.Tracker().Update(action.GetResource(), obj, action.GetNamespace())
+		})
+		c.PrependReactor("delete", resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+			d := action.(k8stesting.DeleteAction)
+			p := d.GetDeleteOptions().Preconditions
+			if p == nil || p.ResourceVersion == nil {
+				return false, nil, nil
+			}
+			v, err := current(action, d.GetName())
+			if err != nil {
+				return true, nil, err
+			}
+			if *p.ResourceVersion != v {
+				return true, nil, conflict(action, d.GetName())
+			}
+			return false, nil, nil
+		})
+	}
+	return c
+}
+
+// newMetadataClient returns fake metadata client serving lists of objects kept in clientset c. Objects are
+// stripped to metadata the way API server does it for PartialObjectMetadataList requests.
+func newMetadataClient(c *fake.Clientset) *metadatafake.FakeMetadataClient {
+	m := metadatafake.NewSimpleMetadataClient(metadatafake.NewTestScheme())
+	m.PrependReactor("list", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		resource := action.GetResource()
+		kind := map[string]string{"secrets": "Secret", "configmaps": "ConfigMap"}[resource.Resource]
+		obj, err := c.Tracker().List(resource, schema.GroupVersionKind{Version: "v1", Kind: kind}, action.GetNamespace())
+		if err != nil {
+			return true, nil, err
+		}
+		objects, err := meta.ExtractList(obj)
+		if err != nil {
+			return true, nil, err
+		}
+		result := &metav1.List{}
+		for _, o := range objects {
+			m, err := meta.Accessor(o)
+			if err != nil {
+				return true, nil, err
+			}
+			item := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{
+				Name:            m.GetName(),
+				Namespace:       m.GetNamespace(),
+				ResourceVersion: m.GetResourceVersion(),
+				Labels:          m.GetLabels(),
+				Annotations:     m.GetAnnotations(),
+			}}
+			result.Items = append(result.Items, runtime.RawExtension{Object: item})
+		}
+		return true, result, nil
+	})
+	return m
+}
+
+func TestStorage(t *testing.T) {
+	for _, kind := range []Kind{Secret, ConfigMap} {
+		t.Run(string(kind), func(t *testing.T) {
+			a := assert.New(t)
+			r := require.New(t)
+			s := New(Config{Client: newClientset(), Namespace: "default", Name: "azks", Kind: kind})
+
+			_, err := s.Read("state.json")
+			a.True(os.IsNotExist(err))
+			a.True(os.IsNotExist(s.Remove("state.json")))
+
+			r.NoError(s.Write("state.json", []byte("state")))
+			r.NoError(s.Write("state.json", []byte("new state")))
+			b, err := s.Read("state.json")
+			r.NoError(err)
+			a.Equal("new state", string(b))
+
+			r.NoError(s.Create("backup/1/state.json", []byte("state")))
+			a.Equal(os.ErrExist, s.Create("backup/1/state.json", []byte("other state")))
+			r.NoError(s.Create("backup/2/state.json", []byte("state")))
+
+			names, err := s.List("backup/")
+			r.NoError(err)
+			a.Equal([]string{"backup/1/state.json", "backup/2/state.json"}, names)
+			names, err = s.List("")
+			r.NoError(err)
+			a.Equal([]string{"backup/1/state.json", "backup/2/state.json", "state.json"}, names)
+
+			r.NoError(s.Remove("backup/1/state.json"))
+			names, err = s.List("backup/")
+			r.NoError(err)
+			a.Equal([]string{"backup/2/state.json"}, names)
+		})
+	}
+}
+
+func TestStorage_Objects(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	c := newClientset()
+	r.NoError(New(Config{Client: c, Namespace: "default", Name: "azks"}).Write("state.json", []byte("state")))
+	r.NoError(New(Config{Client: c, Namespace: "default", Name: "azks", Kind: ConfigMap}).Write("config.json", []byte("config")))
+	// documents of other storage are not listed
+	r.NoError(New(Config{Client: c, Namespace: "default", Name: "azbi"}).Write("state.json", []byte("other state")))
+
+	s := New(Config{Client: c, Namespace: "default", Name: "azks"})
+	secret, err := c.CoreV1().Secrets("default").Get(context.Background(), s.ObjectName("state.json"), metav1.GetOptions{})
+	r.NoError(err)
+	a.Equal(corev1.SecretTypeOpaque, secret.Type)
+	a.Equal("state", string(secret.Data[DocumentKey]))
+	a.Equal("state.json", secret.Annotations[DocumentAnnotation])
+	a.Equal("azks", secret.Labels[StorageLabel])
+	configMap, err := c.CoreV1().ConfigMaps("default").Get(context.Background(), s.ObjectName("config.json"), metav1.GetOptions{})
+	r.NoError(err)
+	a.Equal("config", configMap.Data[DocumentKey])
+
+	names, err := s.List("")
+	r.NoError(err)
+	a.Equal([]string{"state.json"}, names)
+}
+
+func TestStorage_Conflict(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	c := newClientset()
+	first := New(Config{Client: c, Namespace: "default", Name: "azks"})
+	second := New(Config{Client: c, Namespace: "default", Name: "azks"})
+
+	// both create document not knowing about each other
+	_, err := first.Read("state.json")
+	r.True(os.IsNotExist(err))
+	_, err = second.Read("state.json")
+	r.True(os.IsNotExist(err))
+	r.NoError(first.Write("state.json", []byte("first")))
+	a.True(errors.Is(second.Write("state.json", []byte("second")), storage.ErrConflict))
+
+	// both update the same version
+	_, err = second.Read("state.json")
+	r.NoError(err)
+	r.NoError(first.Write("state.json", []byte("first again")))
+	a.True(errors.Is(second.Write("state.json", []byte("second")), storage.ErrConflict))
+
+	b, err := New(Config{Client: c, Namespace: "default", Name: "azks"}).Read("state.json")
+	r.NoError(err)
+	a.Equal("first again", string(b))
+}
+
+func TestStorage_WriteVersion(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	s := New(Config{Client: newClientset(), Namespace: "default", Name: "azks"})
+
+	r.NoError(s.WriteVersion("state.json", []byte("1"), ""))
+	a.True(errors.Is(s.WriteVersion("state.json", []byte("other 1"), ""), storage.ErrConflict))
+
+	b, version, err := s.ReadVersion("state.json")
+	r.NoError(err)
+	a.Equal("1", string(b))
+	// write is checked against passed version, not the one remembered by the latest read
+	_, _, err = s.ReadVersion("state.json")
+	r.NoError(err)
+	r.NoError(s.WriteVersion("state.json", []byte("2"), version))
+	a.True(errors.Is(s.WriteVersion("state.json", []byte("other 2"), version), storage.ErrConflict))
+
+	b, err = s.Read("state.json")
+	r.NoError(err)
+	a.Equal("2", string(b))
+}
+
+func TestStorage_Lock(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	c := newClientset()
+	s := New(Config{Client: c, Namespace: "default", Name: "azks", LockTTL: 300 * time.Millisecond})
+
+	crashed, err := s.Lock(".lock", 0)
+	r.NoError(err)
+	a.Nil(crashed.StaleOwner())
+	_, err = s.Lock(".lock", 0)
+	var lerr storage.LockedError
+	r.True(errors.As(err, &lerr))
+	r.NotNil(lerr.Owner)
+	a.Equal(os.Getpid(), lerr.Owner.PID)
+
+	l, err := s.Lock(".lock", time.Second)
+	r.NoError(err)
+	a.NotNil(l.StaleOwner())
+	a.Error(crashed.Release())
+	r.NoError(l.Release())
+	r.NoError(l.Release())
+	_, err = s.Read(".lock")
+	a.True(os.IsNotExist(err))
+}
+
+func TestStorage_KubeConfig(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	s := New(Config{Client: newClientset(), Namespace: "default", Name: "azks"})
+
+	state := &azks.State{}
+	state.Init("v0.0.1")
+	state.Status = "applied"
+	state.Output = &azks.Output{KubeConfig: to.StrPtr("apiVersion: v1\nkind: Config\n")}
+	r.NoError(state.SaveTo(s, "state.json"))
+
+	loaded := &azks.State{}
+	r.NoError(loaded.LoadFrom(s, "state.json"))
+	r.NotNil(loaded.Output)
+	a.Equal("apiVersion: v1\nkind: Config\n", *loaded.Output.KubeConfig)
+}
+
+func TestStorage_ListMetadata(t *testing.T) {
+	for _, kind := range []Kind{Secret, ConfigMap} {
+		t.Run(string(kind), func(t *testing.T) {
+			a := assert.New(t)
+			r := require.New(t)
+			c := newClientset()
+			m := newMetadataClient(c)
+			s := New(Config{Client: c, Metadata: m, Namespace: "default", Name: "azks", Kind: kind})
+			r.NoError(s.Write("state.json", []byte("state")))
+			r.NoError(s.Create("backup/1/state.json", []byte("state")))
+			r.NoError(New(Config{Client: c, Namespace: "default", Name: "azbi", Kind: kind}).Write("state.json", []byte("other state")))
+			c.ClearActions()
+
+			names, err := s.List("")
+			r.NoError(err)
+			a.Equal([]string{"backup/1/state.json", "state.json"}, names)
+			names, err = s.List("backup/")
+			r.NoError(err)
+			a.Equal([]string{"backup/1/state.json"}, names)
+			// whole objects are never listed
+			a.Empty(c.Actions())
+			r.Len(m.Actions(), 2)
+			a.Equal(StorageLabel+"=azks", m.Actions()[0].(k8stesting.ListAction).GetListRestrictions().Labels.String())
+		})
+	}
+}
+
+func TestStorage_Context(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+
+	// fake clientset ignores contexts, so contexts calls are made with are checked directly
+	s := New(Config{Client: newClientset(), Namespace: "default", Name: "azks"})
+	c, cancel := s.ctx()
+	_, ok := c.Deadline()
+	a.False(ok)
+	cancel()
+
+	s = New(Config{Client: newClientset(), Namespace: "default", Name: "azks", Timeout: time.Minute})
+	c, cancel = s.ctx()
+	deadline, ok := c.Deadline()
+	r.True(ok)
+	a.WithinDuration(time.Now().Add(time.Minute), deadline, time.Second)
+	cancel()
+
+	parent, cancelParent := context.WithCancel(context.Background())
+	s = New(Config{Client: newClientset(), Namespace: "default", Name: "azks", Context: parent, Timeout: time.Minute})
+	c, cancel = s.ctx()
+	defer cancel()
+	cancelParent()
+	<-c.Done()
+	a.Equal(context.Canceled, c.Err())
+}
+
+func TestStorage_ConcurrentCreate(t *testing.T) {
+	a := assert.New(t)
+	r := require.New(t)
+	c := newClientset()
+	const writers = 20
+	errs := make([]error, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = New(Config{Client: c, Namespace: "default", Name: "azks"}).Create("backup/1/state.json", []byte(strconv.Itoa(i)))
+		}(i)
+	}
+	wg.Wait()
+	winner := -1
+	for i, err := range errs {
+		if err == nil {
+			a.Equal(-1, winner, "document created by writers %d and %d", winner, i)
+			winner = i
+		} else {
+			a.Equal(os.ErrExist, err)
+		}
+	}
+	r.NotEqual(-1, winner, "document not created")
+	b, err := New(Config{Client: c, Namespace: "default", Name: "azks"}).Read("backup/1/state.json")
+	r.NoError(err)
+	a.Equal(strconv.Itoa(winner), string(b))
+}
+
+func TestStorage_RequiresRetention(t *testing.T) {
+	var s storage.Storage = New(Config{Client: newClientset(), Namespace: "default", Name: "azks"})
+	b, ok := s.(storage.Bounded)
+	require.True(t, ok)
+	assert.True(t, b.RequiresRetention())
+}
@@ -0,0 +1,150 @@
+package kube
+
+import (
+	"context"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"unicode/utf8"
+)
+
+// document is content of single object regardless of its kind.
+type document struct {
+	meta metav1.ObjectMeta
+	data []byte
+}
+
+// objects hides differences between Secrets and ConfigMaps APIs.
+type objects interface {
+	get(ctx context.Context, name string) (*document, error)
+	create(ctx context.Context, d *document) (*document, error)
+	update(ctx context.Context, d *document) (*document, error)
+	// delete removes object. Deletion is conditional if version is not empty.
+	delete(ctx context.Context, name string, version string) error
+	list(ctx context.Context, options metav1.ListOptions) ([]metav1.ObjectMeta, error)
+}
+
+func deleteOptions(version string) metav1.DeleteOptions {
+	if version == "" {
+		return metav1.DeleteOptions{}
+	}
+	return metav1.DeleteOptions{Preconditions: &metav1.Preconditions{ResourceVersion: &version}}
+}
+
+type secrets struct {
+	client typedcorev1.SecretInterface
+}
+
+func (s secrets) get(ctx context.Context, name string) (*document, error) {
+	o, err := s.client.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return fromSecret(o), nil
+}
+
+func (s secrets) create(ctx context.Context, d *document) (*document, error) {
+	o, err := s.client.Create(ctx, toSecret(d), metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return fromSecret(o), nil
+}
+
+func (s secrets) update(ctx context.Context, d *document) (*document, error) {
+	o, err := s.client.Update(ctx, toSecret(d), metav1.UpdateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return fromSecret(o), nil
+}
+
+func (s secrets) delete(ctx context.Context, name string, version string) error {
+	return s.client.Delete(ctx, name, deleteOptions(version))
+}
+
+func (s secrets) list(ctx context.Context, options metav1.ListOptions) ([]metav1.ObjectMeta, error) {
+	l, err := s.client.List(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]metav1.ObjectMeta, 0, len(l.Items))
+	for _, o := range l.Items {
+		result = append(result, o.ObjectMeta)
+	}
+	return result, nil
+}
+
+func toSecret(d *document) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: d.meta,
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{DocumentKey: d.data},
+	}
+}
+
+func fromSecret(o *corev1.Secret) *document {
+	return &document{meta: o.ObjectMeta, data: o.Data[DocumentKey]}
+}
+
+type configMaps struct {
+	client typedcorev1.ConfigMapInterface
+}
+
+func (c configMaps) get(ctx context.Context, name string) (*document, error) {
+	o, err := c.client.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return fromConfigMap(o), nil
+}
+
+func (c configMaps) create(ctx context.Context, d *document) (*document, error) {
+	o, err := c.client.Create(ctx, toConfigMap(d), metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return fromConfigMap(o), nil
+}
+
+func (c configMaps) update(ctx context.Context, d *document) (*document, error) {
+	o, err := c.client.Update(ctx, toConfigMap(d), metav1.UpdateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return fromConfigMap(o), nil
+}
+
+func (c configMaps) delete(ctx context.Context, name string, version string) error {
+	return c.client.Delete(ctx, name, deleteOptions(version))
+}
+
+func (c configMaps) list(ctx context.Context, options metav1.ListOptions) ([]metav1.ObjectMeta, error) {
+	l, err := c.client.List(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]metav1.ObjectMeta, 0, len(l.Items))
+	for _, o := range l.Items {
+		result = append(result, o.ObjectMeta)
+	}
+	return result, nil
+}
+
+// toConfigMap keeps text documents in Data so they stay readable with kubectl, BinaryData is used otherwise.
+func toConfigMap(d *document) *corev1.ConfigMap {
+	o := &corev1.ConfigMap{ObjectMeta: d.meta}
+	if utf8.Valid(d.data) {
+		o.Data = map[string]string{DocumentKey: string(d.data)}
+	} else {
+		o.BinaryData = map[string][]byte{DocumentKey: d.data}
+	}
+	return o
+}
+
+func fromConfigMap(o *corev1.ConfigMap) *document {
+	if s, ok := o.Data[DocumentKey]; ok {
+		return &document{meta: o.ObjectMeta, data: []byte(s)}
+	}
+	return &document{meta: o.ObjectMeta, data: o.BinaryData[DocumentKey]}
+}
@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Local is Storage keeping documents as files in local directory.
+type Local struct {
+	root string
+}
+
+// NewLocal creates Storage keeping documents in directory pointed by root. Directory is created when first
+// document is written.
+func NewLocal(root string) *Local {
+	return &Local{root: root}
+}
+
+// Root returns path of directory documents are kept in.
+func (l *Local) Root() string {
+	return l.root
+}
+
+func (l *Local) path(name string) string {
+	return filepath.Join(l.root, filepath.FromSlash(name))
+}
+
+func (l *Local) Read(name string) ([]byte, error) {
+	return ioutil.ReadFile(l.path(name))
+}
+
+func (l *Local) Write(name string, data []byte) error {
+	p := l.path(name)
+	err := os.MkdirAll(filepath.Dir(p), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return WriteFile(p, data, 0644)
+}
+
+func (l *Local) Create(name string, data []byte) error {
+	p := l.path(name)
+	err := os.MkdirAll(filepath.Dir(p), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return WriteNewFile(p, data, 0644)
+}
+
+// Remove deletes document and all directories left empty by that.
+func (l *Local) Remove(name string) error {
+	p := l.path(name)
+	err := os.Remove(p)
+	if err != nil {
+		return err
+	}
+	root := filepath.Clean(l.root)
+	for d := filepath.Dir(p); d != root && strings.HasPrefix(d, root); d = filepath.Dir(d) {
+		if os.Remove(d) != nil {
+			// not empty
+			break
+		}
+	}
+	return nil
+}
+
+func (l *Local) List(prefix string) ([]string, error) {
+	result := make([]string, 0)
+	err := filepath.Walk(l.root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == l.root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if strings.HasPrefix(name, prefix) {
+			result = append(result, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func (l *Local) Lock(name string, timeout time.Duration) (Lock, error) {
+	p := l.path(name)
+	err := os.MkdirAll(filepath.Dir(p), os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	return WaitLock(timeout, func() (Lock, error) {
+		fl, err := tryLock(p)
+		if err != nil {
+			return nil, err
+		}
+		err = fl.writeOwner()
+		if err != nil {
+			_ = fl.Release()
+			return nil, err
+		}
+		return fl, nil
+	}, func() *LockOwner {
+		owner, _ := readOwner(p)
+		return owner
+	})
+}
+
+// fileLock is exclusive lock of file held by this process.
+type fileLock struct {
+	path string
+	file *os.File
+	// stale is owner of previous lock which was not released properly, if any.
+	stale *LockOwner
+}
+
+func (fl *fileLock) StaleOwner() *LockOwner {
+	return fl.stale
+}
+
+func (fl *fileLock) Release() error {
+	if fl.file == nil {
+		return nil
+	}
+	err := fl.release()
+	fl.file = nil
+	return err
+}
+
+func (fl *fileLock) writeOwner() error {
+	owner, err := CurrentOwner()
+	if err != nil {
+		return err
+	}
+	bytes, err := json.Marshal(owner)
+	if err != nil {
+		return err
+	}
+	err = fl.file.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = fl.file.WriteAt(bytes, 0)
+	if err != nil {
+		return err
+	}
+	return fl.file.Sync()
+}
+
+// readOwner returns owner recorded in lock file or nil if there is none.
+func readOwner(path string) (*LockOwner, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, nil
+	}
+	var o LockOwner
+	err = json.Unmarshal(b, &o)
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// WriteFile writes data into file pointed by path in crash safe manner: data is written and synced to temporary
+// file in the same directory which is then renamed over path. Reader never sees partially written file. Mode of
+// already existing file is preserved, perm is used for new files.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	mode := perm
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	tmp, err := writeTemp(path, data, mode)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return SyncDir(filepath.Dir(path))
+}
+
+// WriteNewFile works like WriteFile but fails with os.ErrExist if there is file already in place pointed by path.
+// Temporary file is hard linked to path instead of renamed over it, as link (unlike rename) fails if path exists,
+// so only one of concurrent writers succeeds. File systems without hard links get file created exclusively in place
+// instead, so readers may see it before it is completely written.
+func WriteNewFile(path string, data []byte, perm os.FileMode) error {
+	tmp, err := writeTemp(path, data, perm)
+	if err != nil {
+		return err
+	}
+	err = link(tmp, path)
+	if err2 := os.Remove(tmp); err == nil {
+		err = err2
+	}
+	if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EOPNOTSUPP) {
+		err = createFile(path, data, perm)
+	}
+	if os.IsExist(err) {
+		return os.ErrExist
+	} else if err != nil {
+		return err
+	}
+	return SyncDir(filepath.Dir(path))
+}
+
+// link is replaced in tests to simulate file systems without hard links.
+var link = os.Link
+
+// createFile writes data into new file pointed by path. It fails if file already exists.
+func createFile(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		_ = os.Remove(path)
+	}
+	return err
+}
+
+// SyncDir flushes directory entry changes (i.e. renames) of directory pointed by path to disk.
+func SyncDir(path string) error {
+	d, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if err2 := d.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+func writeTemp(path string, data []byte, mode os.FileMode) (string, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
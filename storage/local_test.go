@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing os.FileMode
+		want     os.FileMode
+	}{
+		{
+			name:     "new file gets provided mode",
+			existing: 0,
+			want:     0644,
+		},
+		{
+			name:     "mode of existing file is preserved",
+			existing: 0600,
+			want:     0600,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			r := require.New(t)
+			d := t.TempDir()
+			p := filepath.Join(d, "file.json")
+			if tt.existing != 0 {
+				r.NoError(ioutil.WriteFile(p, []byte("old content"), tt.existing))
+				r.NoError(os.Chmod(p, tt.existing))
+			}
+			r.NoError(WriteFile(p, []byte("new content"), 0644))
+			b, err := ioutil.ReadFile(p)
+			r.NoError(err)
+			a.Equal("new content", string(b))
+			fi, err := os.Stat(p)
+			r.NoError(err)
+			a.Equal(tt.want, fi.Mode().Perm())
+			entries, err := ioutil.ReadDir(d)
+			r.NoError(err)
+			a.Len(entries, 1)
+		})
+	}
+}
+
+func TestWriteNewFile(t *testing.T) {
+	a := assert.New(t)
+	p := filepath.Join(t.TempDir(), "file.json")
+	a.NoError(WriteNewFile(p, []byte("content"), 0644))
+	a.Equal(os.ErrExist, WriteNewFile(p, []byte("other content"), 0644))
+	b, err := ioutil.ReadFile(p)
+	a.NoError(err)
+	a.Equal("content", string(b))
+}
+
+func TestWriteNewFile_WithoutLinks(t *testing.T) {
+	a := assert.New(t)
+	t.Cleanup(func() { link = os.Link })
+	link = func(oldname, newname string) error {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.ENOTSUP}
+	}
+	d := t.TempDir()
+	p := filepath.Join(d, "file.json")
+	a.NoError(WriteNewFile(p, []byte("content"), 0644))
+	a.Equal(os.ErrExist, WriteNewFile(p, []byte("other content"), 0644))
+	b, err := ioutil.ReadFile(p)
+	a.NoError(err)
+	a.Equal("content", string(b))
+	entries, err := ioutil.ReadDir(d)
+	a.NoError(err)
+	a.Len(entries, 1)
+}
+
+func TestWriteNewFile_Concurrent(t *testing.T) {
+	a := assert.New(t)
+	d := t.TempDir()
+	p := filepath.Join(d, "file.json")
+	const writers = 20
+	errs := make(chan error, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- WriteNewFile(p, []byte(strconv.Itoa(i)), 0644)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+		} else {
+			a.Equal(os.ErrExist, err)
+		}
+	}
+	a.Equal(1, succeeded)
+	entries, err := ioutil.ReadDir(d)
+	a.NoError(err)
+	a.Len(entries, 1)
+}
@@ -0,0 +1,40 @@
+//go:build !windows
+
+package storage
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// tryLock takes flock of file pointed by path without waiting. Lock is released by kernel if process dies, so
+// owner found in file after lock was taken belongs to process which didn't release lock properly.
+func tryLock(path string) (*fileLock, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		_ = f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrLockBusy
+		}
+		return nil, err
+	}
+	stale, _ := readOwner(path)
+	return &fileLock{path: path, file: f, stale: stale}, nil
+}
+
+func (fl *fileLock) release() error {
+	// owner is cleared so next holder doesn't consider this lock stale
+	err := fl.file.Truncate(0)
+	if err2 := syscall.Flock(int(fl.file.Fd()), syscall.LOCK_UN); err == nil {
+		err = err2
+	}
+	if err2 := fl.file.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
@@ -0,0 +1,58 @@
+//go:build windows
+
+package storage
+
+import (
+	"os"
+)
+
+// tryLock creates lock file pointed by path without waiting. There is no flock on this platform, so lock file
+// left by process which is no longer running on this host is considered stale and removed.
+func tryLock(path string) (*fileLock, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	if err == nil {
+		return &fileLock{path: path, file: f}, nil
+	}
+	if !os.IsExist(err) {
+		return nil, err
+	}
+	owner, err := readOwner(path)
+	if err != nil || owner == nil || !isStale(owner) {
+		// owner might not be written yet
+		return nil, ErrLockBusy
+	}
+	err = os.Remove(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	if os.IsExist(err) {
+		return nil, ErrLockBusy
+	} else if err != nil {
+		return nil, err
+	}
+	return &fileLock{path: path, file: f, stale: owner}, nil
+}
+
+func (fl *fileLock) release() error {
+	err := fl.file.Close()
+	if err2 := os.Remove(fl.path); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// isStale checks if owner is process which is known to be gone.
+func isStale(o *LockOwner) bool {
+	host, err := os.Hostname()
+	if err != nil || o.Host != host {
+		// there is no way to check processes on other hosts
+		return false
+	}
+	p, err := os.FindProcess(o.PID)
+	if err != nil {
+		return true
+	}
+	_ = p.Release()
+	return false
+}
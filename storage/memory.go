@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is Storage keeping documents in memory. It is designed to be used in tests and as staging area for
+// documents which have to be prepared before they are written to other Storage.
+type Memory struct {
+	mu        sync.Mutex
+	documents map[string][]byte
+	// versions count writes of every document, so Memory implements Versioned.
+	versions map[string]int
+	locks    map[string]*LockOwner
+}
+
+// NewMemory creates empty in-memory Storage.
+func NewMemory() *Memory {
+	return &Memory{
+		documents: make(map[string][]byte),
+		versions:  make(map[string]int),
+		locks:     make(map[string]*LockOwner),
+	}
+}
+
+func (m *Memory) Read(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.documents[name]
+	if !ok {
+		return nil, notExist("read", name)
+	}
+	return append([]byte(nil), b...), nil
+}
+
+func (m *Memory) ReadVersion(name string) ([]byte, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.documents[name]
+	if !ok {
+		return nil, "", notExist("read", name)
+	}
+	return append([]byte(nil), b...), strconv.Itoa(m.versions[name]), nil
+}
+
+func (m *Memory) Write(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.write(name, data)
+	return nil
+}
+
+func (m *Memory) WriteVersion(name string, data []byte, version string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current := ""
+	if _, ok := m.documents[name]; ok {
+		current = strconv.Itoa(m.versions[name])
+	}
+	if version != current {
+		return fmt.Errorf("%s: %w", name, ErrConflict)
+	}
+	m.write(name, data)
+	return nil
+}
+
+func (m *Memory) Create(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.documents[name]; ok {
+		return os.ErrExist
+	}
+	m.write(name, data)
+	return nil
+}
+
+func (m *Memory) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.documents[name]; !ok {
+		return notExist("remove", name)
+	}
+	delete(m.documents, name)
+	return nil
+}
+
+// write stores document and bumps its version. Versions are not reset when document is removed, so document
+// created again is not mistaken for the one read before removal.
+func (m *Memory) write(name string, data []byte) {
+	m.documents[name] = append([]byte(nil), data...)
+	m.versions[name]++
+}
+
+func (m *Memory) List(prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make([]string, 0)
+	for name := range m.documents {
+		if strings.HasPrefix(name, prefix) {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func (m *Memory) Lock(name string, timeout time.Duration) (Lock, error) {
+	return WaitLock(timeout, func() (Lock, error) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if _, ok := m.locks[name]; ok {
+			return nil, ErrLockBusy
+		}
+		owner, err := CurrentOwner()
+		if err != nil {
+			return nil, err
+		}
+		m.locks[name] = &owner
+		return &memoryLock{memory: m, name: name}, nil
+	}, func() *LockOwner {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return m.locks[name]
+	})
+}
+
+type memoryLock struct {
+	memory   *Memory
+	name     string
+	released bool
+}
+
+func (l *memoryLock) Release() error {
+	l.memory.mu.Lock()
+	defer l.memory.mu.Unlock()
+	if !l.released {
+		delete(l.memory.locks, l.name)
+		l.released = true
+	}
+	return nil
+}
+
+// StaleOwner always returns nil as in-memory locks cannot outlive their holders.
+func (l *memoryLock) StaleOwner() *LockOwner {
+	return nil
+}
@@ -0,0 +1,334 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// S3Config holds connection details of S3 compatible bucket.
+type S3Config struct {
+	// Endpoint is base URL of S3 service, i.e. "https://s3.eu-central-1.amazonaws.com" or "http://localhost:9000".
+	// Buckets are addressed path-style so any S3 compatible service (i.e. MinIO) can be used.
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Prefix is prepended to every document name, i.e. "modules/azbi/".
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// LockTTL is age after which lock is considered stale and can be taken over. Locks never get stale if zero.
+	LockTTL time.Duration
+	// Client is used to send requests. http.DefaultClient is used if not set.
+	Client *http.Client
+}
+
+// S3 is Storage keeping documents as objects in S3 compatible bucket. Create, WriteVersion, Remove and Lock rely on
+// conditional requests (If-None-Match and If-Match headers) so service has to support them.
+type S3 struct {
+	config S3Config
+}
+
+// NewS3 creates Storage keeping documents in bucket described by config.
+func NewS3(config S3Config) *S3 {
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	return &S3{config: config}
+}
+
+// S3Error is returned when S3 service responds with unexpected status.
+type S3Error struct {
+	Op         string
+	Name       string
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e S3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3 %s %s: unexpected status %d", e.Op, e.Name, e.StatusCode)
+	}
+	return fmt.Sprintf("s3 %s %s: %s: %s", e.Op, e.Name, e.Code, e.Message)
+}
+
+func (s *S3) Read(name string) ([]byte, error) {
+	b, _, err := s.get(name)
+	return b, err
+}
+
+func (s *S3) ReadVersion(name string) ([]byte, string, error) {
+	return s.get(name)
+}
+
+func (s *S3) Write(name string, data []byte) error {
+	_, err := s.put(name, data, nil)
+	return err
+}
+
+// WriteVersion replaces object only if its ETag is still version using conditional write.
+func (s *S3) WriteVersion(name string, data []byte, version string) error {
+	header := http.Header{"If-Match": {version}}
+	if version == "" {
+		header = http.Header{"If-None-Match": {"*"}}
+	}
+	_, err := s.put(name, data, header)
+	if isPreconditionFailed(err) {
+		return fmt.Errorf("%s: %w", name, ErrConflict)
+	}
+	return err
+}
+
+func (s *S3) Create(name string, data []byte) error {
+	_, err := s.put(name, data, http.Header{"If-None-Match": {"*"}})
+	if isPreconditionFailed(err) {
+		return os.ErrExist
+	}
+	return err
+}
+
+func (s *S3) Remove(name string) error {
+	// DELETE succeeds for missing objects as well, so existence has to be checked first and object is deleted only
+	// if it is still the one found by that check
+	resp, err := s.do(http.MethodHead, name, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return notExist("remove", name)
+	case resp.StatusCode != http.StatusOK:
+		return S3Error{Op: "remove", Name: name, StatusCode: resp.StatusCode}
+	}
+	err = s.delete(name, http.Header{"If-Match": {resp.Header.Get("ETag")}})
+	if isPreconditionFailed(err) {
+		if _, _, err := s.get(name); os.IsNotExist(err) {
+			return notExist("remove", name)
+		}
+		return fmt.Errorf("%s: %w", name, ErrConflict)
+	}
+	return err
+}
+
+func (s *S3) List(prefix string) ([]string, error) {
+	result := make([]string, 0)
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.config.Prefix + prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		body, err := readBody(resp, "list", prefix)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.Unmarshal(body, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range page.Contents {
+			result = append(result, strings.TrimPrefix(c.Key, s.config.Prefix))
+		}
+		if !page.IsTruncated {
+			break
+		}
+		token = page.NextContinuationToken
+	}
+	// keys are returned in UTF-8 binary order which is the same as sort.Strings order
+	return result, nil
+}
+
+// Lock creates lock object with conditional write so only one holder can succeed. Lock object older than
+// LockTTL is taken over (again with conditional write) and its owner is reported as stale.
+func (s *S3) Lock(name string, timeout time.Duration) (Lock, error) {
+	return WaitLock(timeout, func() (Lock, error) {
+		owner, err := CurrentOwner()
+		if err != nil {
+			return nil, err
+		}
+		b, err := json.Marshal(owner)
+		if err != nil {
+			return nil, err
+		}
+		etag, err := s.put(name, b, http.Header{"If-None-Match": {"*"}})
+		if err == nil {
+			return &s3Lock{storage: s, name: name, etag: etag}, nil
+		}
+		if !isPreconditionFailed(err) {
+			return nil, err
+		}
+
+		current, currentETag, err := s.lockOwner(name)
+		if os.IsNotExist(err) {
+			// released in the meantime
+			return nil, ErrLockBusy
+		} else if err != nil {
+			return nil, err
+		}
+		if s.config.LockTTL <= 0 || current == nil || time.Since(current.CreatedAt) < s.config.LockTTL {
+			return nil, ErrLockBusy
+		}
+		etag, err = s.put(name, b, http.Header{"If-Match": {currentETag}})
+		if isPreconditionFailed(err) {
+			// someone else took it over first
+			return nil, ErrLockBusy
+		} else if err != nil {
+			return nil, err
+		}
+		return &s3Lock{storage: s, name: name, etag: etag, stale: current}, nil
+	}, func() *LockOwner {
+		owner, _, _ := s.lockOwner(name)
+		return owner
+	})
+}
+
+func (s *S3) lockOwner(name string) (*LockOwner, string, error) {
+	b, etag, err := s.get(name)
+	if err != nil {
+		return nil, "", err
+	}
+	var o LockOwner
+	err = json.Unmarshal(b, &o)
+	if err != nil {
+		return nil, "", err
+	}
+	return &o, etag, nil
+}
+
+type s3Lock struct {
+	storage *S3
+	name    string
+	etag    string
+	stale   *LockOwner
+}
+
+func (l *s3Lock) StaleOwner() *LockOwner {
+	return l.stale
+}
+
+// Release deletes lock object unless it was taken over by someone else in the meantime.
+func (l *s3Lock) Release() error {
+	if l.etag == "" {
+		return nil
+	}
+	err := l.storage.delete(l.name, http.Header{"If-Match": {l.etag}})
+	l.etag = ""
+	if isPreconditionFailed(err) {
+		return fmt.Errorf("lock %s was taken over by someone else", l.name)
+	}
+	return err
+}
+
+func (s *S3) get(name string) ([]byte, string, error) {
+	resp, err := s.do(http.MethodGet, name, nil, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		_ = resp.Body.Close()
+		return nil, "", notExist("read", name)
+	}
+	b, err := readBody(resp, "read", name)
+	if err != nil {
+		return nil, "", err
+	}
+	return b, resp.Header.Get("ETag"), nil
+}
+
+func (s *S3) put(name string, data []byte, header http.Header) (string, error) {
+	resp, err := s.do(http.MethodPut, name, nil, header, data)
+	if err != nil {
+		return "", err
+	}
+	_, err = readBody(resp, "write", name)
+	if err != nil {
+		return "", err
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+func (s *S3) delete(name string, header http.Header) error {
+	resp, err := s.do(http.MethodDelete, name, nil, header, nil)
+	if err != nil {
+		return err
+	}
+	_, err = readBody(resp, "remove", name)
+	return err
+}
+
+func (s *S3) do(method string, name string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u, err := url.Parse(s.config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.config.Bucket + "/"
+	if name != "" {
+		u.Path += s.config.Prefix + name
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	signV4(req, body, s.config.AccessKeyID, s.config.SecretAccessKey, s.config.SessionToken, s.config.Region, time.Now())
+	return s.config.Client.Do(req)
+}
+
+// maxBodySize limits size of response bodies read into memory. Module documents are much smaller.
+var maxBodySize int64 = 64 << 20
+
+// readBody reads and closes response body returning S3Error if response status is not successful. Bodies larger
+// than maxBodySize are not read.
+func readBody(resp *http.Response, op string, name string) ([]byte, error) {
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > maxBodySize {
+		return nil, fmt.Errorf("%s %s: response is larger than %d bytes", op, name, maxBodySize)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return b, nil
+	}
+	e := S3Error{}
+	_ = xml.Unmarshal(b, &e)
+	e.Op = op
+	e.Name = name
+	e.StatusCode = resp.StatusCode
+	return nil, e
+}
+
+// isPreconditionFailed checks if err is caused by failed conditional write. Concurrent conditional writes to the
+// same object may also be rejected with 409 Conflict.
+func isPreconditionFailed(err error) bool {
+	e, ok := err.(S3Error)
+	return ok && (e.StatusCode == http.StatusPreconditionFailed || e.StatusCode == http.StatusConflict)
+}
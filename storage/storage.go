@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Storage is a place where structure documents and their backups are kept. Documents are addressed with slash
+// separated names relative to storage root (i.e. "config.json" or "backup/20210101-000000.000000/state.json").
+type Storage interface {
+
+	// Read returns content of document. Error satisfying os.IsNotExist is returned if there is no such document.
+	Read(name string) ([]byte, error)
+
+	// Write stores content of document replacing existing one. Readers never see partially written document.
+	// Implementations tracking versions of documents return error wrapping ErrConflict if document was changed by
+	// someone else since it was read.
+	Write(name string, data []byte) error
+
+	// Create works like Write but fails with os.ErrExist if document already exists.
+	Create(name string, data []byte) error
+
+	// Remove deletes document. Error satisfying os.IsNotExist is returned if there is no such document.
+	Remove(name string) error
+
+	// List returns sorted names of all documents which names start with prefix.
+	List(prefix string) ([]string, error)
+
+	// Lock takes exclusive lock identified by name waiting for it at most timeout. LockedError is returned if lock
+	// is held by someone else after timeout.
+	Lock(name string, timeout time.Duration) (Lock, error)
+}
+
+// Lock is exclusive lock taken with Storage.Lock.
+type Lock interface {
+
+	// Release frees lock. It is safe to call it more than once.
+	Release() error
+
+	// StaleOwner returns owner of previous lock if it wasn't released properly (i.e. previous holder crashed).
+	StaleOwner() *LockOwner
+}
+
+// Bounded is implemented by storages which shouldn't keep unlimited number of documents, i.e. because every
+// document is a separate object counted against cluster quota. Backups must not be taken into such storage without
+// retention limit.
+type Bounded interface {
+
+	// RequiresRetention tells if backups kept in storage have to be pruned.
+	RequiresRetention() bool
+}
+
+// Versioned is implemented by storages able to replace document only if it wasn't changed since it was read
+// (compare-and-swap), so of concurrent writers which read the same version of document only one succeeds.
+type Versioned interface {
+
+	// ReadVersion works like Read but also returns version of document content (i.e. ETag or resourceVersion).
+	ReadVersion(name string) ([]byte, string, error)
+
+	// WriteVersion works like Write but replaces document only if it is still in version returned by ReadVersion.
+	// Empty version means document must not exist yet. Error wrapping ErrConflict is returned otherwise.
+	WriteVersion(name string, data []byte, version string) error
+}
+
+// ReadVersion returns content of document together with its version if s is Versioned. Empty version is returned
+// by other storages and for documents which don't exist.
+func ReadVersion(s Storage, name string) ([]byte, string, error) {
+	if v, ok := s.(Versioned); ok {
+		return v.ReadVersion(name)
+	}
+	b, err := s.Read(name)
+	return b, "", err
+}
+
+// WriteVersion replaces document only if it is still in version returned by ReadVersion if s is Versioned. Other
+// storages write document unconditionally, so concurrent writers have to be serialized with Lock.
+func WriteVersion(s Storage, name string, data []byte, version string) error {
+	if v, ok := s.(Versioned); ok {
+		return v.WriteVersion(name, data, version)
+	}
+	return s.Write(name, data)
+}
+
+const lockPollInterval = 50 * time.Millisecond
+
+// ErrLockBusy is returned by lock attempts passed to WaitLock when lock is held by someone else.
+var ErrLockBusy = errors.New("lock is busy")
+
+// ErrConflict is returned by Storage.Write when document was changed by someone else since it was read.
+var ErrConflict = errors.New("document was changed by someone else")
+
+// LockOwner describes process holding lock.
+type LockOwner struct {
+	PID       int       `json:"pid"`
+	Host      string    `json:"host"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LockedError is returned when lock could not be taken before timeout.
+type LockedError struct {
+	Owner *LockOwner
+}
+
+func (e LockedError) Error() string {
+	if e.Owner == nil {
+		return "module directory is locked"
+	}
+	return fmt.Sprintf("module directory is locked by process %d on %s since %s", e.Owner.PID, e.Owner.Host, e.Owner.CreatedAt.Format(time.RFC3339))
+}
+
+// Split returns local storage of directory containing file pointed by path and name of that file in it. It is
+// used to serve path based methods with Storage based implementation.
+func Split(path string) (Storage, string) {
+	return NewLocal(filepath.Dir(path)), filepath.Base(path)
+}
+
+// CurrentOwner describes this process as lock owner. It is meant to be recorded by Storage implementations in
+// lock they hold.
+func CurrentOwner() (LockOwner, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return LockOwner{}, err
+	}
+	return LockOwner{PID: os.Getpid(), Host: host, CreatedAt: time.Now()}, nil
+}
+
+// WaitLock calls try until it succeeds, fails with error other than ErrLockBusy or timeout passes. LockedError
+// with lock owner returned by owner is returned after timeout. It is meant to be used by Storage implementations.
+func WaitLock(timeout time.Duration, try func() (Lock, error), owner func() *LockOwner) (Lock, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		l, err := try()
+		if err == nil {
+			return l, nil
+		}
+		if !errors.Is(err, ErrLockBusy) {
+			return nil, err
+		}
+		if !time.Now().Before(deadline) {
+			return nil, LockedError{Owner: owner()}
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+func notExist(op, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
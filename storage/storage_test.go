@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage func(t *testing.T) Storage
+	}{
+		{
+			name: "local",
+			storage: func(t *testing.T) Storage {
+				return NewLocal(t.TempDir())
+			},
+		},
+		{
+			name: "memory",
+			storage: func(t *testing.T) Storage {
+				return NewMemory()
+			},
+		},
+		{
+			name: "s3",
+			storage: func(t *testing.T) Storage {
+				s, _ := newTestS3(t)
+				return s
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testStorage(t, tt.storage(t))
+		})
+		t.Run(tt.name+" concurrent create", func(t *testing.T) {
+			testConcurrentCreate(t, tt.storage(t))
+		})
+		if v, ok := tt.storage(t).(Versioned); ok {
+			t.Run(tt.name+" versioned", func(t *testing.T) {
+				testVersioned(t, v)
+			})
+		}
+	}
+}
+
+// testStorage checks behaviour every Storage implementation is expected to have.
+func testStorage(t *testing.T, s Storage) {
+	a := assert.New(t)
+	r := require.New(t)
+
+	_, err := s.Read("config.json")
+	a.True(os.IsNotExist(err))
+	a.True(os.IsNotExist(s.Remove("config.json")))
+	names, err := s.List("")
+	r.NoError(err)
+	a.Empty(names)
+
+	r.NoError(s.Write("config.json", []byte("config")))
+	r.NoError(s.Write("config.json", []byte("new config")))
+	b, err := s.Read("config.json")
+	r.NoError(err)
+	a.Equal("new config", string(b))
+
+	r.NoError(s.Create("backup/2/state.json", []byte("state")))
+	a.Equal(os.ErrExist, s.Create("backup/2/state.json", []byte("other state")))
+	r.NoError(s.Create("backup/1/state.json", []byte("state")))
+	b, err = s.Read("backup/2/state.json")
+	r.NoError(err)
+	a.Equal("state", string(b))
+
+	names, err = s.List("backup/")
+	r.NoError(err)
+	a.Equal([]string{"backup/1/state.json", "backup/2/state.json"}, names)
+	names, err = s.List("")
+	r.NoError(err)
+	a.Equal([]string{"backup/1/state.json", "backup/2/state.json", "config.json"}, names)
+
+	r.NoError(s.Remove("backup/1/state.json"))
+	names, err = s.List("backup/")
+	r.NoError(err)
+	a.Equal([]string{"backup/2/state.json"}, names)
+
+	l, err := s.Lock("lock", time.Second)
+	r.NoError(err)
+	a.Nil(l.StaleOwner())
+	_, err = s.Lock("lock", 2*lockPollInterval)
+	var lerr LockedError
+	r.True(errors.As(err, &lerr))
+	r.NotNil(lerr.Owner)
+	a.Equal(os.Getpid(), lerr.Owner.PID)
+	r.NoError(l.Release())
+	r.NoError(l.Release())
+	l, err = s.Lock("lock", 0)
+	r.NoError(err)
+	r.NoError(l.Release())
+}
+
+// testConcurrentCreate checks that only one of concurrent writers creates document and that its content is kept.
+func testConcurrentCreate(t *testing.T, s Storage) {
+	a := assert.New(t)
+	r := require.New(t)
+	const writers = 20
+	errs := make([]error, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.Create("backup/1/state.json", []byte(strconv.Itoa(i)))
+		}(i)
+	}
+	wg.Wait()
+	winner := -1
+	for i, err := range errs {
+		if err == nil {
+			a.Equal(-1, winner, "document created by writers %d and %d", winner, i)
+			winner = i
+		} else {
+			a.Equal(os.ErrExist, err)
+		}
+	}
+	r.NotEqual(-1, winner, "document not created")
+	b, err := s.Read("backup/1/state.json")
+	r.NoError(err)
+	a.Equal(strconv.Itoa(winner), string(b))
+	names, err := s.List("")
+	r.NoError(err)
+	a.Equal([]string{"backup/1/state.json"}, names)
+}
+
+// testVersioned checks that of writers which read the same version of document only the first one replaces it.
+func testVersioned(t *testing.T, v Versioned) {
+	a := assert.New(t)
+	r := require.New(t)
+	_, _, err := v.ReadVersion("state.json")
+	a.True(os.IsNotExist(err))
+	r.NoError(v.WriteVersion("state.json", []byte("1"), ""))
+	err = v.WriteVersion("state.json", []byte("other 1"), "")
+	a.True(errors.Is(err, ErrConflict), "got error: %v", err)
+
+	b, version, err := v.ReadVersion("state.json")
+	r.NoError(err)
+	a.Equal("1", string(b))
+	r.NoError(v.WriteVersion("state.json", []byte("2"), version))
+	err = v.WriteVersion("state.json", []byte("other 2"), version)
+	a.True(errors.Is(err, ErrConflict), "got error: %v", err)
+
+	b, newVersion, err := v.ReadVersion("state.json")
+	r.NoError(err)
+	a.Equal("2", string(b))
+	a.NotEqual(version, newVersion)
+}
@@ -1,57 +1,20 @@
 package save
 
 import (
-	"io/ioutil"
-
-	awsbi "github.com/epiphany-platform/e-structures/awsbi/v0"
-	azks "github.com/epiphany-platform/e-structures/azks/v0"
-	hi "github.com/epiphany-platform/e-structures/hi/v0"
+	"github.com/epiphany-platform/e-structures/shared"
 	st "github.com/epiphany-platform/e-structures/state/v0"
+	"github.com/epiphany-platform/e-structures/storage"
 )
 
-func State(path string, state *st.State) error {
-	bytes, err := state.Marshal()
-	if err != nil {
-		return err
-	}
-	err = ioutil.WriteFile(path, bytes, 0644)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func AzKSConfig(path string, config *azks.Config) error {
-	bytes, err := config.Marshal()
-	if err != nil {
-		return err
-	}
-	err = ioutil.WriteFile(path, bytes, 0644)
-	if err != nil {
-		return err
-	}
-	return nil
+func State(path string, state *st.State, options ...shared.EncodeOption) error {
+	return shared.SaveSerialized(state, path, func() ([]byte, error) {
+		return state.Marshal(options...)
+	}, options...)
 }
 
-func HiConfig(path string, config *hi.Config) error {
-	bytes, err := config.Marshal()
-	if err != nil {
-		return err
-	}
-	err = ioutil.WriteFile(path, bytes, 0644)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-func AwsBIConfig(path string, config *awsbi.Config) error {
-	bytes, err := config.Marshal()
-	if err != nil {
-		return err
-	}
-	err = ioutil.WriteFile(path, bytes, 0644)
-	if err != nil {
-		return err
-	}
-	return nil
+// StateTo works like State but stores document with provided name in storage s.
+func StateTo(s storage.Storage, name string, state *st.State, options ...shared.EncodeOption) error {
+	return shared.SaveSerializedTo(state, s, name, func() ([]byte, error) {
+		return state.Marshal(options...)
+	}, options...)
 }
@@ -0,0 +1,187 @@
+package test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// S3Server is minimal in-process stand-in of S3 compatible service (like MinIO) serving single bucket with
+// path-style addressing. It supports GET, HEAD, PUT and DELETE of objects with If-Match and If-None-Match
+// conditions and ListObjectsV2. Every request has to carry valid AWS Signature Version 4 computed with
+// AccessKeyID and SecretAccessKey, otherwise it is rejected with 403 Forbidden like S3 would do.
+type S3Server struct {
+	*httptest.Server
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// MaxKeys is size of single ListObjectsV2 page.
+	MaxKeys int
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// NewS3Server starts S3Server. It has to be closed with Close.
+func NewS3Server(bucket string, accessKeyID string, secretAccessKey string) *S3Server {
+	s := &S3Server{
+		Bucket:          bucket,
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		MaxKeys:         1000,
+		objects:         make(map[string][]byte),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Keys returns sorted keys of all objects stored in bucket.
+func (s *S3Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]string, 0)
+	for k := range s.objects {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+	return result
+}
+
+type s3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+type s3ListResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Name                  string   `xml:"Name"`
+	Prefix                string   `xml:"Prefix"`
+	KeyCount              int      `xml:"KeyCount"`
+	IsTruncated           bool     `xml:"IsTruncated"`
+	NextContinuationToken string   `xml:"NextContinuationToken,omitempty"`
+	Contents              []struct {
+		Key  string `xml:"Key"`
+		ETag string `xml:"ETag"`
+		Size int    `xml:"Size"`
+	} `xml:"Contents"`
+}
+
+func (s *S3Server) handle(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	if err := s.verifyS3Signature(r, body); err != nil {
+		writeS3Error(w, http.StatusForbidden, "SignatureDoesNotMatch", err.Error())
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key := path, ""
+	if i := strings.Index(path, "/"); i >= 0 {
+		bucket, key = path[:i], path[i+1:]
+	}
+	if bucket != s.Bucket {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key == "" {
+		if r.Method != http.MethodGet || r.URL.Query().Get("list-type") != "2" {
+			writeS3Error(w, http.StatusNotImplemented, "NotImplemented", "Only ListObjectsV2 is implemented")
+			return
+		}
+		s.list(w, r)
+		return
+	}
+
+	data, exists := s.objects[key]
+	etag := ""
+	if exists {
+		etag = etagOf(data)
+	}
+	if m := r.Header.Get("If-Match"); m != "" && (!exists || m != etag) {
+		writeS3Error(w, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+		return
+	}
+	if r.Header.Get("If-None-Match") == "*" && exists {
+		writeS3Error(w, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if !exists {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(data)
+		}
+	case http.MethodPut:
+		s.objects[key] = body
+		w.Header().Set("ETag", etagOf(body))
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource.")
+	}
+}
+
+func (s *S3Server) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	after := r.URL.Query().Get("continuation-token")
+	keys := make([]string, 0)
+	for k := range s.objects {
+		if strings.HasPrefix(k, prefix) && k > after {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	result := s3ListResult{Name: s.Bucket, Prefix: prefix}
+	if len(keys) > s.MaxKeys {
+		keys = keys[:s.MaxKeys]
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[len(keys)-1]
+	}
+	result.KeyCount = len(keys)
+	for _, k := range keys {
+		result.Contents = append(result.Contents, struct {
+			Key  string `xml:"Key"`
+			ETag string `xml:"ETag"`
+			Size int    `xml:"Size"`
+		}{Key: k, ETag: etagOf(s.objects[k]), Size: len(s.objects[k])})
+	}
+	b, _ := xml.Marshal(result)
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = w.Write(append([]byte(xml.Header), b...))
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string, message string) {
+	b, _ := xml.Marshal(s3Error{Code: code, Message: message})
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write(append([]byte(xml.Header), b...))
+}
+
+func etagOf(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
@@ -0,0 +1,190 @@
+package test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3SignAlgorithm  = "AWS4-HMAC-SHA256"
+	s3SignDateFormat = "20060102T150405Z"
+	// s3MaxClockSkew is how far X-Amz-Date may be from server time, as in S3.
+	s3MaxClockSkew = 15 * time.Minute
+)
+
+// s3Authorization is parsed Authorization header of request signed with AWS Signature Version 4.
+type s3Authorization struct {
+	accessKeyID   string
+	date          string
+	region        string
+	service       string
+	signedHeaders []string
+	signature     string
+}
+
+// parseS3Authorization parses header of form
+// "AWS4-HMAC-SHA256 Credential=<key>/<date>/<region>/<service>/aws4_request, SignedHeaders=<h1;h2>, Signature=<hex>".
+func parseS3Authorization(header string) (*s3Authorization, error) {
+	if !strings.HasPrefix(header, s3SignAlgorithm+" ") {
+		return nil, errors.New("unsupported authorization algorithm")
+	}
+	fields := make(map[string]string)
+	for _, part := range strings.Split(strings.TrimPrefix(header, s3SignAlgorithm+" "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("malformed authorization field %q", part)
+		}
+		fields[kv[0]] = kv[1]
+	}
+	credential := strings.Split(fields["Credential"], "/")
+	if len(credential) != 5 || credential[4] != "aws4_request" {
+		return nil, errors.New("malformed credential")
+	}
+	if fields["SignedHeaders"] == "" || fields["Signature"] == "" {
+		return nil, errors.New("missing signed headers or signature")
+	}
+	return &s3Authorization{
+		accessKeyID:   credential[0],
+		date:          credential[1],
+		region:        credential[2],
+		service:       credential[3],
+		signedHeaders: strings.Split(fields["SignedHeaders"], ";"),
+		signature:     fields["Signature"],
+	}, nil
+}
+
+// verifyS3Signature recomputes AWS Signature Version 4 of request with secret of server and compares it with
+// signature sent by client. Payload hash sent in X-Amz-Content-Sha256 is checked against body as well.
+func (s *S3Server) verifyS3Signature(r *http.Request, body []byte) error {
+	auth, err := parseS3Authorization(r.Header.Get("Authorization"))
+	if err != nil {
+		return err
+	}
+	if auth.accessKeyID != s.AccessKeyID {
+		return errors.New("unknown access key")
+	}
+	if auth.service != "s3" {
+		return fmt.Errorf("unexpected service %q", auth.service)
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	t, err := time.Parse(s3SignDateFormat, amzDate)
+	if err != nil {
+		return fmt.Errorf("malformed X-Amz-Date: %v", err)
+	}
+	if d := time.Since(t); d > s3MaxClockSkew || d < -s3MaxClockSkew {
+		return errors.New("request time too skewed")
+	}
+	if amzDate[:8] != auth.date {
+		return errors.New("credential date doesn't match X-Amz-Date")
+	}
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash != s3SHA256Hex(body) {
+		return errors.New("X-Amz-Content-Sha256 doesn't match body")
+	}
+	if !sort.StringsAreSorted(auth.signedHeaders) {
+		return errors.New("signed headers are not sorted")
+	}
+	signed := make(map[string]bool)
+	var canonicalHeaders strings.Builder
+	for _, h := range auth.signedHeaders {
+		signed[h] = true
+		var value string
+		switch h {
+		case "host":
+			value = r.Host
+		case "content-length":
+			value = strconv.FormatInt(r.ContentLength, 10)
+		default:
+			value = strings.TrimSpace(strings.Join(r.Header.Values(h), ","))
+		}
+		canonicalHeaders.WriteString(h + ":" + value + "\n")
+	}
+	for _, h := range []string{"host", "x-amz-date", "x-amz-content-sha256"} {
+		if !signed[h] {
+			return fmt.Errorf("header %s is not signed", h)
+		}
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		s3CanonicalPath(r.URL.Path),
+		s3CanonicalQuery(r.URL.Query()),
+		canonicalHeaders.String(),
+		strings.Join(auth.signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+	scope := strings.Join([]string{auth.date, auth.region, auth.service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		s3SignAlgorithm,
+		amzDate,
+		scope,
+		s3SHA256Hex([]byte(canonicalRequest)),
+	}, "\n")
+	key := s3HMAC([]byte("AWS4"+s.SecretAccessKey), auth.date)
+	key = s3HMAC(key, auth.region)
+	key = s3HMAC(key, auth.service)
+	key = s3HMAC(key, "aws4_request")
+	expected := hex.EncodeToString(s3HMAC(key, stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(auth.signature)) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+// s3CanonicalPath URI encodes every segment of path leaving slashes untouched.
+func s3CanonicalPath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = s3URIEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// s3CanonicalQuery URI encodes query parameters sorting them by name and value.
+func s3CanonicalQuery(query url.Values) string {
+	parts := make([]string, 0, len(query))
+	for k, values := range query {
+		for _, v := range values {
+			parts = append(parts, s3URIEncode(k)+"="+s3URIEncode(v))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "&")
+}
+
+// s3URIEncode encodes everything but RFC 3986 unreserved characters.
+func s3URIEncode(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3SHA256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}